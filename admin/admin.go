@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/storageos/nfs/config"
+	"github.com/storageos/nfs/ganesha"
+	"github.com/storageos/nfs/logger"
+)
+
+// ExportMgr manages the server's exports and stats.  It is implemented by
+// *ganesha.ExportMgr.
+type ExportMgr interface {
+	ShowExports() ([]ganesha.Export, error)
+	DisplayExport(id uint16) (*ganesha.ExportDetails, error)
+	ResetStats() error
+	EnableStats(t ganesha.StatsType) error
+	DisableStats(t ganesha.StatsType) error
+}
+
+// ExportConfigMgr changes the running exports.  It is implemented by
+// *ganesha.ExportConfigMgr.
+type ExportConfigMgr interface {
+	AddExport(export *config.Export) (string, error)
+	UpdateExport(export *config.Export) (string, error)
+	RemoveExport(id uint16) error
+}
+
+// AccessMgr controls client access to the exports.  It is implemented by
+// *ganesha.AccessMgr.
+type AccessMgr interface {
+	Deny(id ganesha.ClientID) error
+	Allow(id ganesha.ClientID) error
+	Evict(id ganesha.ClientID) error
+}
+
+// Admin handles administrative requests.
+type Admin struct {
+	exportMgr ExportMgr
+	configMgr ExportConfigMgr
+	accessMgr AccessMgr
+	nfs       *ganesha.Ganesha
+	logMgr    *ganesha.LogMgr
+	log       *logger.Logger
+
+	// token must be presented as a bearer token by requests that change the
+	// server.  If empty, such requests are refused.
+	token string
+}
+
+// New creates a new Admin instance.  Requests that change the server must
+// include the header `Authorization: Bearer <token>`.
+func New(exportMgr ExportMgr, configMgr ExportConfigMgr, accessMgr AccessMgr, nfs *ganesha.Ganesha, logMgr *ganesha.LogMgr, token string, log *logger.Logger) *Admin {
+	return &Admin{
+		exportMgr: exportMgr,
+		configMgr: configMgr,
+		accessMgr: accessMgr,
+		nfs:       nfs,
+		logMgr:    logMgr,
+		log:       log,
+		token:     token,
+	}
+}
+
+// authorize wraps h, rejecting requests that change the server unless they
+// present the admin token.  GET and HEAD requests are allowed.
+func (a *Admin) authorize(h http.Handler) http.Handler {
+	restricted := a.Restrict(h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+		restricted.ServeHTTP(w, r)
+	})
+}
+
+// Restrict wraps h, rejecting all requests, including reads, unless they
+// present the admin token.
+func (a *Admin) Restrict(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if a.token == "" {
+			a.writeError(w, http.StatusForbidden, errors.New("admin token not configured"))
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if token == auth || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			a.writeError(w, http.StatusUnauthorized, fmt.Errorf("unauthorized %s request for %s", r.Method, r.URL.Path))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON writes v as the JSON response body.
+func (a *Admin) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.log.Warnf("failed writing http response: %v", err)
+	}
+}
+
+// writeError logs err and returns it to the client with the given status.
+func (a *Admin) writeError(w http.ResponseWriter, status int, err error) {
+	a.log.Warnf("admin request failed: %v", err)
+	http.Error(w, err.Error(), status)
+}
+
+// pathID returns the Export_Id following prefix in the request path, or false
+// if no id was given.
+func pathID(r *http.Request, prefix string) (uint16, bool, error) {
+	s := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if s == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, true, err
+	}
+	return uint16(id), true, nil
+}
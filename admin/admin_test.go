@@ -0,0 +1,42 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRestrict(t *testing.T) {
+
+	const token = "secret"
+
+	tests := []struct {
+		name       string
+		adminToken string
+		token      string
+		wantCode   int
+	}{
+		{"valid token", token, token, http.StatusOK},
+		{"missing token", token, "", http.StatusUnauthorized},
+		{"wrong token", token, "guess", http.StatusUnauthorized},
+		{"no token configured", "", token, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			a := New(nil, nil, nil, nil, nil, tt.adminToken, nil)
+			h := a.Restrict(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodGet, "/events", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/storageos/nfs/ganesha"
+)
+
+// ClientsEndpoint is the path the ClientsHandler expects to be registered on.
+// It should be registered with a trailing slash.
+const ClientsEndpoint = "/admin/clients/"
+
+// ClientsHandler returns an http handler for controlling client access at
+// runtime.
+//
+//	POST /admin/clients/<client>/deny   denies the client access to all exports
+//	POST /admin/clients/<client>/allow  removes a denial
+//	POST /admin/clients/<client>/evict  denies the client and removes its state
+//
+// Clients may be given as IPv4 or IPv6 addresses, or hostnames.  All requests
+// must be authorized.
+//
+// Ganesha refuses to remove an NFSv4 client holding state within its lease.
+// The client remains denied, and loses its state once its lease expires.
+func (a *Admin) ClientsHandler() http.Handler {
+	return a.authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, ClientsEndpoint), "/"), "/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		id, err := ganesha.ParseClientID(parts[0])
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		var action func(ganesha.ClientID) error
+		switch parts[1] {
+		case "deny":
+			action = a.accessMgr.Deny
+		case "allow":
+			action = a.accessMgr.Allow
+		case "evict":
+			action = a.accessMgr.Evict
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := action(id); err != nil {
+			a.writeError(w, http.StatusBadGateway, fmt.Errorf("failed to %s client %s: %v", parts[1], id, err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
@@ -0,0 +1,134 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/storageos/nfs/ganesha"
+)
+
+// fakeAccessMgr records the access changes made to it.  If err is set, every
+// change fails.
+type fakeAccessMgr struct {
+	err   error
+	calls []string
+}
+
+func (f *fakeAccessMgr) call(action string, id ganesha.ClientID) error {
+	f.calls = append(f.calls, action+" "+id.String())
+	return f.err
+}
+
+func (f *fakeAccessMgr) Deny(id ganesha.ClientID) error  { return f.call("Deny", id) }
+func (f *fakeAccessMgr) Allow(id ganesha.ClientID) error { return f.call("Allow", id) }
+func (f *fakeAccessMgr) Evict(id ganesha.ClientID) error { return f.call("Evict", id) }
+
+func TestClientsHandler(t *testing.T) {
+
+	const token = "secret"
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		mgrErr   error
+		wantCode int
+		wantCall string
+	}{
+		{
+			name:     "deny",
+			method:   http.MethodPost,
+			path:     "/admin/clients/10.0.0.1/deny",
+			token:    token,
+			wantCode: http.StatusNoContent,
+			wantCall: "Deny 10.0.0.1",
+		},
+		{
+			name:     "allow",
+			method:   http.MethodPost,
+			path:     "/admin/clients/::ffff:10.0.0.1/allow",
+			token:    token,
+			wantCode: http.StatusNoContent,
+			wantCall: "Allow 10.0.0.1",
+		},
+		{
+			name:     "evict",
+			method:   http.MethodPost,
+			path:     "/admin/clients/10.0.0.1/evict/",
+			token:    token,
+			wantCode: http.StatusNoContent,
+			wantCall: "Evict 10.0.0.1",
+		},
+		{
+			name:     "evict failed",
+			method:   http.MethodPost,
+			path:     "/admin/clients/10.0.0.1/evict",
+			token:    token,
+			mgrErr:   errors.New("client has state"),
+			wantCode: http.StatusBadGateway,
+			wantCall: "Evict 10.0.0.1",
+		},
+		{
+			name:     "unknown action",
+			method:   http.MethodPost,
+			path:     "/admin/clients/10.0.0.1/forget",
+			token:    token,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "missing action",
+			method:   http.MethodPost,
+			path:     "/admin/clients/10.0.0.1",
+			token:    token,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "invalid client",
+			method:   http.MethodPost,
+			path:     "/admin/clients/%20/deny",
+			token:    token,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "missing token",
+			method:   http.MethodPost,
+			path:     "/admin/clients/10.0.0.1/evict",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "method not allowed",
+			method:   http.MethodGet,
+			path:     "/admin/clients/10.0.0.1/deny",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			mgr := &fakeAccessMgr{err: tt.mgrErr}
+			a := New(nil, nil, mgr, nil, nil, token, nil)
+
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(""))
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			a.ClientsHandler().ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			var gotCall string
+			if len(mgr.calls) > 0 {
+				gotCall = mgr.calls[0]
+			}
+			if len(mgr.calls) > 1 || gotCall != tt.wantCall {
+				t.Errorf("calls = %q, want %q", mgr.calls, tt.wantCall)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+// Package admin provides HTTP handlers for administrative tasks on the running
+// NFS server.
+//
+// Requests are translated into calls to Ganesha's DBus management interfaces,
+// allowing exports to be changed without restarting the server and dropping
+// client connections.
+package admin
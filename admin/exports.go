@@ -0,0 +1,163 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/storageos/nfs/config"
+	"github.com/storageos/nfs/ganesha"
+)
+
+// ExportsEndpoint is the path the ExportsHandler expects to be registered on.
+// It should be registered both with and without a trailing slash.
+const ExportsEndpoint = "/admin/exports"
+
+// exportRequest is the body of add and update export requests.
+//
+// Config is the path to a Ganesha configuration file containing the EXPORT
+// block.  The block is validated and applied from a file of its own, so the
+// file only needs to be readable from the container.
+type exportRequest struct {
+	Config   string `json:"config"`
+	ExportID uint16 `json:"export_id"`
+}
+
+// ExportsHandler returns an http handler for managing exports at runtime.
+//
+//	GET    /admin/exports       lists active exports
+//	POST   /admin/exports       adds an export
+//	GET    /admin/exports/<id>  displays an export
+//	PUT    /admin/exports/<id>  updates an export
+//	DELETE /admin/exports/<id>  removes an export
+//
+// Requests that change exports must be authorized.
+func (a *Admin) ExportsHandler() http.Handler {
+	return a.authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id, hasID, err := pathID(r, ExportsEndpoint)
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid export id: %v", err))
+			return
+		}
+
+		switch {
+		case !hasID && r.Method == http.MethodGet:
+			a.showExports(w, r)
+		case !hasID && r.Method == http.MethodPost:
+			a.addExport(w, r)
+		case hasID && r.Method == http.MethodGet:
+			a.displayExport(w, r, id)
+		case hasID && r.Method == http.MethodPut:
+			a.updateExport(w, r, id)
+		case hasID && r.Method == http.MethodDelete:
+			a.removeExport(w, r, id)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func (a *Admin) showExports(w http.ResponseWriter, r *http.Request) {
+	exports, err := a.exportMgr.ShowExports()
+	if err != nil {
+		a.writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	a.writeJSON(w, http.StatusOK, exports)
+}
+
+func (a *Admin) displayExport(w http.ResponseWriter, r *http.Request, id uint16) {
+	export, err := a.exportMgr.DisplayExport(id)
+	if err != nil {
+		a.writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	a.writeJSON(w, http.StatusOK, export)
+}
+
+func (a *Admin) addExport(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeExportRequest(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	export, err := req.export(req.ExportID)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	msg, err := a.configMgr.AddExport(export)
+	if err != nil {
+		a.writeError(w, exportErrorStatus(err), err)
+		return
+	}
+	a.writeJSON(w, http.StatusCreated, map[string]string{"message": msg})
+}
+
+func (a *Admin) updateExport(w http.ResponseWriter, r *http.Request, id uint16) {
+	req, err := decodeExportRequest(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	export, err := req.export(id)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	msg, err := a.configMgr.UpdateExport(export)
+	if err != nil {
+		a.writeError(w, exportErrorStatus(err), err)
+		return
+	}
+	a.writeJSON(w, http.StatusOK, map[string]string{"message": msg})
+}
+
+func (a *Admin) removeExport(w http.ResponseWriter, r *http.Request, id uint16) {
+	if err := a.configMgr.RemoveExport(id); err != nil {
+		a.writeError(w, exportErrorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeExportRequest reads and validates an exportRequest from the request
+// body.
+func decodeExportRequest(r *http.Request) (*exportRequest, error) {
+	req := &exportRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+	if req.Config == "" {
+		return nil, errors.New("config file path must be set")
+	}
+	return req, nil
+}
+
+// export loads the EXPORT block with the given id from the request's config
+// file.
+func (req *exportRequest) export(id uint16) (*config.Export, error) {
+	cfg, err := config.Load(req.Config)
+	if err != nil {
+		return nil, err
+	}
+	export := cfg.Export(id)
+	if export == nil {
+		return nil, fmt.Errorf("%s has no export %d", req.Config, id)
+	}
+	return export, nil
+}
+
+// exportErrorStatus returns the response status for an export change error.
+// Invalid and unknown exports are the client's error.
+func exportErrorStatus(err error) int {
+	if err == ganesha.ErrUnknownExport {
+		return http.StatusNotFound
+	}
+	if _, ok := err.(*config.ValidationError); ok {
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
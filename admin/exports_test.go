@@ -0,0 +1,279 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/storageos/nfs/config"
+	"github.com/storageos/nfs/ganesha"
+)
+
+// fakeExportMgr records the calls made to it.  If err is set, every call
+// fails.
+type fakeExportMgr struct {
+	err   error
+	calls []string
+}
+
+func (f *fakeExportMgr) call(s string) error {
+	f.calls = append(f.calls, s)
+	return f.err
+}
+
+func (f *fakeExportMgr) ShowExports() ([]ganesha.Export, error) {
+	if err := f.call("ShowExports"); err != nil {
+		return nil, err
+	}
+	return []ganesha.Export{{ExportID: 1, Path: "/export"}}, nil
+}
+
+func (f *fakeExportMgr) DisplayExport(id uint16) (*ganesha.ExportDetails, error) {
+	if err := f.call("DisplayExport"); err != nil {
+		return nil, err
+	}
+	return &ganesha.ExportDetails{ExportID: id, Path: "/export"}, nil
+}
+
+func (f *fakeExportMgr) ResetStats() error {
+	return f.call("ResetStats")
+}
+
+func (f *fakeExportMgr) EnableStats(t ganesha.StatsType) error {
+	return f.call("EnableStats " + string(t))
+}
+
+func (f *fakeExportMgr) DisableStats(t ganesha.StatsType) error {
+	return f.call("DisableStats " + string(t))
+}
+
+// fakeConfigMgr records the export changes made to it.  If err is set, every
+// change fails.
+type fakeConfigMgr struct {
+	err   error
+	calls []string
+}
+
+func (f *fakeConfigMgr) call(s string) error {
+	f.calls = append(f.calls, s)
+	return f.err
+}
+
+func (f *fakeConfigMgr) AddExport(export *config.Export) (string, error) {
+	return "added", f.call(fmt.Sprintf("AddExport %d %s", export.ExportID, export.Path))
+}
+
+func (f *fakeConfigMgr) UpdateExport(export *config.Export) (string, error) {
+	return "updated", f.call(fmt.Sprintf("UpdateExport %d %s", export.ExportID, export.Path))
+}
+
+func (f *fakeConfigMgr) RemoveExport(id uint16) error {
+	return f.call(fmt.Sprintf("RemoveExport %d", id))
+}
+
+func TestExportsHandler(t *testing.T) {
+
+	const token = "secret"
+
+	dir, err := ioutil.TempDir("", "exports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "export.conf")
+	exports := "EXPORT {\n Export_Id = 7;\n Path = /export/7;\n}\nEXPORT {\n Export_Id = 9;\n Path = /export/9;\n}\n"
+	if err := ioutil.WriteFile(path, []byte(exports), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		token      string
+		noToken    bool
+		mgrErr     error
+		wantCode   int
+		wantCall   string
+		wantInBody string
+	}{
+		{
+			name:       "list",
+			method:     http.MethodGet,
+			path:       "/admin/exports",
+			wantCode:   http.StatusOK,
+			wantCall:   "ShowExports",
+			wantInBody: `"Path":"/export"`,
+		},
+		{
+			name:       "display",
+			method:     http.MethodGet,
+			path:       "/admin/exports/7",
+			wantCode:   http.StatusOK,
+			wantCall:   "DisplayExport",
+			wantInBody: `"ExportID":7`,
+		},
+		{
+			name:     "add",
+			method:   http.MethodPost,
+			path:     "/admin/exports",
+			body:     `{"config":"CONFIG","export_id":7}`,
+			token:    token,
+			wantCode: http.StatusCreated,
+			wantCall: "AddExport 7 /export/7",
+		},
+		{
+			name:     "update uses path id",
+			method:   http.MethodPut,
+			path:     "/admin/exports/9/",
+			body:     `{"config":"CONFIG","export_id":7}`,
+			token:    token,
+			wantCode: http.StatusOK,
+			wantCall: "UpdateExport 9 /export/9",
+		},
+		{
+			name:     "remove",
+			method:   http.MethodDelete,
+			path:     "/admin/exports/7",
+			token:    token,
+			wantCode: http.StatusNoContent,
+			wantCall: "RemoveExport 7",
+		},
+		{
+			name:     "export not in config",
+			method:   http.MethodPost,
+			path:     "/admin/exports",
+			body:     `{"config":"CONFIG","export_id":8}`,
+			token:    token,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "unreadable config",
+			method:   http.MethodPost,
+			path:     "/admin/exports",
+			body:     `{"config":"/nonexistent/export.conf","export_id":7}`,
+			token:    token,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid export",
+			method:   http.MethodPost,
+			path:     "/admin/exports",
+			body:     `{"config":"CONFIG","export_id":7}`,
+			token:    token,
+			mgrErr:   &config.ValidationError{Problems: []string{"export 7: Pseudo \"/\" is already used by export 1"}},
+			wantCode: http.StatusBadRequest,
+			wantCall: "AddExport 7 /export/7",
+		},
+		{
+			name:     "unknown export",
+			method:   http.MethodDelete,
+			path:     "/admin/exports/8",
+			token:    token,
+			mgrErr:   ganesha.ErrUnknownExport,
+			wantCode: http.StatusNotFound,
+			wantCall: "RemoveExport 8",
+		},
+		{
+			name:     "no token configured",
+			method:   http.MethodDelete,
+			path:     "/admin/exports/7",
+			token:    token,
+			noToken:  true,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "missing token",
+			method:   http.MethodPost,
+			path:     "/admin/exports",
+			body:     `{"config":"/tmp/export.conf"}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "wrong token",
+			method:   http.MethodDelete,
+			path:     "/admin/exports/7",
+			token:    "guess",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "invalid id",
+			method:   http.MethodGet,
+			path:     "/admin/exports/70000",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid body",
+			method:   http.MethodPost,
+			path:     "/admin/exports",
+			body:     `{"config":`,
+			token:    token,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "missing config",
+			method:   http.MethodPut,
+			path:     "/admin/exports/7",
+			body:     `{}`,
+			token:    token,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "method not allowed",
+			method:   http.MethodPut,
+			path:     "/admin/exports",
+			token:    token,
+			wantCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:     "server error",
+			method:   http.MethodGet,
+			path:     "/admin/exports",
+			mgrErr:   errors.New("dbus: not connected"),
+			wantCode: http.StatusBadGateway,
+			wantCall: "ShowExports",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			mgr := &fakeExportMgr{err: tt.mgrErr}
+			configMgr := &fakeConfigMgr{err: tt.mgrErr}
+			adminToken := token
+			if tt.noToken {
+				adminToken = ""
+			}
+			a := New(mgr, configMgr, nil, nil, nil, adminToken, nil)
+
+			body := strings.Replace(tt.body, "CONFIG", path, 1)
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			a.ExportsHandler().ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body.String())
+			}
+			calls := append(mgr.calls, configMgr.calls...)
+			var gotCall string
+			if len(calls) > 0 {
+				gotCall = calls[0]
+			}
+			if len(calls) > 1 || gotCall != tt.wantCall {
+				t.Errorf("calls = %q, want %q", calls, tt.wantCall)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantInBody) {
+				t.Errorf("body = %s, want to contain %s", w.Body.String(), tt.wantInBody)
+			}
+		})
+	}
+}
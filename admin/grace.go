@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// GraceEndpoint is the path the GraceHandler expects to be registered on.
+const GraceEndpoint = "/admin/grace"
+
+// GraceStatus is the response to grace period requests.
+type GraceStatus struct {
+	InGrace bool `json:"in_grace"`
+}
+
+// GraceRequest is the body of a request to start the grace period, or to
+// release an address.  IP is optional when starting grace.
+type GraceRequest struct {
+	IP string `json:"ip"`
+}
+
+// GraceHandler returns an http handler for the NFSv4 grace period.
+//
+//	GET    /admin/grace  returns whether the server is in grace
+//	POST   /admin/grace  starts grace, optionally for the address in the body
+//	DELETE /admin/grace  releases the clients of the address in the body
+//
+// The server's own grace period can not be ended on request.  It ends after the
+// configured Grace_Period, or once all clients have reclaimed.  Releasing an
+// address ends a takeover started for it, dropping its clients' state so that
+// another server can grant it.
+func (a *Admin) GraceHandler() http.Handler {
+	return a.authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			a.getGrace(w, r)
+		case http.MethodPost:
+			a.startGrace(w, r)
+		case http.MethodDelete:
+			a.releaseIP(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func (a *Admin) getGrace(w http.ResponseWriter, r *http.Request) {
+	inGrace, err := a.nfs.InGrace()
+	if err != nil {
+		a.writeError(w, http.StatusBadGateway, fmt.Errorf("failed to read grace status: %v", err))
+		return
+	}
+	a.writeJSON(w, http.StatusOK, GraceStatus{InGrace: inGrace})
+}
+
+func (a *Admin) startGrace(w http.ResponseWriter, r *http.Request) {
+	// An empty body starts grace for the server's own clients.
+	var req GraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", err))
+		return
+	}
+	if err := a.nfs.StartGrace(req.IP); err != nil {
+		a.writeError(w, http.StatusBadGateway, fmt.Errorf("failed to start grace: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Admin) releaseIP(w http.ResponseWriter, r *http.Request) {
+	var req GraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", err))
+		return
+	}
+	if req.IP == "" {
+		a.writeError(w, http.StatusBadRequest, errors.New("ip is required"))
+		return
+	}
+	if err := a.nfs.ReleaseIP(req.IP); err != nil {
+		a.writeError(w, http.StatusBadGateway, fmt.Errorf("failed to release %s: %v", req.IP, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
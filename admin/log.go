@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/storageos/nfs/ganesha"
+)
+
+// LogEndpoint is the path the LogHandler expects to be registered on.  It
+// should be registered both with and without a trailing slash.
+const LogEndpoint = "/admin/log"
+
+// logRequest is the body of set log level requests.
+//
+// TTL is optional.  If set, e.g. `10m`, the level is reverted once it expires.
+type logRequest struct {
+	Level string `json:"level"`
+	TTL   string `json:"ttl"`
+}
+
+// logLevels is the response to the list log levels request.
+type logLevels struct {
+	Levels  map[string]ganesha.LogLevel `json:"levels"`
+	Reverts []ganesha.LogRevert         `json:"reverts"`
+}
+
+// logLevel is the response to the get log level request.
+type logLevel struct {
+	Component string           `json:"component"`
+	Level     ganesha.LogLevel `json:"level"`
+}
+
+// LogHandler returns an http handler for controlling nfs-ganesha log levels at
+// runtime.
+//
+//	GET /admin/log              lists the level of each component
+//	PUT /admin/log              sets the level of all components
+//	GET /admin/log/<component>  returns the level of a component
+//	PUT /admin/log/<component>  sets the level of a component
+//
+// Components are named as in the LOG block, e.g. NFS_V4, FSAL or DISPATCH.
+// Requests that change levels must be authorized.
+func (a *Admin) LogHandler() http.Handler {
+	return a.authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		component := strings.Trim(strings.TrimPrefix(r.URL.Path, LogEndpoint), "/")
+
+		switch {
+		case component == "" && r.Method == http.MethodGet:
+			a.logLevels(w, r)
+		case component == "" && r.Method == http.MethodPut:
+			a.setLogLevel(w, r, ganesha.DefaultLogComponent)
+		case r.Method == http.MethodGet:
+			a.logLevel(w, r, component)
+		case r.Method == http.MethodPut:
+			a.setLogLevel(w, r, component)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func (a *Admin) logLevels(w http.ResponseWriter, r *http.Request) {
+	levels, err := a.logMgr.Levels()
+	if err != nil {
+		a.writeError(w, http.StatusBadGateway, fmt.Errorf("failed to read log levels: %v", err))
+		return
+	}
+	a.writeJSON(w, http.StatusOK, logLevels{Levels: levels, Reverts: a.logMgr.Reverts()})
+}
+
+func (a *Admin) logLevel(w http.ResponseWriter, r *http.Request, component string) {
+	level, err := a.logMgr.Level(component)
+	if err != nil {
+		a.writeError(w, logErrorStatus(err), fmt.Errorf("failed to read log level of %s: %v", component, err))
+		return
+	}
+	a.writeJSON(w, http.StatusOK, logLevel{Component: strings.ToUpper(component), Level: level})
+}
+
+func (a *Admin) setLogLevel(w http.ResponseWriter, r *http.Request, component string) {
+	req := &logRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", err))
+		return
+	}
+	level, err := ganesha.ParseLogLevel(req.Level)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl < 0 {
+			a.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ttl %q", req.TTL))
+			return
+		}
+	}
+	if err := a.logMgr.SetLevel(component, level, ttl); err != nil {
+		a.writeError(w, logErrorStatus(err), fmt.Errorf("failed to set log level of %s: %v", component, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logErrorStatus returns the response status for a log level error.  Unknown
+// components are the client's error.
+func logErrorStatus(err error) int {
+	if err == ganesha.ErrUnknownLogComponent {
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
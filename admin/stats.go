@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/storageos/nfs/ganesha"
+)
+
+// StatsEndpoint is the path the StatsHandler expects to be registered on.  It
+// should be registered with a trailing slash.
+const StatsEndpoint = "/admin/stats/"
+
+// StatsHandler returns an http handler for controlling stats collection at
+// runtime.
+//
+//	POST /admin/stats/reset           clears all stats counters
+//	POST /admin/stats/enable/<type>   starts collecting a type of stats
+//	POST /admin/stats/disable/<type>  stops collecting a type of stats
+//
+// Types are: all, nfs, fsal, v3_full, v4_full, auth and client_all_ops.
+// nfsv3, nfsv4 and clnt_allops are accepted as aliases.
+//
+// All requests must be authorized.
+func (a *Admin) StatsHandler() http.Handler {
+	return a.authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, StatsEndpoint), "/"), "/")
+		switch {
+		case len(parts) == 1 && parts[0] == "reset":
+			a.resetStats(w, r)
+		case len(parts) == 2 && (parts[0] == "enable" || parts[0] == "disable"):
+			t, err := ganesha.ParseStatsType(parts[1])
+			if err != nil {
+				a.writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			a.setStats(w, r, t, parts[0] == "enable")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func (a *Admin) resetStats(w http.ResponseWriter, r *http.Request) {
+	if err := a.exportMgr.ResetStats(); err != nil {
+		a.writeError(w, http.StatusBadGateway, fmt.Errorf("failed to reset stats: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Admin) setStats(w http.ResponseWriter, r *http.Request, t ganesha.StatsType, enable bool) {
+	var err error
+	if enable {
+		err = a.exportMgr.EnableStats(t)
+	} else {
+		err = a.exportMgr.DisableStats(t)
+	}
+	if err != nil {
+		a.writeError(w, http.StatusBadGateway, fmt.Errorf("failed to set %s stats: %v", t, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
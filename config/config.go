@@ -0,0 +1,186 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// Config is the typed representation of an nfs-ganesha configuration file.
+type Config struct {
+	Core    *CoreParam
+	NFSv4   *NFSv4
+	Exports []*Export
+
+	// Includes lists the files referenced by `%include` directives.  Includes
+	// are not followed by Parse.  Load follows and merges them, leaving
+	// Includes empty.
+	Includes []string
+
+	// Blocks holds top-level blocks that are not otherwise modelled, such as
+	// LOG or MDCACHE.
+	Blocks []*Block
+}
+
+// CoreParam is the NFS_Core_Param block.
+type CoreParam struct {
+	Protocols  []string
+	FsidDevice bool
+
+	// Params holds parameters that are not otherwise modelled.
+	Params []*Param
+}
+
+// NFSv4 is the NFSV4 block.
+type NFSv4 struct {
+	Graceless       bool
+	LeaseLifetime   int
+	GracePeriod     int
+	RecoveryBackend string
+	RecoveryRoot    string
+
+	// Params holds parameters that are not otherwise modelled.
+	Params []*Param
+}
+
+// Export is an EXPORT block.
+type Export struct {
+	ExportID   uint16
+	Path       string
+	Pseudo     string
+	Tag        string
+	Protocols  []string
+	Transports []string
+	AccessType string
+	Squash     string
+	SecType    []string
+	FSAL       *FSAL
+	Clients    []*Client
+
+	// Params and Blocks hold parameters and sub-blocks that are not otherwise
+	// modelled.
+	Params []*Param
+	Blocks []*Block
+
+	line int
+}
+
+// FSAL is the FSAL sub-block of an export.
+type FSAL struct {
+	Name string
+
+	// Params and Blocks hold FSAL-specific settings.
+	Params []*Param
+	Blocks []*Block
+}
+
+// Client is a CLIENT sub-block of an export.  It overrides the export's access
+// settings for the listed clients.
+type Client struct {
+	Clients    []string
+	AccessType string
+	Squash     string
+
+	// Params holds parameters that are not otherwise modelled.
+	Params []*Param
+}
+
+// Block is a generic configuration block.
+type Block struct {
+	Name   string
+	Params []*Param
+	Blocks []*Block
+
+	line int
+}
+
+// Param is a generic `Name = Value[, Value...];` configuration parameter.
+type Param struct {
+	Name   string
+	Values []string
+
+	line int
+}
+
+// Export returns the export with the given id, or nil if not found.
+func (c *Config) Export(id uint16) *Export {
+	for _, export := range c.Exports {
+		if export.ExportID == id {
+			return export
+		}
+	}
+	return nil
+}
+
+// FSALs returns the sorted names of the FSALs used by the exports, in upper
+// case as Ganesha does not distinguish case.  Exports without an FSAL block
+// use DefaultFSAL.
+func (c *Config) FSALs() []string {
+	seen := make(map[string]bool)
+	var fsals []string
+	for _, export := range c.Exports {
+		name := DefaultFSAL
+		if export.FSAL != nil && export.FSAL.Name != "" {
+			name = strings.ToUpper(export.FSAL.Name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			fsals = append(fsals, name)
+		}
+	}
+	sort.Strings(fsals)
+	return fsals
+}
+
+// Copy returns a copy of the configuration whose list of exports can be
+// changed without affecting the original.  The exports and other blocks are
+// shared; use Export.Copy before modifying an export.
+func (c *Config) Copy() *Config {
+	cc := *c
+	cc.Exports = append([]*Export(nil), c.Exports...)
+	return &cc
+}
+
+// supportsV4 returns true if the protocol list enables NFSv4.  An empty list
+// uses Ganesha's default of NFSv3 and NFSv4.
+func supportsV4(protocols []string) bool {
+	if len(protocols) == 0 {
+		return true
+	}
+	for _, p := range protocols {
+		if normaliseProtocol(p) == "4" {
+			return true
+		}
+	}
+	return false
+}
+
+// normaliseProtocol converts the various accepted spellings of a protocol to
+// "3", "4" or "9P".  Unknown values are returned unchanged.
+func normaliseProtocol(p string) string {
+	switch strings.ToUpper(p) {
+	case "3", "V3", "NFS3", "NFSV3":
+		return "3"
+	case "4", "V4", "NFS4", "NFSV4":
+		return "4"
+	case "9P":
+		return "9P"
+	}
+	return p
+}
+
+// Copy returns a copy of the export that can be modified without affecting the
+// original.  The FSAL and unmodelled blocks are shared.
+func (e *Export) Copy() *Export {
+	c := *e
+	c.Protocols = append([]string(nil), e.Protocols...)
+	c.Transports = append([]string(nil), e.Transports...)
+	c.SecType = append([]string(nil), e.SecType...)
+	c.Params = append([]*Param(nil), e.Params...)
+	c.Clients = make([]*Client, 0, len(e.Clients))
+	for _, client := range e.Clients {
+		cc := *client
+		cc.Clients = append([]string(nil), client.Clients...)
+		c.Clients = append(c.Clients, &cc)
+	}
+	return &c
+}
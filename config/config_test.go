@@ -0,0 +1,485 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+# Sample configuration.
+NFS_Core_Param {
+	fsid_device = true;
+}
+
+NFSV4 {
+	Graceless = true;
+	Lease_Lifetime = 30;
+}
+
+EXPORT {
+	Export_Id = 77;
+	Path = /export;
+	Pseudo = /;
+	Protocols = 4;
+	Transports = TCP;
+	Access_Type = None;
+	Squash = none;
+	Sectype = sys;
+
+	CLIENT {
+		Clients = 10.0.0.1, "10.1.0.0/16";
+		Access_Type = RW;
+	}
+
+	FSAL {
+		Name = VFS;
+	}
+}
+
+LOG {
+	Default_Log_Level = EVENT;
+	COMPONENTS {
+		FSAL = DEBUG;
+	}
+}
+`
+
+func TestParse(t *testing.T) {
+
+	cfg, err := ParseString(testConfig)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if cfg.Core == nil || !cfg.Core.FsidDevice {
+		t.Errorf("Parse() Core = %+v, want fsid_device set", cfg.Core)
+	}
+	if cfg.NFSv4 == nil || !cfg.NFSv4.Graceless || cfg.NFSv4.LeaseLifetime != 30 {
+		t.Errorf("Parse() NFSv4 = %+v, want Graceless and Lease_Lifetime 30", cfg.NFSv4)
+	}
+	if len(cfg.Exports) != 1 {
+		t.Fatalf("Parse() got %d exports, want 1", len(cfg.Exports))
+	}
+
+	export := cfg.Export(77)
+	if export == nil {
+		t.Fatal("Export(77) = nil")
+	}
+	if export.Path != "/export" || export.Pseudo != "/" || export.AccessType != "None" {
+		t.Errorf("Parse() export = %+v", export)
+	}
+	if export.FSAL == nil || export.FSAL.Name != "VFS" {
+		t.Errorf("Parse() FSAL = %+v, want VFS", export.FSAL)
+	}
+	if len(export.Clients) != 1 || !reflect.DeepEqual(export.Clients[0].Clients, []string{"10.0.0.1", "10.1.0.0/16"}) {
+		t.Errorf("Parse() clients = %+v", export.Clients)
+	}
+	if len(cfg.Blocks) != 1 || cfg.Blocks[0].Name != "LOG" || len(cfg.Blocks[0].Blocks) != 1 {
+		t.Errorf("Parse() blocks = %+v, want LOG block preserved", cfg.Blocks)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+
+	cfg, err := ParseString(testConfig)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := cfg.String()
+
+	reparsed, err := ParseString(want)
+	if err != nil {
+		t.Fatalf("Parse() of written config error = %v\n%s", err, want)
+	}
+	if got := reparsed.String(); got != want {
+		t.Errorf("round trip mismatch:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:    "missing closing brace",
+			config:  "EXPORT {\n Export_Id = 1;\n",
+			wantErr: "missing closing '}'",
+		},
+		{
+			name:    "parameter outside block",
+			config:  "Export_Id = 1;",
+			wantErr: "parameters must be set within a block",
+		},
+		{
+			name:    "missing export id",
+			config:  "EXPORT { Path = /export; }",
+			wantErr: "missing Export_Id",
+		},
+		{
+			name:    "invalid export id",
+			config:  "EXPORT { Export_Id = 70000; }",
+			wantErr: "line 1: Export_Id must be a number",
+		},
+		{
+			name:    "invalid bool",
+			config:  "NFSV4 {\n Graceless = maybe;\n}",
+			wantErr: "line 2: Graceless must be true or false",
+		},
+		{
+			name:    "unterminated string",
+			config:  "EXPORT { Path = \"/export; }",
+			wantErr: "unterminated string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseString(tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:   "valid v3 only without pseudo",
+			config: "EXPORT { Export_Id = 1; Path = /a; Protocols = 3; FSAL { Name = VFS; } }",
+		},
+		{
+			name:    "duplicate export id",
+			config:  "EXPORT { Export_Id = 1; Path = /a; Pseudo = /a; FSAL { Name = VFS; } } EXPORT { Export_Id = 1; Path = /b; Pseudo = /b; FSAL { Name = VFS; } }",
+			wantErr: "export 1: Export_Id must be unique",
+		},
+		{
+			name:    "missing pseudo for v4",
+			config:  "EXPORT { Export_Id = 1; Path = /a; Protocols = 3, 4; FSAL { Name = VFS; } }",
+			wantErr: "Pseudo must be set for NFSv4",
+		},
+		{
+			name:    "invalid access type",
+			config:  "EXPORT { Export_Id = 1; Path = /a; Pseudo = /; Access_Type = RWX; FSAL { Name = VFS; } }",
+			wantErr: `invalid Access_Type "RWX"`,
+		},
+		{
+			name:    "invalid squash",
+			config:  "EXPORT { Export_Id = 1; Path = /a; Pseudo = /; Squash = some; FSAL { Name = VFS; } }",
+			wantErr: `invalid Squash "some"`,
+		},
+		{
+			name:    "invalid sectype",
+			config:  "EXPORT { Export_Id = 1; Path = /a; Pseudo = /; Sectype = sys, krb6; FSAL { Name = VFS; } }",
+			wantErr: `invalid SecType "krb6"`,
+		},
+		{
+			name:    "missing fsal",
+			config:  "EXPORT { Export_Id = 1; Path = /a; Pseudo = /; }",
+			wantErr: "FSAL block with Name must be set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseString(tt.config)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			err = cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadIncludes(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"ganesha.conf": "%include exports.conf\nNFSV4 { Graceless = true; }\n",
+		"exports.conf": "EXPORT { Export_Id = 1; Path = /a; Pseudo = /; FSAL { Name = VFS; } }\n",
+		"loop.conf":    "%include loop.conf\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := Load(filepath.Join(dir, "ganesha.conf"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Includes) != 0 {
+		t.Errorf("Load() Includes = %v, want none", cfg.Includes)
+	}
+	if cfg.Export(1) == nil || cfg.NFSv4 == nil {
+		t.Errorf("Load() did not merge included file: %s", cfg)
+	}
+
+	_, read, err := LoadFiles(filepath.Join(dir, "ganesha.conf"))
+	if err != nil {
+		t.Fatalf("LoadFiles() error = %v", err)
+	}
+	want := []string{filepath.Join(dir, "ganesha.conf"), filepath.Join(dir, "exports.conf")}
+	if !reflect.DeepEqual(read, want) {
+		t.Errorf("LoadFiles() files = %v, want %v", read, want)
+	}
+
+	if _, err := Load(filepath.Join(dir, "loop.conf")); err == nil || !strings.Contains(err.Error(), "include loop") {
+		t.Errorf("Load() error = %v, want include loop", err)
+	}
+}
+
+func TestSpecConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    Spec
+		want    *Export
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			spec: Spec{Exports: []ExportSpec{{}}},
+			want: &Export{
+				ExportID:   DefaultExportID,
+				Path:       DefaultExportPath,
+				Pseudo:     DefaultPseudo,
+				Protocols:  DefaultProtocols,
+				Transports: []string{"TCP"},
+				AccessType: DefaultAccessType,
+				Squash:     DefaultSquash,
+				SecType:    []string{"sys"},
+				FSAL:       &FSAL{Name: DefaultFSAL},
+			},
+		},
+		{
+			name: "restricted clients",
+			spec: Spec{
+				Protocols: []string{"3", "4"},
+				Exports: []ExportSpec{{
+					ID:      5,
+					Path:    "/data",
+					Pseudo:  "/data",
+					Access:  "RO",
+					Squash:  "root_squash",
+					Clients: []string{"10.0.0.0/8"},
+				}},
+			},
+			want: &Export{
+				ExportID:   5,
+				Path:       "/data",
+				Pseudo:     "/data",
+				Protocols:  []string{"3", "4"},
+				Transports: []string{"TCP"},
+				AccessType: "None",
+				Squash:     "root_squash",
+				SecType:    []string{"sys"},
+				FSAL:       &FSAL{Name: DefaultFSAL},
+				Clients: []*Client{{
+					Clients:    []string{"10.0.0.0/8"},
+					AccessType: "RO",
+					Squash:     "root_squash",
+				}},
+			},
+		},
+		{
+			name:    "no exports",
+			spec:    Spec{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.spec.Config()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Config() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if len(cfg.Exports) != 1 || !reflect.DeepEqual(cfg.Exports[0], tt.want) {
+				t.Errorf("Config() export = %+v, want %+v", cfg.Exports[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestFSALs(t *testing.T) {
+
+	cfg := &Config{
+		Exports: []*Export{
+			{ExportID: 1, FSAL: &FSAL{Name: "vfs"}},
+			{ExportID: 2, FSAL: &FSAL{Name: "CEPH"}},
+			{ExportID: 3},
+			{ExportID: 4, FSAL: &FSAL{Name: "Ceph"}},
+		},
+	}
+	want := []string{"CEPH", DefaultFSAL}
+	if got := cfg.FSALs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("FSALs() = %q, want %q", got, want)
+	}
+	if got := (&Config{}).FSALs(); len(got) != 0 {
+		t.Errorf("FSALs() with no exports = %q, want none", got)
+	}
+}
+
+func TestLoadSpec(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := &Spec{
+		Protocols: []string{"3", "4"},
+		Exports: []ExportSpec{
+			{ID: 5, Path: "/data", Pseudo: "/data", Access: "RO", Clients: []string{"10.0.0.0/8"}},
+			{Path: "/logs", Pseudo: "/logs"},
+		},
+	}
+
+	files := map[string]string{
+		"spec.json": `{
+			"protocols": ["3", "4"],
+			"exports": [
+				{"id": 5, "path": "/data", "pseudo": "/data", "access": "RO", "clients": ["10.0.0.0/8"]},
+				{"path": "/logs", "pseudo": "/logs"}
+			]
+		}`,
+		"spec.yaml": `
+protocols: ["3", "4"]
+exports:
+  - id: 5
+    path: /data
+    pseudo: /data
+    access: RO
+    clients:
+      - 10.0.0.0/8
+  - path: /logs
+    pseudo: /logs
+`,
+		"spec.YML": `{protocols: ["3", "4"], exports: [{id: 5, path: /data, pseudo: /data, access: RO, clients: [10.0.0.0/8]}, {path: /logs, pseudo: /logs}]}`,
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := LoadSpec(path)
+		if err != nil {
+			t.Errorf("LoadSpec(%s) error = %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("LoadSpec(%s) = %+v, want %+v", name, got, want)
+		}
+	}
+
+	// YAML is not accepted in a JSON file.
+	path := filepath.Join(dir, "spec.conf")
+	if err := ioutil.WriteFile(path, []byte(files["spec.yaml"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSpec(path); err == nil {
+		t.Errorf("LoadSpec(spec.conf): got no error")
+	}
+
+	// Unknown fields are refused.
+	for name, data := range map[string]string{
+		"unknown.json": `{"exports": [{"path": "/data", "pseudoPath": "/data"}]}`,
+		"unknown.yaml": "exports:\n  - path: /data\n    Squash: root\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadSpec(path); err == nil {
+			t.Errorf("LoadSpec(%s): got no error", name)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	incDir := filepath.Join(dir, "include")
+	if err := os.Mkdir(incDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	top := filepath.Join(dir, "ganesha.conf")
+	include := filepath.Join(incDir, "exports.conf")
+	if err := ioutil.WriteFile(top, []byte("%include include/exports.conf\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(include, []byte("EXPORT { Export_Id = 1; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(top)
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 10)
+	go w.Run(ctx, func() { changed <- struct{}{} })
+
+	// Allow the watches to be added.
+	time.Sleep(100 * time.Millisecond)
+
+	// Rewriting a file with the same content is not a change.
+	if err := ioutil.WriteFile(include, []byte("EXPORT { Export_Id = 1; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(include, []byte("EXPORT { Export_Id = 2; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change to included file not reported")
+	}
+	select {
+	case <-changed:
+		t.Fatal("change reported more than once")
+	case <-time.After(2 * watchSettle):
+	}
+}
@@ -0,0 +1,27 @@
+// Package config provides a typed model of the nfs-ganesha configuration file
+// format, with a parser, validator and writer.
+//
+// The configuration is made up of named blocks containing `key = value;`
+// parameters and nested blocks, for example:
+//
+//	NFS_Core_Param {
+//		fsid_device = true;
+//	}
+//
+//	EXPORT {
+//		Export_Id = 77;
+//		Path = /export;
+//		Pseudo = /;
+//		FSAL {
+//			Name = VFS;
+//		}
+//	}
+//
+// The blocks and parameters used by the NFS container are decoded into typed
+// fields.  Anything else is preserved as a generic Block or Param so that a
+// parsed configuration can be written back without losing settings.
+//
+// Block and parameter names are case-insensitive, as they are in nfs-ganesha.
+// See:
+// https://github.com/nfs-ganesha/nfs-ganesha/blob/next/src/config_samples/config.txt
+package config
@@ -0,0 +1,650 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// includeDirective is the keyword used to include another file.
+const includeDirective = "%include"
+
+// Parse reads a configuration from r.  Include directives are recorded in
+// Includes but not followed.
+func Parse(r io.Reader) (*Config, error) {
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{lex: newLexer(data)}
+	root, includes, err := p.parseFile()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := decode(root)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Includes = includes
+	return cfg, nil
+}
+
+// ParseString reads a configuration from a string.
+func ParseString(s string) (*Config, error) {
+	return Parse(strings.NewReader(s))
+}
+
+// Load reads the configuration file at path, following and merging any
+// included files.  Relative include paths are resolved from the directory of
+// the file that includes them.
+func Load(path string) (*Config, error) {
+	cfg, _, err := LoadFiles(path)
+	return cfg, err
+}
+
+// LoadFiles is like Load, but also returns the absolute paths of the files
+// read, starting with path.
+func LoadFiles(path string) (*Config, []string, error) {
+	cfg := &Config{}
+	var files []string
+	if err := load(cfg, path, make(map[string]bool), &files); err != nil {
+		return nil, nil, err
+	}
+	return cfg, files, nil
+}
+
+// load parses path and merges it into cfg.  seen is used to detect include
+// loops and files records each file read.
+func load(cfg *Config, path string, seen map[string]bool, files *[]string) error {
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if seen[abs] {
+		return fmt.Errorf("%s: include loop detected", path)
+	}
+	seen[abs] = true
+	defer delete(seen, abs)
+	*files = append(*files, abs)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	part, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	for _, include := range part.Includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		if err := load(cfg, include, seen, files); err != nil {
+			return err
+		}
+	}
+	part.Includes = nil
+
+	return merge(cfg, part)
+}
+
+// merge adds the contents of src to dst.  Only a single NFS_Core_Param and
+// NFSV4 block may be defined across all files.
+func merge(dst *Config, src *Config) error {
+	if src.Core != nil {
+		if dst.Core != nil {
+			return fmt.Errorf("NFS_Core_Param block defined more than once")
+		}
+		dst.Core = src.Core
+	}
+	if src.NFSv4 != nil {
+		if dst.NFSv4 != nil {
+			return fmt.Errorf("NFSV4 block defined more than once")
+		}
+		dst.NFSv4 = src.NFSv4
+	}
+	dst.Exports = append(dst.Exports, src.Exports...)
+	dst.Blocks = append(dst.Blocks, src.Blocks...)
+	return nil
+}
+
+// tokenType identifies the type of a lexical token.
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokWord
+	tokString
+	tokLBrace
+	tokRBrace
+	tokEquals
+	tokSemicolon
+	tokComma
+)
+
+func (t tokenType) String() string {
+	switch t {
+	case tokEOF:
+		return "end of file"
+	case tokWord:
+		return "word"
+	case tokString:
+		return "string"
+	case tokLBrace:
+		return "'{'"
+	case tokRBrace:
+		return "'}'"
+	case tokEquals:
+		return "'='"
+	case tokSemicolon:
+		return "';'"
+	case tokComma:
+		return "','"
+	}
+	return "unknown token"
+}
+
+type token struct {
+	typ  tokenType
+	val  string
+	line int
+}
+
+// lexer splits configuration data into tokens.
+type lexer struct {
+	r    *bufio.Reader
+	line int
+}
+
+func newLexer(data []byte) *lexer {
+	return &lexer{
+		r:    bufio.NewReader(bytes.NewReader(data)),
+		line: 1,
+	}
+}
+
+// isWordRune returns true if c may appear in an unquoted word.
+func isWordRune(c rune) bool {
+	switch c {
+	case '{', '}', '=', ';', ',', '#', '"', '\'', ' ', '\t', '\r', '\n':
+		return false
+	}
+	return true
+}
+
+// next returns the next token.
+func (l *lexer) next() (token, error) {
+	for {
+		c, _, err := l.r.ReadRune()
+		if err == io.EOF {
+			return token{typ: tokEOF, line: l.line}, nil
+		}
+		if err != nil {
+			return token{}, err
+		}
+
+		switch c {
+		case '\n':
+			l.line++
+		case ' ', '\t', '\r':
+		case '#':
+			// Comments run to the end of the line.
+			if _, err := l.r.ReadString('\n'); err != nil && err != io.EOF {
+				return token{}, err
+			}
+			l.line++
+		case '{':
+			return token{typ: tokLBrace, val: "{", line: l.line}, nil
+		case '}':
+			return token{typ: tokRBrace, val: "}", line: l.line}, nil
+		case '=':
+			return token{typ: tokEquals, val: "=", line: l.line}, nil
+		case ';':
+			return token{typ: tokSemicolon, val: ";", line: l.line}, nil
+		case ',':
+			return token{typ: tokComma, val: ",", line: l.line}, nil
+		case '"', '\'':
+			return l.quoted(c)
+		default:
+			return l.word(c)
+		}
+	}
+}
+
+// quoted reads a string terminated by the quote character q.
+func (l *lexer) quoted(q rune) (token, error) {
+	line := l.line
+	var sb strings.Builder
+	for {
+		c, _, err := l.r.ReadRune()
+		if err == io.EOF {
+			return token{}, fmt.Errorf("line %d: unterminated string", line)
+		}
+		if err != nil {
+			return token{}, err
+		}
+		if c == q {
+			return token{typ: tokString, val: sb.String(), line: line}, nil
+		}
+		if c == '\n' {
+			l.line++
+		}
+		sb.WriteRune(c)
+	}
+}
+
+// word reads an unquoted word starting with first.
+func (l *lexer) word(first rune) (token, error) {
+	var sb strings.Builder
+	sb.WriteRune(first)
+	for {
+		c, _, err := l.r.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return token{}, err
+		}
+		if !isWordRune(c) {
+			if err := l.r.UnreadRune(); err != nil {
+				return token{}, err
+			}
+			break
+		}
+		sb.WriteRune(c)
+	}
+	return token{typ: tokWord, val: sb.String(), line: l.line}, nil
+}
+
+// parser builds generic blocks from lexer tokens.
+type parser struct {
+	lex  *lexer
+	peek *token
+}
+
+func (p *parser) next() (token, error) {
+	if p.peek != nil {
+		t := *p.peek
+		p.peek = nil
+		return t, nil
+	}
+	return p.lex.next()
+}
+
+func (p *parser) unread(t token) {
+	p.peek = &t
+}
+
+// parseFile parses the top level of a file, returning its contents as the
+// blocks of an unnamed root block, along with any includes.
+func (p *parser) parseFile() (*Block, []string, error) {
+
+	root := &Block{}
+	var includes []string
+
+	for {
+		t, err := p.next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case t.typ == tokEOF:
+			return root, includes, nil
+		case t.typ == tokWord && strings.EqualFold(t.val, includeDirective):
+			name, err := p.next()
+			if err != nil {
+				return nil, nil, err
+			}
+			if name.typ != tokWord && name.typ != tokString {
+				return nil, nil, fmt.Errorf("line %d: expected file name after %s, got %s", name.line, includeDirective, name.typ)
+			}
+			includes = append(includes, name.val)
+		case t.typ == tokWord:
+			open, err := p.next()
+			if err != nil {
+				return nil, nil, err
+			}
+			if open.typ != tokLBrace {
+				return nil, nil, fmt.Errorf("line %d: expected '{' after %s, parameters must be set within a block", open.line, t.val)
+			}
+			block, err := p.parseBlock(t)
+			if err != nil {
+				return nil, nil, err
+			}
+			root.Blocks = append(root.Blocks, block)
+		default:
+			return nil, nil, fmt.Errorf("line %d: unexpected %s", t.line, t.typ)
+		}
+	}
+}
+
+// parseBlock parses the body of a block, after its opening brace.
+func (p *parser) parseBlock(name token) (*Block, error) {
+
+	block := &Block{Name: name.val, line: name.line}
+
+	for {
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t.typ {
+		case tokEOF:
+			return nil, fmt.Errorf("line %d: block %s is missing closing '}'", name.line, name.val)
+		case tokRBrace:
+			return block, nil
+		case tokWord:
+			op, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			switch op.typ {
+			case tokLBrace:
+				sub, err := p.parseBlock(t)
+				if err != nil {
+					return nil, err
+				}
+				block.Blocks = append(block.Blocks, sub)
+			case tokEquals:
+				param, err := p.parseValues(t)
+				if err != nil {
+					return nil, err
+				}
+				block.Params = append(block.Params, param)
+			default:
+				return nil, fmt.Errorf("line %d: expected '=' or '{' after %s, got %s", op.line, t.val, op.typ)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %s in block %s", t.line, t.typ, name.val)
+		}
+	}
+}
+
+// parseValues parses a comma-separated list of values terminated by a
+// semicolon.  A missing semicolon before the end of the block is tolerated.
+func (p *parser) parseValues(name token) (*Param, error) {
+
+	param := &Param{Name: name.val, line: name.line}
+
+	for {
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.typ != tokWord && t.typ != tokString {
+			return nil, fmt.Errorf("line %d: expected value for %s, got %s", t.line, name.val, t.typ)
+		}
+		param.Values = append(param.Values, t.val)
+
+		sep, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch sep.typ {
+		case tokComma:
+			continue
+		case tokSemicolon:
+			return param, nil
+		case tokRBrace:
+			p.unread(sep)
+			return param, nil
+		default:
+			return nil, fmt.Errorf("line %d: expected ';' after value of %s, got %s", sep.line, name.val, sep.typ)
+		}
+	}
+}
+
+// decode converts the generic blocks parsed from a file into a Config.
+func decode(root *Block) (*Config, error) {
+
+	cfg := &Config{}
+
+	for _, block := range root.Blocks {
+		switch strings.ToUpper(block.Name) {
+		case "NFS_CORE_PARAM":
+			if cfg.Core != nil {
+				return nil, fmt.Errorf("line %d: NFS_Core_Param block defined more than once", block.line)
+			}
+			core, err := decodeCore(block)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Core = core
+		case "NFSV4":
+			if cfg.NFSv4 != nil {
+				return nil, fmt.Errorf("line %d: NFSV4 block defined more than once", block.line)
+			}
+			v4, err := decodeNFSv4(block)
+			if err != nil {
+				return nil, err
+			}
+			cfg.NFSv4 = v4
+		case "EXPORT":
+			export, err := decodeExport(block)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Exports = append(cfg.Exports, export)
+		default:
+			cfg.Blocks = append(cfg.Blocks, block)
+		}
+	}
+	return cfg, nil
+}
+
+func decodeCore(block *Block) (*CoreParam, error) {
+	core := &CoreParam{}
+	for _, param := range block.Params {
+		var err error
+		switch strings.ToUpper(param.Name) {
+		case "NFS_PROTOCOLS", "PROTOCOLS":
+			core.Protocols = param.Values
+		case "FSID_DEVICE":
+			core.FsidDevice, err = param.asBool()
+		default:
+			core.Params = append(core.Params, param)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(block.Blocks) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected block %s in %s", block.Blocks[0].line, block.Blocks[0].Name, block.Name)
+	}
+	return core, nil
+}
+
+func decodeNFSv4(block *Block) (*NFSv4, error) {
+	v4 := &NFSv4{}
+	for _, param := range block.Params {
+		var err error
+		switch strings.ToUpper(param.Name) {
+		case "GRACELESS":
+			v4.Graceless, err = param.asBool()
+		case "LEASE_LIFETIME":
+			v4.LeaseLifetime, err = param.asInt()
+		case "GRACE_PERIOD":
+			v4.GracePeriod, err = param.asInt()
+		case "RECOVERYBACKEND":
+			v4.RecoveryBackend, err = param.asString()
+		case "RECOVERYROOT":
+			v4.RecoveryRoot, err = param.asString()
+		default:
+			v4.Params = append(v4.Params, param)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(block.Blocks) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected block %s in %s", block.Blocks[0].line, block.Blocks[0].Name, block.Name)
+	}
+	return v4, nil
+}
+
+func decodeExport(block *Block) (*Export, error) {
+	export := &Export{line: block.line}
+	hasID := false
+	for _, param := range block.Params {
+		var err error
+		switch strings.ToUpper(param.Name) {
+		case "EXPORT_ID":
+			var id uint64
+			id, err = param.asUint(16)
+			export.ExportID = uint16(id)
+			hasID = true
+		case "PATH":
+			export.Path, err = param.asString()
+		case "PSEUDO":
+			export.Pseudo, err = param.asString()
+		case "TAG":
+			export.Tag, err = param.asString()
+		case "PROTOCOLS":
+			export.Protocols = param.Values
+		case "TRANSPORTS":
+			export.Transports = param.Values
+		case "ACCESS_TYPE":
+			export.AccessType, err = param.asString()
+		case "SQUASH":
+			export.Squash, err = param.asString()
+		case "SECTYPE":
+			export.SecType = param.Values
+		default:
+			export.Params = append(export.Params, param)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !hasID {
+		return nil, fmt.Errorf("line %d: EXPORT block is missing Export_Id", block.line)
+	}
+	for _, sub := range block.Blocks {
+		switch strings.ToUpper(sub.Name) {
+		case "FSAL":
+			if export.FSAL != nil {
+				return nil, fmt.Errorf("line %d: FSAL block defined more than once in export %d", sub.line, export.ExportID)
+			}
+			fsal, err := decodeFSAL(sub)
+			if err != nil {
+				return nil, err
+			}
+			export.FSAL = fsal
+		case "CLIENT":
+			client, err := decodeClient(sub)
+			if err != nil {
+				return nil, err
+			}
+			export.Clients = append(export.Clients, client)
+		default:
+			export.Blocks = append(export.Blocks, sub)
+		}
+	}
+	return export, nil
+}
+
+func decodeFSAL(block *Block) (*FSAL, error) {
+	fsal := &FSAL{Blocks: block.Blocks}
+	for _, param := range block.Params {
+		if strings.EqualFold(param.Name, "Name") {
+			name, err := param.asString()
+			if err != nil {
+				return nil, err
+			}
+			fsal.Name = name
+			continue
+		}
+		fsal.Params = append(fsal.Params, param)
+	}
+	return fsal, nil
+}
+
+func decodeClient(block *Block) (*Client, error) {
+	client := &Client{}
+	for _, param := range block.Params {
+		var err error
+		switch strings.ToUpper(param.Name) {
+		case "CLIENTS":
+			client.Clients = param.Values
+		case "ACCESS_TYPE":
+			client.AccessType, err = param.asString()
+		case "SQUASH":
+			client.Squash, err = param.asString()
+		default:
+			client.Params = append(client.Params, param)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(block.Blocks) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected block %s in %s", block.Blocks[0].line, block.Blocks[0].Name, block.Name)
+	}
+	return client, nil
+}
+
+// asString returns the value of a single-valued parameter.
+func (p *Param) asString() (string, error) {
+	if len(p.Values) != 1 {
+		return "", fmt.Errorf("line %d: %s must have a single value", p.line, p.Name)
+	}
+	return p.Values[0], nil
+}
+
+// asBool returns the value of a boolean parameter.  Ganesha accepts the same
+// spellings as strconv, plus yes/no and on/off.
+func (p *Param) asBool() (bool, error) {
+	s, err := p.asString()
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(s) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("line %d: %s must be true or false, got %q", p.line, p.Name, s)
+	}
+	return b, nil
+}
+
+// asInt returns the value of an integer parameter.
+func (p *Param) asInt() (int, error) {
+	s, err := p.asString()
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("line %d: %s must be a number, got %q", p.line, p.Name, s)
+	}
+	return i, nil
+}
+
+// asUint returns the value of an unsigned integer parameter of the given size.
+func (p *Param) asUint(bits int) (uint64, error) {
+	s, err := p.asString()
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseUint(s, 0, bits)
+	if err != nil {
+		return 0, fmt.Errorf("line %d: %s must be a number between 0 and %d, got %q", p.line, p.Name, uint64(1)<<uint(bits)-1, s)
+	}
+	return i, nil
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Defaults used when generating a Config from a Spec.
+const (
+	DefaultExportID   uint16 = 77
+	DefaultExportPath        = "/export"
+	DefaultPseudo            = "/"
+	DefaultAccessType        = "RW"
+	DefaultSquash            = "none"
+	DefaultFSAL              = "VFS"
+)
+
+// DefaultProtocols are the NFS protocols enabled when a Spec doesn't specify
+// any.  Only NFSv4 is supported by default since it does not require rpcbind.
+var DefaultProtocols = []string{"4"}
+
+// Spec is a declarative description of the exports to serve.  It is used to
+// generate a Config when no configuration file is provided.
+type Spec struct {
+	Protocols []string     `json:"protocols,omitempty" yaml:"protocols,omitempty"`
+	Exports   []ExportSpec `json:"exports" yaml:"exports"`
+}
+
+// ExportSpec describes a single export.
+//
+// If Clients is set, access is only granted to the listed clients, which may be
+// IP addresses, CIDR ranges, hostnames or wildcards.  Otherwise all clients are
+// granted access.
+type ExportSpec struct {
+	ID      uint16   `json:"id,omitempty" yaml:"id,omitempty"`
+	Path    string   `json:"path,omitempty" yaml:"path,omitempty"`
+	Pseudo  string   `json:"pseudo,omitempty" yaml:"pseudo,omitempty"`
+	Access  string   `json:"access,omitempty" yaml:"access,omitempty"`
+	Squash  string   `json:"squash,omitempty" yaml:"squash,omitempty"`
+	Clients []string `json:"clients,omitempty" yaml:"clients,omitempty"`
+}
+
+// LoadSpec reads a Spec from the file at path.  Files with a .yaml or .yml
+// extension are decoded as YAML, others as JSON.  Unknown fields are refused, so that
+// misspelt fields are not replaced by defaults.
+func LoadSpec(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := &Spec{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, spec)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return spec, nil
+}
+
+// Config generates a Config from the Spec, filling in defaults for unset
+// values.
+//
+// The generated Config has not been validated.
+func (s *Spec) Config() (*Config, error) {
+
+	if len(s.Exports) == 0 {
+		return nil, errors.New("spec must contain at least one export")
+	}
+
+	protocols := s.Protocols
+	if len(protocols) == 0 {
+		protocols = DefaultProtocols
+	}
+
+	cfg := &Config{
+		Core: &CoreParam{
+			Protocols:  protocols,
+			FsidDevice: true,
+		},
+		NFSv4: &NFSv4{
+			Graceless: true,
+		},
+	}
+
+	for i, es := range s.Exports {
+
+		export := &Export{
+			ExportID:   es.ID,
+			Path:       es.Path,
+			Pseudo:     es.Pseudo,
+			Protocols:  protocols,
+			Transports: []string{"TCP"},
+			AccessType: es.Access,
+			Squash:     es.Squash,
+			SecType:    []string{"sys"},
+			FSAL:       &FSAL{Name: DefaultFSAL},
+		}
+		if export.ExportID == 0 {
+			export.ExportID = DefaultExportID + uint16(i)
+		}
+		if export.Path == "" && len(s.Exports) == 1 {
+			export.Path = DefaultExportPath
+		}
+		if export.Pseudo == "" && len(s.Exports) == 1 {
+			export.Pseudo = DefaultPseudo
+		}
+		if export.AccessType == "" {
+			export.AccessType = DefaultAccessType
+		}
+		if export.Squash == "" {
+			export.Squash = DefaultSquash
+		}
+
+		// Restrict access to the listed clients by denying access at the
+		// export level and granting it in a CLIENT block.
+		if len(es.Clients) > 0 {
+			export.Clients = []*Client{
+				{
+					Clients:    es.Clients,
+					AccessType: export.AccessType,
+					Squash:     export.Squash,
+				},
+			}
+			export.AccessType = "None"
+		}
+
+		cfg.Exports = append(cfg.Exports, export)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Legal values for access settings.  Values are matched case-insensitively.
+var (
+	accessTypes = []string{"RW", "RO", "MDONLY", "MDONLY_RO", "None"}
+	squashTypes = []string{
+		"root", "root_squash", "rootsquash",
+		"root_id_squash", "rootidsquash", "root_id",
+		"all", "all_squash", "allsquash", "all_anonymous", "allanonymous",
+		"no_root_squash", "none", "noidsquash",
+	}
+	secTypes   = []string{"none", "sys", "krb5", "krb5i", "krb5p"}
+	transports = []string{"UDP", "TCP"}
+)
+
+// ValidationError lists all problems found in a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the configuration for errors that would prevent nfs-ganesha
+// from starting or from exporting a volume.  All problems found are returned
+// in a ValidationError.
+func (c *Config) Validate() error {
+
+	v := &validator{}
+
+	if c.Core != nil {
+		v.protocols("NFS_Core_Param", c.Core.Protocols)
+	}
+
+	ids := make(map[uint16]bool)
+	pseudos := make(map[string]uint16)
+
+	for _, e := range c.Exports {
+		name := fmt.Sprintf("export %d", e.ExportID)
+
+		if ids[e.ExportID] {
+			v.addf("%s: Export_Id must be unique", name)
+		}
+		ids[e.ExportID] = true
+
+		if e.Path == "" {
+			v.addf("%s: Path must be set", name)
+		}
+
+		if e.Pseudo == "" {
+			if supportsV4(e.Protocols) {
+				v.addf("%s: Pseudo must be set for NFSv4", name)
+			}
+		} else {
+			if !path.IsAbs(e.Pseudo) {
+				v.addf("%s: Pseudo must be an absolute path, got %q", name, e.Pseudo)
+			}
+			if other, ok := pseudos[e.Pseudo]; ok {
+				v.addf("%s: Pseudo %q is already used by export %d", name, e.Pseudo, other)
+			}
+			pseudos[e.Pseudo] = e.ExportID
+		}
+
+		v.protocols(name, e.Protocols)
+		v.oneOf(name, "Transports", transports, e.Transports...)
+		v.oneOf(name, "Access_Type", accessTypes, e.AccessType)
+		v.oneOf(name, "Squash", squashTypes, e.Squash)
+		v.oneOf(name, "SecType", secTypes, e.SecType...)
+
+		if e.FSAL == nil || e.FSAL.Name == "" {
+			v.addf("%s: FSAL block with Name must be set", name)
+		}
+
+		for i, client := range e.Clients {
+			cname := fmt.Sprintf("%s CLIENT %d", name, i+1)
+			if len(client.Clients) == 0 {
+				v.addf("%s: Clients must be set", cname)
+			}
+			v.oneOf(cname, "Access_Type", accessTypes, client.AccessType)
+			v.oneOf(cname, "Squash", squashTypes, client.Squash)
+		}
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// validator collects validation problems.
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// oneOf checks that each non-empty value is in legal.
+func (v *validator) oneOf(name string, param string, legal []string, values ...string) {
+	for _, val := range values {
+		if val == "" || contains(legal, val) {
+			continue
+		}
+		v.addf("%s: invalid %s %q, must be one of %s", name, param, val, strings.Join(legal, ", "))
+	}
+}
+
+// protocols checks that each protocol is recognised.
+func (v *validator) protocols(name string, protocols []string) {
+	for _, p := range protocols {
+		switch normaliseProtocol(p) {
+		case "3", "4", "9P":
+		default:
+			v.addf("%s: invalid protocol %q, must be one of 3, 4, 9P", name, p)
+		}
+	}
+}
+
+// contains returns true if s matches an item of list, ignoring case.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
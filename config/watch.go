@@ -0,0 +1,159 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchMask selects the inotify events that may change a watched file.  Files
+// mounted from a Kubernetes ConfigMap are symlinks into a data directory that
+// is replaced by renaming a symlink, so directories are watched rather than
+// the files themselves.
+const watchMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ATTRIB
+
+// watchSettle is how long events must stop for before the files are checked,
+// so that a change made in several steps is only reported once.
+const watchSettle = time.Second
+
+// Watcher reports changes to a configuration file and the files it includes.
+type Watcher struct {
+	path string
+
+	// files are the files making up the configuration, and sum is the hash of
+	// their contents when last checked.
+	files []string
+	sum   []byte
+}
+
+// NewWatcher returns a Watcher for the configuration file at path.
+func NewWatcher(path string) (*Watcher, error) {
+	_, files, err := LoadFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{
+		path:  path,
+		files: files,
+		sum:   checksum(files),
+	}, nil
+}
+
+// Run calls changed each time the content of the configuration changes, until
+// the context is cancelled.
+//
+// Included files are watched as they are added.  If the configuration can't
+// be read, the files last read continue to be watched.
+func (w *Watcher) Run(ctx context.Context, changed func()) error {
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+
+	// A non-blocking file uses the runtime poller, so reads are interrupted
+	// when the file is closed.
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer f.Close()
+
+	watches := make(map[string]int)
+	if err := w.watch(fd, watches); err != nil {
+		return err
+	}
+
+	events := make(chan struct{}, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		for {
+			if _, err := f.Read(buf); err != nil {
+				errCh <- err
+				return
+			}
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errCh:
+			return err
+		case <-events:
+			settle = time.After(watchSettle)
+		case <-settle:
+			settle = nil
+
+			// Follow changes to the included files.
+			if _, files, err := LoadFiles(w.path); err == nil {
+				w.files = files
+				if err := w.watch(fd, watches); err != nil {
+					return err
+				}
+			}
+
+			sum := checksum(w.files)
+			if string(sum) == string(w.sum) {
+				continue
+			}
+			w.sum = sum
+			changed()
+		}
+	}
+}
+
+// watch updates the inotify watches to cover the directories of the current
+// files.  watches maps each watched directory to its watch descriptor.
+func (w *Watcher) watch(fd int, watches map[string]int) error {
+
+	dirs := make(map[string]bool)
+	for _, file := range w.files {
+		dirs[filepath.Dir(file)] = true
+	}
+
+	for dir := range dirs {
+		if _, ok := watches[dir]; ok {
+			continue
+		}
+		wd, err := unix.InotifyAddWatch(fd, dir, watchMask)
+		if err != nil {
+			return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+		}
+		watches[dir] = wd
+	}
+	for dir, wd := range watches {
+		if dirs[dir] {
+			continue
+		}
+		// The directory may have been removed, in which case the watch has
+		// already gone.
+		unix.InotifyRmWatch(fd, uint32(wd))
+		delete(watches, dir)
+	}
+	return nil
+}
+
+// checksum returns a hash of the contents of files.  Files that can't be read
+// are hashed as empty.
+func checksum(files []string) []byte {
+	h := sha256.New()
+	for _, file := range files {
+		io.WriteString(h, file)
+		if f, err := os.Open(file); err == nil {
+			io.Copy(h, f)
+			f.Close()
+		}
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// WriteTo writes the configuration to w in nfs-ganesha format.
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+
+	cw := &configWriter{w: w}
+
+	for _, include := range c.Includes {
+		cw.line(0, "%s %s", includeDirective, quote(include))
+	}
+	if len(c.Includes) > 0 {
+		cw.line(0, "")
+	}
+
+	if c.Core != nil {
+		cw.open(0, "NFS_Core_Param")
+		if len(c.Core.Protocols) > 0 {
+			cw.param(1, "NFS_Protocols", c.Core.Protocols...)
+		}
+		if c.Core.FsidDevice {
+			cw.param(1, "fsid_device", "true")
+		}
+		cw.params(1, c.Core.Params)
+		cw.close(0)
+	}
+
+	if c.NFSv4 != nil {
+		cw.open(0, "NFSV4")
+		if c.NFSv4.Graceless {
+			cw.param(1, "Graceless", "true")
+		}
+		if c.NFSv4.LeaseLifetime != 0 {
+			cw.param(1, "Lease_Lifetime", strconv.Itoa(c.NFSv4.LeaseLifetime))
+		}
+		if c.NFSv4.GracePeriod != 0 {
+			cw.param(1, "Grace_Period", strconv.Itoa(c.NFSv4.GracePeriod))
+		}
+		if c.NFSv4.RecoveryBackend != "" {
+			cw.param(1, "RecoveryBackend", c.NFSv4.RecoveryBackend)
+		}
+		if c.NFSv4.RecoveryRoot != "" {
+			cw.param(1, "RecoveryRoot", c.NFSv4.RecoveryRoot)
+		}
+		cw.params(1, c.NFSv4.Params)
+		cw.close(0)
+	}
+
+	for _, export := range c.Exports {
+		export.write(cw, 0)
+	}
+
+	for _, block := range c.Blocks {
+		cw.block(0, block)
+	}
+
+	return cw.n, cw.err
+}
+
+// String returns the configuration in nfs-ganesha format.
+func (c *Config) String() string {
+	var buf bytes.Buffer
+	_, _ = c.WriteTo(&buf)
+	return buf.String()
+}
+
+// WriteFile writes the configuration to the file at path.  The file is
+// replaced atomically so that nfs-ganesha never reads a partial
+// configuration.
+func (c *Config) WriteFile(path string) error {
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := c.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// write writes the EXPORT block.
+func (e *Export) write(cw *configWriter, depth int) {
+	cw.open(depth, "EXPORT")
+	cw.param(depth+1, "Export_Id", strconv.Itoa(int(e.ExportID)))
+	if e.Path != "" {
+		cw.param(depth+1, "Path", e.Path)
+	}
+	if e.Pseudo != "" {
+		cw.param(depth+1, "Pseudo", e.Pseudo)
+	}
+	if e.Tag != "" {
+		cw.param(depth+1, "Tag", e.Tag)
+	}
+	if len(e.Protocols) > 0 {
+		cw.param(depth+1, "Protocols", e.Protocols...)
+	}
+	if len(e.Transports) > 0 {
+		cw.param(depth+1, "Transports", e.Transports...)
+	}
+	if e.AccessType != "" {
+		cw.param(depth+1, "Access_Type", e.AccessType)
+	}
+	if e.Squash != "" {
+		cw.param(depth+1, "Squash", e.Squash)
+	}
+	if len(e.SecType) > 0 {
+		cw.param(depth+1, "SecType", e.SecType...)
+	}
+	cw.params(depth+1, e.Params)
+
+	for _, client := range e.Clients {
+		cw.open(depth+1, "CLIENT")
+		if len(client.Clients) > 0 {
+			cw.param(depth+2, "Clients", client.Clients...)
+		}
+		if client.AccessType != "" {
+			cw.param(depth+2, "Access_Type", client.AccessType)
+		}
+		if client.Squash != "" {
+			cw.param(depth+2, "Squash", client.Squash)
+		}
+		cw.params(depth+2, client.Params)
+		cw.close(depth + 1)
+	}
+
+	if e.FSAL != nil {
+		cw.open(depth+1, "FSAL")
+		if e.FSAL.Name != "" {
+			cw.param(depth+2, "Name", e.FSAL.Name)
+		}
+		cw.params(depth+2, e.FSAL.Params)
+		for _, block := range e.FSAL.Blocks {
+			cw.block(depth+2, block)
+		}
+		cw.close(depth + 1)
+	}
+
+	for _, block := range e.Blocks {
+		cw.block(depth+1, block)
+	}
+	cw.close(depth)
+}
+
+// configWriter writes indented configuration lines, recording the first error
+// and the number of bytes written.
+type configWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *configWriter) line(depth int, format string, args ...interface{}) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, strings.Repeat("\t", depth)+format+"\n", args...)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+func (cw *configWriter) open(depth int, name string) {
+	cw.line(depth, "%s {", name)
+}
+
+func (cw *configWriter) close(depth int) {
+	cw.line(depth, "}")
+	if depth == 0 {
+		cw.line(0, "")
+	}
+}
+
+func (cw *configWriter) param(depth int, name string, values ...string) {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, quote(v))
+	}
+	cw.line(depth, "%s = %s;", name, strings.Join(quoted, ", "))
+}
+
+func (cw *configWriter) params(depth int, params []*Param) {
+	for _, p := range params {
+		cw.param(depth, p.Name, p.Values...)
+	}
+}
+
+func (cw *configWriter) block(depth int, b *Block) {
+	cw.open(depth, b.Name)
+	cw.params(depth+1, b.Params)
+	for _, sub := range b.Blocks {
+		cw.block(depth+1, sub)
+	}
+	cw.close(depth)
+}
+
+// quote returns v quoted if it can't be written as a bare word.  Quoted
+// strings have no escape sequences, so single quotes are used if v contains a
+// double quote.
+func quote(v string) string {
+	if v != "" && strings.IndexFunc(v, func(c rune) bool { return !isWordRune(c) }) < 0 {
+		return v
+	}
+	if strings.ContainsRune(v, '"') {
+		return "'" + v + "'"
+	}
+	return `"` + v + `"`
+}
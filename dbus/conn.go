@@ -0,0 +1,363 @@
+package dbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/storageos/nfs/logger"
+)
+
+const (
+	// reconnectMinBackoff and reconnectMaxBackoff bound the delay between
+	// attempts to connect to the system bus.
+	reconnectMinBackoff = 100 * time.Millisecond
+	reconnectMaxBackoff = 5 * time.Second
+
+	// signalBuffer is the number of signals held for forwarding.
+	signalBuffer = 16
+)
+
+// ErrDisconnected is returned by calls made while there is no connection to the
+// system bus.
+var ErrDisconnected = errors.New("dbus: not connected to the system bus")
+
+// Conn is a connection to the system bus that is re-established when it is
+// lost, for example when dbus-daemon is restarted.
+//
+// Signal matches and channels registered with Conn are carried over to each
+// new connection.  BusObjects returned by Object always use the current
+// connection, so they can be held for the life of the process.  Calls made
+// while disconnected fail with ErrDisconnected.
+type Conn struct {
+	log *logger.Logger
+
+	// dial opens a new, unauthenticated connection to the bus.
+	dial func() (*dbus.Conn, error)
+
+	// conn is the current connection, or nil while disconnected.  matches
+	// counts the callers of AddMatch for each rule, and signals holds the
+	// channels receiving signals.  They are protected by mu, which is not
+	// held during bus calls.
+	conn    *dbus.Conn
+	matches map[string]int
+	signals map[chan<- *dbus.Signal]bool
+	mu      *sync.Mutex
+
+	// matchMu is held while adding or removing matches on the bus, so that
+	// the matches on a connection follow the order of the changes.
+	matchMu *sync.Mutex
+}
+
+// NewConn returns a new Conn.  It is not connected until Run is called.
+func NewConn(log *logger.Logger) *Conn {
+	return &Conn{
+		log: log,
+		dial: func() (*dbus.Conn, error) {
+			return dbus.SystemBusPrivate()
+		},
+		matches: make(map[string]int),
+		signals: make(map[chan<- *dbus.Signal]bool),
+		mu:      &sync.Mutex{},
+		matchMu: &sync.Mutex{},
+	}
+}
+
+// Run connects to the system bus, reconnecting with backoff whenever the
+// connection is lost, until the context is cancelled.  The connection is then
+// closed.
+//
+// Run must only be called once.
+func (c *Conn) Run(ctx context.Context) error {
+
+	defer c.close()
+
+	backoff := reconnectMinBackoff
+	for {
+		lost, err := c.connect()
+		if err != nil {
+			c.log.Debugf("failed to connect to system bus, retrying in %s: %v", backoff, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > reconnectMaxBackoff {
+				backoff = reconnectMaxBackoff
+			}
+			continue
+		}
+		c.log.Infof("connected to system bus")
+		backoff = reconnectMinBackoff
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-lost:
+			c.log.Warnf("lost connection to system bus, reconnecting")
+		}
+	}
+}
+
+// IsReady returns true if connected to the system bus.
+func (c *Conn) IsReady(ctx context.Context) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// Object returns a handle to the object at path of the named destination.
+//
+// Matches added with the BusObject's AddMatchSignal only apply to the current
+// connection.  Use AddMatch for matches that must survive a reconnect.
+func (c *Conn) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	return &object{conn: c, dest: dest, path: path}
+}
+
+// AddMatch adds a signal match rule, e.g.
+// `type='signal',interface='org.ganesha.nfsd.admin'`.  The rule is added to
+// the current connection and to each new connection until it is removed by as
+// many calls to RemoveMatch.
+func (c *Conn) AddMatch(rule string) error {
+	c.matchMu.Lock()
+	defer c.matchMu.Unlock()
+
+	c.mu.Lock()
+	c.matches[rule]++
+	added, conn := c.matches[rule] == 1, c.conn
+	c.mu.Unlock()
+
+	if !added || conn == nil {
+		return nil
+	}
+	return conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule).Err
+}
+
+// RemoveMatch removes a signal match rule added with AddMatch.
+func (c *Conn) RemoveMatch(rule string) error {
+	c.matchMu.Lock()
+	defer c.matchMu.Unlock()
+
+	c.mu.Lock()
+	if c.matches[rule] == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	c.matches[rule]--
+	removed, conn := c.matches[rule] == 0, c.conn
+	if removed {
+		delete(c.matches, rule)
+	}
+	c.mu.Unlock()
+
+	if !removed || conn == nil {
+		return nil
+	}
+	return conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, rule).Err
+}
+
+// Signal registers a channel to receive the signals matched by all callers of
+// AddMatch, so receivers should filter by name.  Signals are discarded if the
+// channel is not ready, so it should be buffered.
+//
+// Unlike a godbus connection, the channel is not closed when the connection
+// is lost.
+func (c *Conn) Signal(ch chan<- *dbus.Signal) {
+	c.mu.Lock()
+	c.signals[ch] = true
+	c.mu.Unlock()
+}
+
+// RemoveSignal stops a channel receiving signals.
+func (c *Conn) RemoveSignal(ch chan<- *dbus.Signal) {
+	c.mu.Lock()
+	delete(c.signals, ch)
+	c.mu.Unlock()
+}
+
+// connect opens a new connection and restores the signal matches.  The
+// returned channel is closed when the connection is lost.
+func (c *Conn) connect() (<-chan struct{}, error) {
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// godbus closes the signal channels when the connection is lost, which is
+	// used to detect the disconnect.
+	in := make(chan *dbus.Signal, signalBuffer)
+	conn.Signal(in)
+
+	// The connection is only made current once the matches are restored.
+	// Matches can't change meanwhile, as matchMu is held.
+	c.matchMu.Lock()
+	defer c.matchMu.Unlock()
+
+	c.mu.Lock()
+	rules := make([]string, 0, len(c.matches))
+	for rule := range c.matches {
+		rules = append(rules, rule)
+	}
+	c.mu.Unlock()
+
+	for _, rule := range rules {
+		if err := conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule).Err; err != nil {
+			c.log.Warnf("failed to restore signal match %s: %v", rule, err)
+		}
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+
+	lost := make(chan struct{})
+	go c.forward(conn, in, lost)
+	return lost, nil
+}
+
+// forward sends the signals received on a connection to the registered
+// channels.  Once the connection is lost, it is cleared and lost is closed.
+func (c *Conn) forward(conn *dbus.Conn, in <-chan *dbus.Signal, lost chan<- struct{}) {
+
+	for sig := range in {
+		c.mu.Lock()
+		for ch := range c.signals {
+			select {
+			case ch <- sig:
+			default:
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.mu.Unlock()
+	close(lost)
+}
+
+// current returns the current connection, or nil while disconnected.
+func (c *Conn) current() *dbus.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+// close closes the current connection.
+func (c *Conn) close() {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// object is a BusObject that makes each call on the current connection.
+type object struct {
+	conn *Conn
+	dest string
+	path dbus.ObjectPath
+}
+
+// current returns the object on the current connection, or nil while
+// disconnected.
+func (o *object) current() dbus.BusObject {
+	conn := o.conn.current()
+	if conn == nil {
+		return nil
+	}
+	return conn.Object(o.dest, o.path)
+}
+
+// disconnected returns a failed call.  As with godbus, the call is sent to ch
+// if set.
+func (o *object) disconnected(method string, ch chan *dbus.Call, args []interface{}) *dbus.Call {
+	if ch == nil {
+		ch = make(chan *dbus.Call, 1)
+	}
+	call := &dbus.Call{
+		Destination: o.dest,
+		Path:        o.path,
+		Method:      method,
+		Args:        args,
+		Err:         ErrDisconnected,
+		Done:        ch,
+	}
+	select {
+	case ch <- call:
+	default:
+	}
+	return call
+}
+
+func (o *object) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	return o.CallWithContext(context.Background(), method, flags, args...)
+}
+
+func (o *object) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	obj := o.current()
+	if obj == nil {
+		return o.disconnected(method, nil, args)
+	}
+	return obj.CallWithContext(ctx, method, flags, args...)
+}
+
+func (o *object) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return o.GoWithContext(context.Background(), method, flags, ch, args...)
+}
+
+func (o *object) GoWithContext(ctx context.Context, method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	obj := o.current()
+	if obj == nil {
+		return o.disconnected(method, ch, args)
+	}
+	return obj.GoWithContext(ctx, method, flags, ch, args...)
+}
+
+func (o *object) AddMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	obj := o.current()
+	if obj == nil {
+		return o.disconnected("org.freedesktop.DBus.AddMatch", nil, nil)
+	}
+	return obj.AddMatchSignal(iface, member, options...)
+}
+
+func (o *object) RemoveMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	obj := o.current()
+	if obj == nil {
+		return o.disconnected("org.freedesktop.DBus.RemoveMatch", nil, nil)
+	}
+	return obj.RemoveMatchSignal(iface, member, options...)
+}
+
+func (o *object) GetProperty(p string) (dbus.Variant, error) {
+	obj := o.current()
+	if obj == nil {
+		return dbus.Variant{}, ErrDisconnected
+	}
+	return obj.GetProperty(p)
+}
+
+func (o *object) Destination() string {
+	return o.dest
+}
+
+func (o *object) Path() dbus.ObjectPath {
+	return o.path
+}
@@ -0,0 +1,208 @@
+package dbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func TestConnDisconnected(t *testing.T) {
+
+	c := NewConn(nil)
+	if c.IsReady(context.Background()) {
+		t.Error("IsReady() = true before Run")
+	}
+
+	obj := c.Object("org.ganesha.nfsd", "/org/ganesha/nfsd/ExportMgr")
+	if err := obj.Call("org.ganesha.nfsd.exportmgr.ShowExports", 0).Err; err != ErrDisconnected {
+		t.Errorf("Call() error = %v, want %v", err, ErrDisconnected)
+	}
+	if call := <-obj.Go("org.ganesha.nfsd.exportmgr.ShowExports", 0, nil).Done; call.Err != ErrDisconnected {
+		t.Errorf("Go() error = %v, want %v", call.Err, ErrDisconnected)
+	}
+	if _, err := obj.GetProperty("org.ganesha.nfsd.exportmgr.Version"); err != ErrDisconnected {
+		t.Errorf("GetProperty() error = %v, want %v", err, ErrDisconnected)
+	}
+}
+
+func TestConnMatches(t *testing.T) {
+
+	const rule = "type='signal',interface='org.ganesha.nfsd.admin'"
+
+	c := NewConn(nil)
+	for i := 0; i < 2; i++ {
+		if err := c.AddMatch(rule); err != nil {
+			t.Fatalf("AddMatch() error = %v", err)
+		}
+	}
+
+	// The rule is kept until every caller has removed it, so that it is
+	// restored on reconnect.
+	c.RemoveMatch(rule)
+	if got := c.matches[rule]; got != 1 {
+		t.Errorf("after one RemoveMatch, count = %d, want 1", got)
+	}
+	c.RemoveMatch(rule)
+	c.RemoveMatch(rule)
+	if _, ok := c.matches[rule]; ok {
+		t.Error("rule not removed")
+	}
+}
+
+// fakeBus is a minimal message bus.  It accepts any client, replies to every
+// method call, records the match rules added and sends signals on request.
+type fakeBus struct {
+	matches chan string
+
+	// conns holds the bus side of each connection, most recent last.  It is
+	// protected by mu.
+	conns []net.Conn
+	mu    sync.Mutex
+}
+
+// dial connects a client to the bus.
+func (b *fakeBus) dial() (*dbus.Conn, error) {
+	client, server := net.Pipe()
+	b.mu.Lock()
+	b.conns = append(b.conns, server)
+	b.mu.Unlock()
+	go b.serve(server)
+	return dbus.NewConn(client)
+}
+
+// current returns the bus side of the most recent connection.
+func (b *fakeBus) current() net.Conn {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conns[len(b.conns)-1]
+}
+
+func (b *fakeBus) serve(conn net.Conn) {
+	defer conn.Close()
+
+	in := bufio.NewReader(conn)
+	if _, err := in.ReadByte(); err != nil {
+		return
+	}
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case line == "AUTH\r\n":
+			conn.Write([]byte("REJECTED EXTERNAL\r\n"))
+		case strings.HasPrefix(line, "AUTH EXTERNAL"):
+			conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n"))
+		case line == "BEGIN\r\n":
+			b.serveMessages(conn, in)
+			return
+		default:
+			conn.Write([]byte("ERROR\r\n"))
+		}
+	}
+}
+
+func (b *fakeBus) serveMessages(conn net.Conn, in *bufio.Reader) {
+	for {
+		msg, err := dbus.DecodeMessage(in)
+		if err != nil {
+			return
+		}
+		if msg.Type != dbus.TypeMethodCall {
+			continue
+		}
+		reply := &dbus.Message{
+			Type:    dbus.TypeMethodReply,
+			Headers: map[dbus.HeaderField]dbus.Variant{dbus.FieldReplySerial: dbus.MakeVariant(msg.Serial())},
+		}
+		switch msg.Headers[dbus.FieldMember].Value() {
+		case "Hello":
+			reply.Body = []interface{}{":1.1"}
+			reply.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(reply.Body...))
+		case "AddMatch":
+			b.matches <- msg.Body[0].(string)
+		}
+		if err := reply.EncodeTo(conn, binary.LittleEndian); err != nil {
+			return
+		}
+	}
+}
+
+// signal sends a heartbeat signal on the most recent connection.
+func (b *fakeBus) signal(t *testing.T) {
+	t.Helper()
+	msg := &dbus.Message{
+		Type: dbus.TypeSignal,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldPath:      dbus.MakeVariant(dbus.ObjectPath("/org/ganesha/nfsd/admin")),
+			dbus.FieldInterface: dbus.MakeVariant("org.ganesha.nfsd.admin"),
+			dbus.FieldMember:    dbus.MakeVariant("heartbeat"),
+		},
+	}
+	if err := msg.EncodeTo(b.current(), binary.LittleEndian); err != nil {
+		t.Fatalf("failed to send signal: %v", err)
+	}
+}
+
+func TestConnReconnect(t *testing.T) {
+
+	const rule = "type='signal',interface='org.ganesha.nfsd.admin'"
+
+	bus := &fakeBus{matches: make(chan string, 4)}
+	c := NewConn(nil)
+	c.dial = bus.dial
+
+	if err := c.AddMatch(rule); err != nil {
+		t.Fatalf("AddMatch() error = %v", err)
+	}
+	signals := make(chan *dbus.Signal, 1)
+	c.Signal(signals)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	// The match is added on each connection, and signals are forwarded from
+	// it.
+	for i := 0; i < 2; i++ {
+		select {
+		case got := <-bus.matches:
+			if got != rule {
+				t.Errorf("match added = %q, want %q", got, rule)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("connection %d: match not added", i)
+		}
+		for !c.IsReady(ctx) {
+			time.Sleep(time.Millisecond)
+		}
+
+		bus.signal(t)
+		select {
+		case sig := <-signals:
+			if sig.Name != "org.ganesha.nfsd.admin.heartbeat" {
+				t.Errorf("signal = %s, want heartbeat", sig.Name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("connection %d: signal not forwarded", i)
+		}
+
+		// Drop the connection, as when dbus-daemon restarts.
+		if i == 0 {
+			bus.current().Close()
+		}
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"os/exec"
 
 	"github.com/godbus/dbus"
+	"github.com/storageos/nfs/logger"
+	"github.com/storageos/nfs/process"
 )
 
 const (
@@ -15,11 +17,14 @@ const (
 
 // DBus manages the DBus subsystem.
 type DBus struct {
-	cmd *exec.Cmd
+	cmd  *exec.Cmd
+	done chan struct{}
+	log  *logger.Logger
 }
 
-// New creates a new DBus instance which can be Run and Closed.
-func New() *DBus {
+// New creates a new DBus instance which can be Run and Closed.  Output from
+// dbus-daemon is written to the logger.
+func New(log *logger.Logger) *DBus {
 	return &DBus{
 		cmd: &exec.Cmd{
 			Path: dbusDaemon,
@@ -29,9 +34,11 @@ func New() *DBus {
 				"--nofork",
 				"--nopidfile",
 			},
-			Stdout: os.Stdout,
-			Stderr: os.Stderr,
+			Stdout: log.Writer(logger.Info),
+			Stderr: log.Writer(logger.Warn),
 		},
+		done: make(chan struct{}),
+		log:  log,
 	}
 }
 
@@ -56,6 +63,7 @@ func (d *DBus) Run() (<-chan error, error) {
 	errCh := make(chan error)
 	go func() {
 		err := d.cmd.Wait()
+		close(d.done)
 		if err != nil {
 			errCh <- err
 			return
@@ -66,13 +74,26 @@ func (d *DBus) Run() (<-chan error, error) {
 	return errCh, nil
 }
 
-// Close sends a SIGINT to the dbus-daemon process.
+// Close sends a SIGINT to the dbus-daemon process and waits for it to exit.
+// If it has not exited before the context expires, it is killed.
 //
 // Once the process has stopped, the channel returned from Run is closed.
 func (d *DBus) Close(ctx context.Context) {
-	if d.cmd != nil {
-		_ = d.cmd.Process.Signal(os.Interrupt)
+	if d.cmd == nil || d.cmd.Process == nil {
+		return
 	}
+	if err := process.Stop(ctx, d.cmd.Process, d.done, os.Interrupt); err != nil {
+		d.log.Warnf("dbus daemon did not stop cleanly: %v", err)
+	}
+}
+
+// Pid returns the pid of the dbus-daemon process, or 0 if it has not been
+// started.
+func (d *DBus) Pid() int {
+	if d.cmd == nil || d.cmd.Process == nil {
+		return 0
+	}
+	return d.cmd.Process.Pid
 }
 
 // IsReady returns true if the DBus is ready for operation.
@@ -111,8 +132,8 @@ func (d *DBus) prepare() error {
 			dbusUUIDGen,
 			"--ensure",
 		},
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
+		Stdout: d.log.Writer(logger.Info),
+		Stderr: d.log.Writer(logger.Warn),
 	}
 
 	return idgen.Run()
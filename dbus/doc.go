@@ -3,6 +3,10 @@
 //
 // It provides methods to Run, Close, and determine status with IsReady.
 //
+// Conn is a connection to the system bus shared by the clients of the DBus
+// process.  It reconnects when the connection is lost and restores signal
+// matches, so that the BusObjects it returns remain usable.
+//
 // DBus will fail to start if there is an existing unmanaged process running
 // that is bound to the system bus (/var/run/dbus/system_bus_socket).
 package dbus
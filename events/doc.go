@@ -0,0 +1,9 @@
+// Package events streams NFS client lifecycle events over HTTP.
+//
+// Events are sent as Server-Sent Events to clients that accept
+// `text/event-stream`, and as newline delimited JSON otherwise.  Recent events
+// are replayed when a stream starts, so that the clients connected at the time
+// of a failure can be found after the event.
+//
+// The stream is served with the admin endpoints, and requires the admin token.
+package events
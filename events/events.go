@@ -0,0 +1,97 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/storageos/nfs/ganesha"
+	"github.com/storageos/nfs/logger"
+)
+
+// clientEvents is a source of client events.  It is implemented by
+// *ganesha.ClientWatcher.
+type clientEvents interface {
+	Subscribe() (<-chan ganesha.ClientEvent, func())
+	Done() <-chan struct{}
+}
+
+// Events handles client event streams.
+type Events struct {
+	watcher clientEvents
+	log     *logger.Logger
+}
+
+// New creates a new Events instance.
+func New(watcher *ganesha.ClientWatcher, log *logger.Logger) *Events {
+	return newEvents(watcher, log)
+}
+
+func newEvents(watcher clientEvents, log *logger.Logger) *Events {
+	return &Events{
+		watcher: watcher,
+		log:     log,
+	}
+}
+
+// Handler returns an http handler for streaming client events.
+//
+// The stream is sent as Server-Sent Events if the request accepts
+// `text/event-stream` or sets `?format=sse`, otherwise as newline delimited
+// JSON.  The stream ends when the client disconnects or the watcher stops.
+//
+// Events include client addresses, so the handler must only be served to
+// authorized requests.
+func (e *Events) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		sse := r.URL.Query().Get("format") == "sse" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+		if sse {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		events, unsubscribe := e.watcher.Subscribe()
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-e.watcher.Done():
+				return
+			case event := <-events:
+				data, err := json.Marshal(event)
+				if err != nil {
+					e.log.Warnf("failed to encode client event: %v", err)
+					continue
+				}
+				if sse {
+					_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+				} else {
+					_, err = fmt.Fprintf(w, "%s\n", data)
+				}
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package events
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/storageos/nfs/ganesha"
+)
+
+// fakeClientEvents sends the events written to events, until done is closed.
+type fakeClientEvents struct {
+	events       chan ganesha.ClientEvent
+	done         chan struct{}
+	unsubscribed bool
+}
+
+func (f *fakeClientEvents) Subscribe() (<-chan ganesha.ClientEvent, func()) {
+	return f.events, func() { f.unsubscribed = true }
+}
+
+func (f *fakeClientEvents) Done() <-chan struct{} {
+	return f.done
+}
+
+func TestHandler(t *testing.T) {
+
+	at := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	events := []ganesha.ClientEvent{
+		{Type: ganesha.ClientConnected, Time: at, Client: "10.0.0.1", Protocols: []string{"NFSv42"}, LastActive: at},
+		{Type: ganesha.ClientGone, Time: at, Client: "10.0.0.1", LastActive: at},
+	}
+	connected := `{"type":"connected","time":"2020-01-02T15:04:05Z","client":"10.0.0.1","protocols":["NFSv42"],"last_active":"2020-01-02T15:04:05Z"}`
+	gone := `{"type":"gone","time":"2020-01-02T15:04:05Z","client":"10.0.0.1","last_active":"2020-01-02T15:04:05Z"}`
+
+	tests := []struct {
+		name            string
+		target          string
+		accept          string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "ndjson",
+			target:          "/events",
+			wantContentType: "application/x-ndjson",
+			wantBody:        connected + "\n" + gone + "\n",
+		},
+		{
+			name:            "sse accepted",
+			target:          "/events",
+			accept:          "text/event-stream",
+			wantContentType: "text/event-stream",
+			wantBody:        "event: connected\ndata: " + connected + "\n\nevent: gone\ndata: " + gone + "\n\n",
+		},
+		{
+			name:            "sse format",
+			target:          "/events?format=sse",
+			wantContentType: "text/event-stream",
+			wantBody:        "event: connected\ndata: " + connected + "\n\nevent: gone\ndata: " + gone + "\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			watcher := &fakeClientEvents{
+				events: make(chan ganesha.ClientEvent),
+				done:   make(chan struct{}),
+			}
+			e := newEvents(watcher, nil)
+
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			served := make(chan struct{})
+			go func() {
+				e.Handler().ServeHTTP(w, r)
+				close(served)
+			}()
+
+			// Each event is written before the next is received, and the
+			// stream ends once the watcher stops.
+			for _, event := range events {
+				watcher.events <- event
+			}
+			close(watcher.done)
+			select {
+			case <-served:
+			case <-time.After(5 * time.Second):
+				t.Fatal("stream did not end when the watcher stopped")
+			}
+
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if !watcher.unsubscribed {
+				t.Error("not unsubscribed when the stream ended")
+			}
+		})
+	}
+}
+
+func TestHandlerMethodNotAllowed(t *testing.T) {
+
+	e := newEvents(&fakeClientEvents{}, nil)
+	w := httptest.NewRecorder()
+	e.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/events", nil))
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
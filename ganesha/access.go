@@ -0,0 +1,195 @@
+package ganesha
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/storageos/nfs/config"
+)
+
+// exportApplier applies changed exports to the running server.  It is
+// implemented by *ExportMgr.
+type exportApplier interface {
+	ApplyExport(export *config.Export, path string) (string, error)
+}
+
+// clientRegistrar registers and removes clients.  It is implemented by
+// *ClientMgr.
+type clientRegistrar interface {
+	AddClient(id ClientID) error
+	RemoveClient(id ClientID) error
+}
+
+// AccessMgr controls client access to the running exports.
+//
+// Clients are denied by adding a CLIENT block with `Access_Type = None` before
+// any others in each export, and the changed exports are applied without
+// restarting the server.
+type AccessMgr struct {
+	exportMgr exportApplier
+	clientMgr clientRegistrar
+
+	// running holds the exports as they are running.  It is updated as
+	// clients are denied and allowed.
+	running *RunningConfig
+
+	// denied holds the clients denied with Deny, keyed by canonical address.
+	// It is protected by mu.
+	denied map[string]ClientID
+	mu     *sync.Mutex
+
+	// dir is where the changed export configs are written.  It must be
+	// readable by nfs-ganesha.
+	dir string
+}
+
+// NewAccessMgr returns a new AccessMgr for the running exports.
+func NewAccessMgr(exportMgr *ExportMgr, clientMgr *ClientMgr, running *RunningConfig, dir string) *AccessMgr {
+	return newAccessMgr(exportMgr, clientMgr, running, dir)
+}
+
+func newAccessMgr(exportMgr exportApplier, clientMgr clientRegistrar, running *RunningConfig, dir string) *AccessMgr {
+	return &AccessMgr{
+		exportMgr: exportMgr,
+		clientMgr: clientMgr,
+		running:   running,
+		denied:    make(map[string]ClientID),
+		mu:        &sync.Mutex{},
+		dir:       dir,
+	}
+}
+
+// Deny prevents the client from accessing any export.  Existing connections
+// are refused on their next request.
+//
+// A denied NFSv4 client can't renew its lease, so its opens and locks are
+// released once the lease expires.  The client is only recorded as denied, and
+// kept denied when the exports are replaced, if every export was updated.
+func (a *AccessMgr) Deny(id ClientID) error {
+	return a.running.Update(func(cfg *config.Config) error {
+		err := a.update(cfg, func(export *config.Export) *config.Export {
+			return denyClient(export, id)
+		})
+		if err != nil {
+			return err
+		}
+		a.mu.Lock()
+		a.denied[id.String()] = id
+		a.mu.Unlock()
+		return nil
+	})
+}
+
+// Evict denies the client and removes it and its state from Ganesha, so that
+// it can neither reconnect nor keep its opens and locks.
+//
+// Ganesha refuses to remove an NFSv4 client that holds state within its
+// lease.  The denial remains in place and the error is returned, and the
+// client's state is released once its lease expires.
+func (a *AccessMgr) Evict(id ClientID) error {
+	if err := a.Deny(id); err != nil {
+		return err
+	}
+	if err := a.clientMgr.RemoveClient(id); err != nil {
+		return fmt.Errorf("client denied but not removed: %v", err)
+	}
+	return nil
+}
+
+// Allow removes a client denial made by Deny and registers the client with
+// Ganesha again.
+func (a *AccessMgr) Allow(id ClientID) error {
+	err := a.running.Update(func(cfg *config.Config) error {
+		a.mu.Lock()
+		delete(a.denied, id.String())
+		a.mu.Unlock()
+
+		return a.update(cfg, func(export *config.Export) *config.Export {
+			i := deniedAt(export, id)
+			if i < 0 {
+				return nil
+			}
+			allowed := export.Copy()
+			allowed.Clients = append(allowed.Clients[:i], allowed.Clients[i+1:]...)
+			return allowed
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return a.clientMgr.AddClient(id)
+}
+
+// restore denies the clients denied with Deny access to the exports in cfg,
+// for example once a changed configuration file has been applied.  It must be
+// called with the running configuration held, as cfg.
+func (a *AccessMgr) restore(cfg *config.Config) error {
+
+	err := a.update(cfg, func(export *config.Export) *config.Export {
+		if denied := a.denyAll(export); denied != export {
+			return denied
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to deny clients: %v", err)
+	}
+	return nil
+}
+
+// denyAll returns a copy of the export denying each client denied with Deny,
+// or the export itself if they are all already denied.
+func (a *AccessMgr) denyAll(export *config.Export) *config.Export {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, id := range a.denied {
+		if denied := denyClient(export, id); denied != nil {
+			export = denied
+		}
+	}
+	return export
+}
+
+// update applies fn to each export in cfg, applying and recording the exports
+// that fn returns.  fn returns nil if the export is unchanged.
+func (a *AccessMgr) update(cfg *config.Config, fn func(export *config.Export) *config.Export) error {
+	for i, export := range cfg.Exports {
+		changed := fn(export)
+		if changed == nil {
+			continue
+		}
+		path := filepath.Join(a.dir, fmt.Sprintf("access-%d.conf", export.ExportID))
+		if _, err := a.exportMgr.ApplyExport(changed, path); err != nil {
+			return fmt.Errorf("export %d: %v", export.ExportID, err)
+		}
+		cfg.Exports[i] = changed
+	}
+	return nil
+}
+
+// denyClient returns a copy of the export with a CLIENT block denying the
+// client before any others, or nil if the client is already denied.
+func denyClient(export *config.Export, id ClientID) *config.Export {
+	if deniedAt(export, id) >= 0 {
+		return nil
+	}
+	denied := export.Copy()
+	denied.Clients = append([]*config.Client{{
+		Clients:    []string{id.String()},
+		AccessType: "None",
+	}}, denied.Clients...)
+	return denied
+}
+
+// deniedAt returns the index of the CLIENT block denying the client added by
+// Deny, or -1 if not found.
+func deniedAt(export *config.Export, id ClientID) int {
+	for i, client := range export.Clients {
+		if client.AccessType == "None" && len(client.Clients) == 1 && client.Clients[0] == id.String() {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,238 @@
+package ganesha
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/storageos/nfs/config"
+)
+
+// fakeApplier records the exports applied, failing for Export_Ids in errs.
+type fakeApplier struct {
+	applied []*config.Export
+	errs    map[uint16]error
+}
+
+func (f *fakeApplier) ApplyExport(export *config.Export, path string) (string, error) {
+	if err := f.errs[export.ExportID]; err != nil {
+		return "", err
+	}
+	f.applied = append(f.applied, export)
+	return "", nil
+}
+
+// fakeRegistrar records the clients added and removed.  Removing a client
+// fails with removeErr if set.
+type fakeRegistrar struct {
+	added     []string
+	removed   []string
+	removeErr error
+}
+
+func (f *fakeRegistrar) AddClient(id ClientID) error {
+	f.added = append(f.added, id.String())
+	return nil
+}
+
+func (f *fakeRegistrar) RemoveClient(id ClientID) error {
+	f.removed = append(f.removed, id.String())
+	return f.removeErr
+}
+
+func testAccessConfig() *config.Config {
+	return &config.Config{
+		Exports: []*config.Export{
+			{ExportID: 1, Path: "/export/1", Clients: []*config.Client{{Clients: []string{"*"}, AccessType: "RW"}}},
+			{ExportID: 2, Path: "/export/2"},
+		},
+	}
+}
+
+// clientBlocks returns the clients and access of each CLIENT block by export.
+func clientBlocks(cfg *config.Config) map[uint16][]string {
+	out := make(map[uint16][]string)
+	for _, export := range cfg.Exports {
+		blocks := []string{}
+		for _, client := range export.Clients {
+			for _, c := range client.Clients {
+				blocks = append(blocks, c+"="+client.AccessType)
+			}
+		}
+		out[export.ExportID] = blocks
+	}
+	return out
+}
+
+func mustParseClientID(t *testing.T, s string) ClientID {
+	t.Helper()
+	id, err := ParseClientID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestDeniedAt(t *testing.T) {
+
+	id := mustParseClientID(t, "::ffff:10.0.0.1")
+
+	tests := []struct {
+		name    string
+		clients []*config.Client
+		want    int
+	}{
+		{name: "no clients", want: -1},
+		{name: "denied", clients: []*config.Client{{Clients: []string{"10.0.0.1"}, AccessType: "None"}}, want: 0},
+		{name: "denied after others", clients: []*config.Client{{Clients: []string{"*"}, AccessType: "RW"}, {Clients: []string{"10.0.0.1"}, AccessType: "None"}}, want: 1},
+		{name: "allowed", clients: []*config.Client{{Clients: []string{"10.0.0.1"}, AccessType: "RW"}}, want: -1},
+		{name: "other client", clients: []*config.Client{{Clients: []string{"10.0.0.2"}, AccessType: "None"}}, want: -1},
+		{name: "shared block", clients: []*config.Client{{Clients: []string{"10.0.0.1", "10.0.0.2"}, AccessType: "None"}}, want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export := &config.Export{ExportID: 1, Clients: tt.clients}
+			if got := deniedAt(export, id); got != tt.want {
+				t.Errorf("deniedAt() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessMgr(t *testing.T) {
+
+	id := mustParseClientID(t, "::ffff:10.0.0.1")
+
+	exports := &fakeApplier{}
+	clients := &fakeRegistrar{}
+	running := NewRunningConfig(testAccessConfig())
+	a := newAccessMgr(exports, clients, running, t.Name())
+
+	// Denying adds a block before the others, once.
+	for i := 0; i < 2; i++ {
+		if err := a.Deny(id); err != nil {
+			t.Fatalf("Deny() error = %v", err)
+		}
+	}
+	want := map[uint16][]string{
+		1: {"10.0.0.1=None", "*=RW"},
+		2: {"10.0.0.1=None"},
+	}
+	if got := clientBlocks(running.Get()); !reflect.DeepEqual(got, want) {
+		t.Errorf("after Deny() clients = %v, want %v", got, want)
+	}
+	if len(exports.applied) != 2 {
+		t.Errorf("Deny() applied %d exports, want 2", len(exports.applied))
+	}
+
+	// Denied clients stay denied when the exports are replaced.
+	reloaded := testAccessConfig()
+	reloaded.Exports = append(reloaded.Exports, &config.Export{ExportID: 3, Path: "/export/3"})
+	err := running.Update(func(cfg *config.Config) error {
+		cfg.Exports = append([]*config.Export(nil), reloaded.Exports...)
+		return a.restore(cfg)
+	})
+	if err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+	want[3] = []string{"10.0.0.1=None"}
+	if got := clientBlocks(running.Get()); !reflect.DeepEqual(got, want) {
+		t.Errorf("after restore() clients = %v, want %v", got, want)
+	}
+	if got := clientBlocks(reloaded)[1]; !reflect.DeepEqual(got, []string{"*=RW"}) {
+		t.Errorf("restore() changed the exports it was given: %v", got)
+	}
+
+	// Allowing removes the block and registers the client again.
+	exports.applied = nil
+	if err := a.Allow(id); err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	want = map[uint16][]string{
+		1: {"*=RW"},
+		2: {},
+		3: {},
+	}
+	if got := clientBlocks(running.Get()); !reflect.DeepEqual(got, want) {
+		t.Errorf("after Allow() clients = %v, want %v", got, want)
+	}
+	if len(exports.applied) != 3 {
+		t.Errorf("Allow() applied %d exports, want 3", len(exports.applied))
+	}
+	if !reflect.DeepEqual(clients.added, []string{"10.0.0.1"}) {
+		t.Errorf("clients added = %v, want [10.0.0.1]", clients.added)
+	}
+}
+
+func TestAccessMgrApplyError(t *testing.T) {
+
+	id := mustParseClientID(t, "10.0.0.1")
+
+	exports := &fakeApplier{errs: map[uint16]error{2: errors.New("failed")}}
+	running := NewRunningConfig(testAccessConfig())
+	a := newAccessMgr(exports, &fakeRegistrar{}, running, t.Name())
+
+	if err := a.Deny(id); err == nil {
+		t.Fatal("Deny() error = nil, want error")
+	}
+
+	// Only the exports that were applied are recorded.
+	want := map[uint16][]string{
+		1: {"10.0.0.1=None", "*=RW"},
+		2: {},
+	}
+	if got := clientBlocks(running.Get()); !reflect.DeepEqual(got, want) {
+		t.Errorf("clients = %v, want %v", got, want)
+	}
+
+	// The client is not recorded as denied, so is not denied access to
+	// replaced exports.
+	err := running.Update(func(cfg *config.Config) error {
+		cfg.Exports = testAccessConfig().Exports[:1]
+		return a.restore(cfg)
+	})
+	if err != nil {
+		t.Fatalf("restore() error = %v", err)
+	}
+	want = map[uint16][]string{1: {"*=RW"}}
+	if got := clientBlocks(running.Get()); !reflect.DeepEqual(got, want) {
+		t.Errorf("after restore() clients = %v, want %v", got, want)
+	}
+}
+
+func TestAccessMgrEvict(t *testing.T) {
+
+	id := mustParseClientID(t, "10.0.0.1")
+
+	tests := []struct {
+		name      string
+		removeErr error
+		wantErr   bool
+	}{
+		{name: "removed"},
+		{name: "holds state", removeErr: errors.New("client has state"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients := &fakeRegistrar{removeErr: tt.removeErr}
+			running := NewRunningConfig(testAccessConfig())
+			a := newAccessMgr(&fakeApplier{}, clients, running, t.Name())
+
+			if err := a.Evict(id); (err != nil) != tt.wantErr {
+				t.Errorf("Evict() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(clients.removed, []string{"10.0.0.1"}) {
+				t.Errorf("clients removed = %v, want [10.0.0.1]", clients.removed)
+			}
+
+			// The client stays denied even if it could not be removed.
+			want := map[uint16][]string{
+				1: {"10.0.0.1=None", "*=RW"},
+				2: {"10.0.0.1=None"},
+			}
+			if got := clientBlocks(running.Get()); !reflect.DeepEqual(got, want) {
+				t.Errorf("clients = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -2,14 +2,17 @@ package ganesha
 
 import (
 	"context"
+	"errors"
 	"sync"
 
 	"github.com/godbus/dbus"
+	nfsdbus "github.com/storageos/nfs/dbus"
 )
 
 // AdminMgr is a handle to Ganesha's management interface.
 type AdminMgr struct {
-	conn *dbus.Conn
+	conn       *nfsdbus.Conn
+	dbusObject dbus.BusObject
 
 	// statusCh receives status updates from DBus.
 	statusCh chan *dbus.Signal
@@ -24,22 +27,24 @@ type AdminMgr struct {
 // NewAdminMgr creates a new AdminMgr for interacting with Ganesha's management
 // interface.
 //
-// Requires system DBus, which must be running.  Ganesha does not have to have
-// registered yet.
-func NewAdminMgr() (*AdminMgr, error) {
-	conn, err := dbus.SystemBus()
-	if err != nil {
-		return nil, err
-	}
+// Calls are made on the shared system bus connection.  Neither DBus nor
+// Ganesha have to be running yet.
+func NewAdminMgr(conn *nfsdbus.Conn) *AdminMgr {
 	return &AdminMgr{
-		conn:           conn,
-		statusCh:       make(chan *dbus.Signal),
+		conn: conn,
+		dbusObject: conn.Object(
+			"org.ganesha.nfsd",
+			"/org/ganesha/nfsd/admin",
+		),
+		statusCh:       make(chan *dbus.Signal, 1),
 		statusWatchers: make(map[chan bool]chan error),
 		mu:             &sync.RWMutex{},
-	}, nil
+	}
 }
 
-// AddStatusWatcher registers a status update subscriber channel.
+// AddStatusWatcher registers a status update subscriber channel.  Updates and
+// errors are discarded if the watcher's channel is not ready, so the channels
+// should be buffered.
 func (mgr *AdminMgr) AddStatusWatcher(ctx context.Context, statusCh chan bool, errCh chan error) {
 	mgr.mu.Lock()
 	mgr.statusWatchers[statusCh] = errCh
@@ -69,38 +74,114 @@ func (mgr *AdminMgr) MonitorStatus(ctx context.Context) error {
 	// Match events with this signature.
 	match := "type='signal',path='/org/ganesha/nfsd/heartbeat',interface='org.ganesha.nfsd.admin',member='heartbeat'"
 
-	// Create DBus signal matcher for nfsd heartbeats.
-	mgr.conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, match)
+	// Create DBus signal matcher for nfsd heartbeats.  The match is restored
+	// whenever the connection is re-established.
+	mgr.conn.AddMatch(match)
 
 	// Send status signals to statusCh
 	mgr.conn.Signal(mgr.statusCh)
+	defer mgr.conn.RemoveSignal(mgr.statusCh)
 
 	for {
 		select {
 		case <-ctx.Done():
 
 			// Unregister DBus signal matcher.
-			mgr.conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, match)
+			mgr.conn.RemoveMatch(match)
 
 			// Send error to all watchers.
 			mgr.mu.RLock()
 			for _, watcherErrCh := range mgr.statusWatchers {
-				watcherErrCh <- ctx.Err()
+				select {
+				case watcherErrCh <- ctx.Err():
+				default:
+				}
 			}
 			mgr.mu.RUnlock()
 
 			return ctx.Err()
 		case hb := <-mgr.statusCh:
 
-			status := hb.Body[0].(bool)
+			// Signals from all matches on the connection are delivered.
+			if hb.Name != "org.ganesha.nfsd.admin.heartbeat" || len(hb.Body) == 0 {
+				continue
+			}
+			status, ok := hb.Body[0].(bool)
+			if !ok {
+				continue
+			}
 
-			// Send status to all watchers.
+			// Send status to all watchers.  Sends must not block, as watchers
+			// take the lock to remove themselves once they stop receiving.
 			mgr.mu.RLock()
 			for watcherStatusCh := range mgr.statusWatchers {
-				watcherStatusCh <- status
+				select {
+				case watcherStatusCh <- status:
+				default:
+				}
 			}
 			mgr.mu.RUnlock()
 		}
 	}
 
 }
+
+// StartGrace puts the server into its NFSv4 grace period, during which clients
+// may reclaim the opens and locks they held but no new state is granted.
+//
+// If ip is set, clients of that address are allowed to reclaim, as when the
+// address has been taken over from another server.  Otherwise grace is started
+// for the clients in the server's own recovery database.
+//
+// Ganesha has no method to end grace.  It ends once Grace_Period has passed,
+// or earlier once all known clients have reclaimed.  Grace is never started
+// while the server is configured with `Graceless = true`.
+func (mgr *AdminMgr) StartGrace(ip string) error {
+
+	// 0 starts grace without taking over an address.  An address without an
+	// event number is taken over.
+	event := graceEventJustGrace + ":"
+	if ip != "" {
+		event = ip
+	}
+	return mgr.grace(event)
+}
+
+// ReleaseIP releases the NFSv4 state of the clients of ip, as when the address
+// is being moved to another server.  It ends a takeover started with
+// StartGrace(ip), so that the server now holding the address can grant the
+// state to the clients reclaiming it in its own grace period.
+func (mgr *AdminMgr) ReleaseIP(ip string) error {
+	if ip == "" {
+		return errors.New("address required")
+	}
+	return mgr.grace(graceEventReleaseIP + ":" + ip)
+}
+
+// Grace event numbers, as defined by Ganesha's recovery interface.
+const (
+	graceEventJustGrace = "0"
+	graceEventReleaseIP = "2"
+)
+
+// grace sends a grace event, given as `<event number>:<argument>`.
+func (mgr *AdminMgr) grace(event string) error {
+	var ok bool
+	var msg string
+	if err := mgr.dbusObject.Call("org.ganesha.nfsd.admin.grace", 0, event).Store(&ok, &msg); err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// InGrace returns true if the server is in its NFSv4 grace period.
+func (mgr *AdminMgr) InGrace() (bool, error) {
+	var inGrace bool
+	if err := mgr.dbusObject.Call("org.ganesha.nfsd.admin.get_grace", 0).Store(&inGrace); err != nil {
+		return false, err
+	}
+	return inGrace, nil
+}
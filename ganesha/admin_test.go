@@ -0,0 +1,55 @@
+package ganesha
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	nfsdbus "github.com/storageos/nfs/dbus"
+)
+
+func TestMonitorStatus(t *testing.T) {
+
+	mgr := NewAdminMgr(nfsdbus.NewConn(nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- mgr.MonitorStatus(ctx) }()
+
+	// A watcher that has stopped receiving must not block the others, or
+	// its own removal.
+	stalled := make(chan bool)
+	mgr.AddStatusWatcher(ctx, stalled, make(chan error))
+	statusCh := make(chan bool, 1)
+	errCh := make(chan error, 1)
+	mgr.AddStatusWatcher(ctx, statusCh, errCh)
+
+	mgr.statusCh <- &dbus.Signal{Name: "org.ganesha.nfsd.admin.heartbeat", Body: []interface{}{true}}
+	select {
+	case ok := <-statusCh:
+		if !ok {
+			t.Error("status = false, want true")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("status not received")
+	}
+
+	removed := make(chan struct{})
+	go func() {
+		mgr.RemoveStatusWatcher(ctx, stalled)
+		close(removed)
+	}()
+	select {
+	case <-removed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RemoveStatusWatcher() blocked")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("MonitorStatus() error = %v, want %v", err, context.Canceled)
+	}
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("watcher error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,59 @@
+package ganesha
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// ClientID identifies an NFS client.
+//
+// Ganesha reports clients in the form of their connection, which is often an
+// IPv4-mapped IPv6 address such as `::ffff:172.17.0.1`.  ClientID keeps the
+// original form, used when calling Ganesha, alongside the parsed address so
+// that the same client is always presented the same way.
+type ClientID struct {
+	// IP is the client address, or nil if Orig is a hostname.
+	IP net.IP
+
+	// Orig is the form the client was given in.
+	Orig string
+
+	// reported is true if Orig is the form reported by Ganesha.
+	reported bool
+}
+
+// ParseClientID parses an IPv4 or IPv6 address, including IPv4-mapped IPv6
+// addresses, or a hostname.  Hostnames are not resolved.
+func ParseClientID(s string) (ClientID, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ClientID{}, errors.New("client must be an address or hostname")
+	}
+	id := ClientID{Orig: s}
+	if ip := net.ParseIP(s); ip != nil {
+		id.IP = ip
+		if v4 := ip.To4(); v4 != nil {
+			id.IP = v4
+		}
+	}
+	return id, nil
+}
+
+// String returns the canonical form of the client: IPv4 and IPv4-mapped IPv6
+// addresses in dotted decimal form, IPv6 addresses in their standard form and
+// hostnames in lower case.
+func (c ClientID) String() string {
+	if c.IP != nil {
+		return c.IP.String()
+	}
+	return strings.ToLower(c.Orig)
+}
+
+// Equal returns true if c and other are the same client.
+func (c ClientID) Equal(other ClientID) bool {
+	if c.IP != nil && other.IP != nil {
+		return c.IP.Equal(other.IP)
+	}
+	return c.String() == other.String()
+}
@@ -0,0 +1,42 @@
+package ganesha
+
+import "testing"
+
+func TestParseClientID(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantIP  bool
+		wantErr bool
+	}{
+		{in: "10.0.0.1", want: "10.0.0.1", wantIP: true},
+		{in: "::ffff:10.0.0.1", want: "10.0.0.1", wantIP: true},
+		{in: "::FFFF:10.0.0.1", want: "10.0.0.1", wantIP: true},
+		{in: "fd00::0001", want: "fd00::1", wantIP: true},
+		{in: " Client-1.Example.com ", want: "client-1.example.com"},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseClientID(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseClientID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseClientID().String() = %q, want %q", got.String(), tt.want)
+			}
+			if (got.IP != nil) != tt.wantIP {
+				t.Errorf("ParseClientID().IP = %v, want set %v", got.IP, tt.wantIP)
+			}
+		})
+	}
+
+	a, _ := ParseClientID("::ffff:10.0.0.1")
+	b, _ := ParseClientID("10.0.0.1")
+	if !a.Equal(b) {
+		t.Errorf("%v.Equal(%v) = false, want true", a, b)
+	}
+}
@@ -1,22 +1,41 @@
 package ganesha
 
 import (
+	"errors"
+	"fmt"
+	"net"
+
 	"github.com/godbus/dbus"
+	nfsdbus "github.com/storageos/nfs/dbus"
 	"golang.org/x/sys/unix"
 )
 
 // Client Structure of the output of ShowClients dbus call.
 //
-// The Client field is the internal reference for the connection, typically
-// `::ffff:172.17.0.1`.
+// The Client field identifies the connection.  Ganesha's internal reference,
+// typically `::ffff:172.17.0.1`, is kept in Client.Orig.
 //
 // Whenever client traffic for a protocol is detected, the corresponding field
 // for the protocol will be set to true.  When a client has multiple mounts
 // using different protocols, or a single export has been remounted using a
 // different protocol, mutiple protocols will be set to true for the client.
 //
-// LastTime is the timestamp when the response was generated.
+// LastTime is the timestamp of the last recorded activity from the client.
 type Client struct {
+	Client   ClientID
+	NFSv3    bool
+	MNTv3    bool
+	NLMv4    bool
+	RQUOTA   bool
+	NFSv40   bool
+	NFSv41   bool
+	NFSv42   bool
+	Plan9    bool
+	LastTime unix.Timespec
+}
+
+// rawClient is a client as returned by the ShowClients dbus call.
+type rawClient struct {
 	Client   string
 	NFSv3    bool
 	MNTv3    bool
@@ -29,67 +48,317 @@ type Client struct {
 	LastTime unix.Timespec
 }
 
+// ClientStatsFamily is a family of per-client stats.  Support for each family
+// depends on the Ganesha version.
+type ClientStatsFamily string
+
+// Client stats families.
+const (
+	ClientStatsNFSv3  ClientStatsFamily = "nfsv3"
+	ClientStatsNFSv40 ClientStatsFamily = "nfsv40"
+	ClientStatsNFSv41 ClientStatsFamily = "nfsv41"
+	ClientStatsNFSv42 ClientStatsFamily = "nfsv42"
+	ClientStatsNLM    ClientStatsFamily = "nlm"
+	ClientStatsMNT    ClientStatsFamily = "mnt"
+	ClientStatsAllOps ClientStatsFamily = "allops"
+)
+
+// clientStatsMethods maps the client stats families to their DBus methods.
+var clientStatsMethods = map[ClientStatsFamily]string{
+	ClientStatsNFSv3:  "org.ganesha.nfsd.clientstats.GetNFSv3IO",
+	ClientStatsNFSv40: "org.ganesha.nfsd.clientstats.GetNFSv40IO",
+	ClientStatsNFSv41: "org.ganesha.nfsd.clientstats.GetNFSv41IO",
+	ClientStatsNFSv42: "org.ganesha.nfsd.clientstats.GetNFSv42IO",
+	ClientStatsNLM:    "org.ganesha.nfsd.clientstats.GetNLMIO",
+	ClientStatsMNT:    "org.ganesha.nfsd.clientstats.GetMNTIO",
+	ClientStatsAllOps: "org.ganesha.nfsd.clientstats.GetClientAllops",
+}
+
 // ClientMgr is a handle to Ganesha's ClientMgr DBus object.
 //
 // It's main purpose it to list clients and to retrieve per-client connection
-// statistics.
+// statistics.  Clients may be given as returned by ShowClients, or parsed from
+// any IPv4 or IPv6 address or hostname with ParseClientID.
 type ClientMgr struct {
 	dbusObject dbus.BusObject
 }
 
-// NewClientMgr returns a new ClientMgr.
-func NewClientMgr() (*ClientMgr, error) {
-	conn, err := dbus.SystemBus()
-	if err != nil {
-		return nil, err
-	}
+// NewClientMgr returns a new ClientMgr using the shared system bus connection.
+func NewClientMgr(conn *nfsdbus.Conn) *ClientMgr {
 	return &ClientMgr{
 		dbusObject: conn.Object(
 			"org.ganesha.nfsd",
 			"/org/ganesha/nfsd/ClientMgr",
 		),
-	}, nil
+	}
 }
 
 // ShowClients returns Ganesha's list of client connections since the server was
 // started.
 func (mgr *ClientMgr) ShowClients() ([]Client, error) {
 
-	var clients []Client
+	var raw []rawClient
 	utime := unix.Timespec{}
 
-	if err := mgr.dbusObject.Call("org.ganesha.nfsd.clientmgr.ShowClients", 0).Store(&utime, &clients); err != nil {
+	if err := mgr.dbusObject.Call("org.ganesha.nfsd.clientmgr.ShowClients", 0).Store(&utime, &raw); err != nil {
 		return nil, err
 	}
+
+	clients := make([]Client, 0, len(raw))
+	for _, rc := range raw {
+		id, err := ParseClientID(rc.Client)
+		if err != nil {
+			continue
+		}
+		id.reported = true
+		clients = append(clients, Client{
+			Client:   id,
+			NFSv3:    rc.NFSv3,
+			MNTv3:    rc.MNTv3,
+			NLMv4:    rc.NLMv4,
+			RQUOTA:   rc.RQUOTA,
+			NFSv40:   rc.NFSv40,
+			NFSv41:   rc.NFSv41,
+			NFSv42:   rc.NFSv42,
+			Plan9:    rc.Plan9,
+			LastTime: rc.LastTime,
+		})
+	}
 	return clients, nil
 }
 
+// addr returns the form of the client's address known to Ganesha, which may
+// differ from the form given.  Hostnames are resolved and matched against the
+// clients known to Ganesha.
+func (mgr *ClientMgr) addr(id ClientID) (string, error) {
+
+	if id.reported {
+		return id.Orig, nil
+	}
+
+	candidates := []ClientID{id}
+	if id.IP == nil {
+		ips, err := net.LookupIP(id.Orig)
+		if err != nil {
+			return "", err
+		}
+		candidates = candidates[:0]
+		for _, ip := range ips {
+			c, _ := ParseClientID(ip.String())
+			candidates = append(candidates, c)
+		}
+		if len(candidates) == 0 {
+			return "", fmt.Errorf("no addresses found for %s", id.Orig)
+		}
+	}
+
+	clients, err := mgr.ShowClients()
+	if err != nil {
+		return "", err
+	}
+	for _, client := range clients {
+		for _, c := range candidates {
+			if client.Client.Equal(c) {
+				return client.Client.Orig, nil
+			}
+		}
+	}
+
+	// Not a known client, Ganesha will report an error.
+	return candidates[0].String(), nil
+}
+
 // GetNFSv40IO returns basic stats for the NFSv4.0 client connection.
-func (mgr *ClientMgr) GetNFSv40IO(ipaddr string) (*BasicStats, error) {
-	return mgr.getBasicStats("org.ganesha.nfsd.clientstats.GetNFSv40IO", ipaddr)
+func (mgr *ClientMgr) GetNFSv40IO(id ClientID) (*BasicStats, error) {
+	return mgr.getBasicStats(clientStatsMethods[ClientStatsNFSv40], id)
 }
 
 // GetNFSv41IO returns basic stats for the NFSv4.1 client connection.
-func (mgr *ClientMgr) GetNFSv41IO(ipaddr string) (*BasicStats, error) {
-	return mgr.getBasicStats("org.ganesha.nfsd.clientstats.GetNFSv41IO", ipaddr)
+func (mgr *ClientMgr) GetNFSv41IO(id ClientID) (*BasicStats, error) {
+	return mgr.getBasicStats(clientStatsMethods[ClientStatsNFSv41], id)
+}
+
+// GetNFSv3IO returns basic stats for the NFSv3 client connection.
+func (mgr *ClientMgr) GetNFSv3IO(id ClientID) (*BasicStats, error) {
+	return mgr.getBasicStats(clientStatsMethods[ClientStatsNFSv3], id)
+}
+
+// GetNFSv42IO returns basic stats for the NFSv4.2 client connection.  Not all
+// versions of Ganesha support NFSv4.2 client stats.
+func (mgr *ClientMgr) GetNFSv42IO(id ClientID) (*BasicStats, error) {
+	return mgr.getBasicStats(clientStatsMethods[ClientStatsNFSv42], id)
+}
+
+// GetNLMIO returns basic stats for the client's NLMv4 locking traffic.  Not
+// all versions of Ganesha support NLM client stats.
+func (mgr *ClientMgr) GetNLMIO(id ClientID) (*BasicStats, error) {
+	return mgr.getBasicStats(clientStatsMethods[ClientStatsNLM], id)
+}
+
+// GetMNTIO returns basic stats for the client's MNTv3 traffic.  Not all
+// versions of Ganesha support MNT client stats.
+func (mgr *ClientMgr) GetMNTIO(id ClientID) (*BasicStats, error) {
+	return mgr.getBasicStats(clientStatsMethods[ClientStatsMNT], id)
+}
+
+// GetClientAllOps returns the count of each operation made by the client,
+// across all protocols.
+//
+// Ganesha only collects these once client all-ops stats have been enabled.
+// Status is false with an error message until then.
+func (mgr *ClientMgr) GetClientAllOps(id ClientID) (*ClientAllOps, error) {
+
+	out := &ClientAllOps{}
+
+	ipaddr, err := mgr.addr(id)
+	if err != nil {
+		return nil, err
+	}
+
+	call := mgr.dbusObject.Call(clientStatsMethods[ClientStatsAllOps], 0, ipaddr)
+	if err := storeStatus(call, &out.StatsBaseAnswer); err != nil {
+		return nil, err
+	}
+	if !out.Status {
+		return out, nil
+	}
+
+	// Operations are reported per protocol as arrays of structs starting with
+	// the operation name followed by its counters.  The same operation may be
+	// reported by more than one protocol, so counts are summed by name.
+	ops := make(map[string]*OpCount)
+	var order []string
+	var walk func(fields []interface{})
+	walk = func(fields []interface{}) {
+		for _, field := range fields {
+			switch f := field.(type) {
+			case [][]interface{}:
+				for _, op := range f {
+					name, counts := opCounts(op)
+					if name == "" {
+						walk(op)
+						continue
+					}
+					if _, ok := ops[name]; !ok {
+						ops[name] = &OpCount{Op: name}
+						order = append(order, name)
+					}
+					if len(counts) > 0 {
+						ops[name].Total += counts[0]
+					}
+					if len(counts) > 1 {
+						ops[name].Errors += counts[1]
+					}
+				}
+			case []interface{}:
+				walk(f)
+			}
+		}
+	}
+	walk(call.Body[3:])
+
+	for _, name := range order {
+		out.Ops = append(out.Ops, *ops[name])
+	}
+	return out, nil
+}
+
+// opCounts returns the leading name and the unsigned counters of a decoded
+// struct, or an empty name if the struct does not start with a string.
+func opCounts(fields []interface{}) (string, []uint64) {
+	if len(fields) == 0 {
+		return "", nil
+	}
+	name, ok := fields[0].(string)
+	if !ok {
+		return "", nil
+	}
+	var counts []uint64
+	for _, field := range fields[1:] {
+		switch f := field.(type) {
+		case uint64:
+			counts = append(counts, f)
+		case uint32:
+			counts = append(counts, uint64(f))
+		}
+	}
+	return name, counts
 }
 
-func (mgr *ClientMgr) getBasicStats(method string, ipaddr string) (*BasicStats, error) {
+// ProbeStats returns the client stats families supported by the running
+// Ganesha.  A family is supported if Ganesha replies to its DBus method, and
+// unsupported if Ganesha does not recognise the method.
+//
+// Any other error, such as a timeout while Ganesha is restarting, is returned
+// as support is then unknown.
+func (mgr *ClientMgr) ProbeStats() (map[ClientStatsFamily]bool, error) {
+
+	supported := make(map[ClientStatsFamily]bool)
+	for family, method := range clientStatsMethods {
+		// No client uses the unspecified address, so supported methods will
+		// return a status error rather than stats.
+		err := mgr.dbusObject.Call(method, 0, "0.0.0.0").Err
+		switch {
+		case err == nil:
+			supported[family] = true
+		case IsUnknownMethod(err):
+			supported[family] = false
+		default:
+			return nil, fmt.Errorf("failed to probe %s client stats: %v", family, err)
+		}
+	}
+	return supported, nil
+}
+
+func (mgr *ClientMgr) getBasicStats(method string, id ClientID) (*BasicStats, error) {
 
 	out := &BasicStats{}
 
+	ipaddr, err := mgr.addr(id)
+	if err != nil {
+		return nil, err
+	}
+
 	call := mgr.dbusObject.Call(method, 0, ipaddr)
-	if call.Err != nil {
-		return nil, call.Err
+	if err := storeStatus(call, &out.StatsBaseAnswer); err != nil {
+		return nil, err
 	}
-	if !call.Body[0].(bool) {
-		if err := call.Store(&out.Status, &out.Error, &out.Time); err != nil {
-			return nil, err
-		}
+	if !out.Status {
 		return out, nil
 	}
-	if err := call.Store(&out.Status, &out.Error, &out.Time, &out.Read, &out.Write); err != nil {
+	if err := dbus.Store(call.Body[3:], &out.Read, &out.Write); err != nil {
 		return nil, err
 	}
 	return out, nil
 }
+
+// AddClient registers a client with Ganesha so that its stats are collected
+// before it next connects.
+func (mgr *ClientMgr) AddClient(id ClientID) error {
+	return mgr.callClient("org.ganesha.nfsd.clientmgr.AddClient", id)
+}
+
+// RemoveClient removes a client and its state from Ganesha.  Ganesha refuses
+// to remove NFSv4 clients that still hold state within their lease.
+func (mgr *ClientMgr) RemoveClient(id ClientID) error {
+	return mgr.callClient("org.ganesha.nfsd.clientmgr.RemoveClient", id)
+}
+
+// callClient calls a clientmgr method that returns a status and error message.
+func (mgr *ClientMgr) callClient(method string, id ClientID) error {
+
+	ipaddr, err := mgr.addr(id)
+	if err != nil {
+		return err
+	}
+
+	var ok bool
+	var msg string
+	if err := mgr.dbusObject.Call(method, 0, ipaddr).Store(&ok, &msg); err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New(msg)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package ganesha
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+func TestProbeStats(t *testing.T) {
+
+	unknown := dbus.Error{Name: dbusUnknownMethod}
+	obj := &fakeObject{
+		body: []interface{}{false, "Client IP address not found"},
+		errs: map[string]error{
+			clientStatsMethods[ClientStatsNFSv42]: unknown,
+			clientStatsMethods[ClientStatsAllOps]: &unknown,
+		},
+	}
+	mgr := &ClientMgr{dbusObject: obj}
+
+	supported, err := mgr.ProbeStats()
+	if err != nil {
+		t.Fatalf("ProbeStats() error = %v", err)
+	}
+	for family := range clientStatsMethods {
+		want := family != ClientStatsNFSv42 && family != ClientStatsAllOps
+		if got, ok := supported[family]; !ok || got != want {
+			t.Errorf("ProbeStats()[%s] = %v, %v, want %v", family, got, ok, want)
+		}
+	}
+
+	// Support is unknown if the server doesn't answer.
+	obj.errs[clientStatsMethods[ClientStatsNFSv3]] = errors.New("timeout")
+	if supported, err := mgr.ProbeStats(); err == nil {
+		t.Errorf("ProbeStats() = %v, want error", supported)
+	}
+}
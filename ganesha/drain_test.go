@@ -0,0 +1,93 @@
+package ganesha
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/storageos/nfs/config"
+)
+
+func TestClientMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients []string
+		ip      string
+		want    bool
+	}{
+		{name: "address", clients: []string{"10.0.0.1"}, ip: "10.0.0.1", want: true},
+		{name: "other address", clients: []string{"10.0.0.2"}, ip: "10.0.0.1"},
+		{name: "mapped address", clients: []string{"10.0.0.1"}, ip: "::ffff:10.0.0.1", want: true},
+		{name: "ipv6 address", clients: []string{"fd00::1"}, ip: "fd00:0::1", want: true},
+		{name: "cidr", clients: []string{"10.1.0.0/16"}, ip: "10.1.2.3", want: true},
+		{name: "other cidr", clients: []string{"10.1.0.0/16"}, ip: "10.2.0.1"},
+		{name: "any", clients: []string{"*"}, ip: "192.168.0.1", want: true},
+		{name: "hostname", clients: []string{"client-1.example.com"}, ip: "10.0.0.1", want: true},
+		{name: "wildcard", clients: []string{"*.example.com"}, ip: "10.0.0.1", want: true},
+		{name: "netgroup", clients: []string{"@trusted"}, ip: "10.0.0.1", want: true},
+		{name: "second entry", clients: []string{"10.0.0.2", "10.1.0.0/16"}, ip: "10.1.0.1", want: true},
+		{name: "no entries", ip: "10.0.0.1"},
+		{name: "empty entry", clients: []string{""}, ip: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &config.Client{Clients: tt.clients}
+			if got := clientMatches(c, net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("clientMatches(%q, %s) = %v, want %v", tt.clients, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestrictExport(t *testing.T) {
+
+	export := &config.Export{
+		ExportID:   77,
+		Path:       "/export",
+		Pseudo:     "/",
+		AccessType: "RO",
+		Squash:     "root_squash",
+		Clients: []*config.Client{
+			{Clients: []string{"10.1.0.0/16"}, AccessType: "RW"},
+			{Clients: []string{"10.0.0.0/8"}, Squash: "none"},
+			{Clients: []string{"*.example.com"}, AccessType: "MDONLY"},
+		},
+	}
+	orig := export.Copy()
+
+	ips := []net.IP{
+		net.ParseIP("10.1.0.5"),
+		net.ParseIP("::ffff:10.2.0.5"),
+		net.ParseIP("192.168.0.1"),
+	}
+	got := restrictExport(export, ips)
+
+	if got.AccessType != "None" {
+		t.Errorf("AccessType = %q, want None", got.AccessType)
+	}
+	if got.ExportID != 77 || got.Path != "/export" || got.Pseudo != "/" {
+		t.Errorf("export identity changed: %+v", got)
+	}
+	want := []*config.Client{
+		// First matching block wins.
+		{Clients: []string{"10.1.0.5"}, AccessType: "RW", Squash: "root_squash"},
+		// Unset values are inherited from the export.
+		{Clients: []string{"10.2.0.5"}, AccessType: "RO", Squash: "none"},
+		// Hostname wildcards may match, so keep their access.
+		{Clients: []string{"192.168.0.1"}, AccessType: "MDONLY", Squash: "root_squash"},
+	}
+	if !reflect.DeepEqual(got.Clients, want) {
+		for i, c := range got.Clients {
+			t.Logf("client %d: %+v", i, c)
+		}
+		t.Errorf("Clients differ from want %+v", want)
+	}
+	if !reflect.DeepEqual(export, orig) {
+		t.Errorf("restrictExport modified the export")
+	}
+
+	// Without known clients, nobody keeps access.
+	if got := restrictExport(export, nil); got.AccessType != "None" || len(got.Clients) != 0 {
+		t.Errorf("restrictExport(nil) = %+v, want no access", got)
+	}
+}
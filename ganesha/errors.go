@@ -0,0 +1,24 @@
+package ganesha
+
+import "github.com/godbus/dbus"
+
+// DBus error names returned when a method is not implemented.
+const (
+	dbusUnknownMethod    = "org.freedesktop.DBus.Error.UnknownMethod"
+	dbusUnknownInterface = "org.freedesktop.DBus.Error.UnknownInterface"
+)
+
+// IsUnknownMethod returns true if err was returned because the running
+// Ganesha does not implement the called DBus method.
+func IsUnknownMethod(err error) bool {
+	var name string
+	switch e := err.(type) {
+	case dbus.Error:
+		name = e.Name
+	case *dbus.Error:
+		name = e.Name
+	default:
+		return false
+	}
+	return name == dbusUnknownMethod || name == dbusUnknownInterface
+}
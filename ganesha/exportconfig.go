@@ -0,0 +1,148 @@
+package ganesha
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/storageos/nfs/config"
+)
+
+// ErrUnknownExport is returned when changing an export that is not running.
+var ErrUnknownExport = errors.New("unknown export")
+
+// ExportConfigMgr adds, updates and removes exports at runtime, recording each
+// change in the running configuration.
+//
+// Exports are validated against the running exports and written to a config
+// file of their own before being applied, so nfs-ganesha only loads exports
+// that have been checked.  Clients denied by the AccessMgr remain denied.
+type ExportConfigMgr struct {
+	exportMgr exportLoader
+	accessMgr *AccessMgr
+	running   *RunningConfig
+
+	// dir is where the export configs are written.  It must be readable by
+	// nfs-ganesha.
+	dir string
+}
+
+// NewExportConfigMgr returns a new ExportConfigMgr for the running exports.
+//
+// If accessMgr is set, clients it has denied are denied access to the exports
+// added and updated.
+func NewExportConfigMgr(exportMgr *ExportMgr, accessMgr *AccessMgr, running *RunningConfig, dir string) *ExportConfigMgr {
+	return newExportConfigMgr(exportMgr, accessMgr, running, dir)
+}
+
+func newExportConfigMgr(exportMgr exportLoader, accessMgr *AccessMgr, running *RunningConfig, dir string) *ExportConfigMgr {
+	return &ExportConfigMgr{
+		exportMgr: exportMgr,
+		accessMgr: accessMgr,
+		running:   running,
+		dir:       dir,
+	}
+}
+
+// AddExport adds the export to the running server.  A *config.ValidationError
+// is returned if the export is invalid or conflicts with a running export.
+// Ganesha's status message is returned on success.
+func (m *ExportConfigMgr) AddExport(export *config.Export) (string, error) {
+	var msg string
+	err := m.running.Update(func(cfg *config.Config) error {
+		if exportIndex(cfg, export.ExportID) >= 0 {
+			return &config.ValidationError{Problems: []string{
+				fmt.Sprintf("export %d: Export_Id must be unique", export.ExportID),
+			}}
+		}
+		applied, path, err := m.prepare(cfg, export)
+		if err != nil {
+			return err
+		}
+		if msg, err = m.exportMgr.AddExport(path, ExportExpr(export.ExportID)); err != nil {
+			return err
+		}
+		cfg.Exports = append(cfg.Exports, applied)
+		return nil
+	})
+	return msg, err
+}
+
+// UpdateExport replaces the running export with the same Export_Id.
+// ErrUnknownExport is returned if there is no such export, and a
+// *config.ValidationError if the export is invalid or conflicts with another
+// running export.  Ganesha's status message is returned on success.
+func (m *ExportConfigMgr) UpdateExport(export *config.Export) (string, error) {
+	var msg string
+	err := m.running.Update(func(cfg *config.Config) error {
+		i := exportIndex(cfg, export.ExportID)
+		if i < 0 {
+			return ErrUnknownExport
+		}
+		applied, path, err := m.prepare(cfg, export)
+		if err != nil {
+			return err
+		}
+		if msg, err = m.exportMgr.UpdateExport(path, ExportExpr(export.ExportID)); err != nil {
+			return err
+		}
+		cfg.Exports[i] = applied
+		return nil
+	})
+	return msg, err
+}
+
+// RemoveExport removes the running export with the given id.
+// ErrUnknownExport is returned if there is no such export.
+func (m *ExportConfigMgr) RemoveExport(id uint16) error {
+	return m.running.Update(func(cfg *config.Config) error {
+		i := exportIndex(cfg, id)
+		if i < 0 {
+			return ErrUnknownExport
+		}
+		if err := m.exportMgr.RemoveExport(id); err != nil {
+			return err
+		}
+		cfg.Exports = append(cfg.Exports[:i:i], cfg.Exports[i+1:]...)
+		return nil
+	})
+}
+
+// prepare validates the export as it would run alongside the other exports in
+// cfg, and writes it to a config file.  The export as applied, with denied
+// clients, and the path of its config file are returned.  It must be called
+// with the running configuration held, as cfg.
+func (m *ExportConfigMgr) prepare(cfg *config.Config, export *config.Export) (*config.Export, string, error) {
+
+	applied := export
+	if m.accessMgr != nil {
+		applied = m.accessMgr.denyAll(export)
+	}
+
+	candidate := cfg.Copy()
+	if i := exportIndex(candidate, export.ExportID); i >= 0 {
+		candidate.Exports[i] = applied
+	} else {
+		candidate.Exports = append(candidate.Exports, applied)
+	}
+	if err := candidate.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	path := filepath.Join(m.dir, fmt.Sprintf("export-%d.conf", export.ExportID))
+	if err := (&config.Config{Exports: []*config.Export{applied}}).WriteFile(path); err != nil {
+		return nil, "", err
+	}
+	return applied, path, nil
+}
+
+// exportIndex returns the index of the export with the given id in cfg, or -1
+// if not found.
+func exportIndex(cfg *config.Config, id uint16) int {
+	for i, export := range cfg.Exports {
+		if export.ExportID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,157 @@
+package ganesha
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/storageos/nfs/config"
+)
+
+func mustParseExport(t *testing.T, id int, access string) *config.Export {
+	t.Helper()
+	cfg, err := config.ParseString(testExport(id, access))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Exports[0]
+}
+
+func TestExportConfigMgr(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "exportconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg, err := config.ParseString(testExport(1, "RW"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader := &fakeLoader{errs: map[string]error{"remove 1": errors.New("busy")}}
+	running := NewRunningConfig(cfg)
+	accessMgr := newAccessMgr(&fakeApplier{}, &fakeRegistrar{}, running, dir)
+	m := newExportConfigMgr(loader, accessMgr, running, dir)
+
+	// Denied clients are denied access to added exports.
+	if err := accessMgr.Deny(mustParseClientID(t, "10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddExport(mustParseExport(t, 2, "RW")); err != nil {
+		t.Fatalf("AddExport() error = %v", err)
+	}
+	written, err := config.Load(filepath.Join(dir, "export-2.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint16][]string{2: {"10.0.0.1=None"}}
+	if got := clientBlocks(written); !reflect.DeepEqual(got, want) {
+		t.Errorf("written export clients = %v, want %v", got, want)
+	}
+
+	if _, err := m.UpdateExport(mustParseExport(t, 2, "RO")); err != nil {
+		t.Fatalf("UpdateExport() error = %v", err)
+	}
+
+	// Invalid changes are refused before reaching Ganesha.
+	if _, err := m.AddExport(mustParseExport(t, 2, "RW")); !isValidationError(err) {
+		t.Errorf("AddExport() existing export error = %v, want validation error", err)
+	}
+	clash := mustParseExport(t, 3, "RW")
+	clash.Pseudo = "/1"
+	if _, err := m.AddExport(clash); !isValidationError(err) {
+		t.Errorf("AddExport() clashing pseudo error = %v, want validation error", err)
+	}
+	if _, err := m.UpdateExport(mustParseExport(t, 4, "RW")); err != ErrUnknownExport {
+		t.Errorf("UpdateExport() error = %v, want %v", err, ErrUnknownExport)
+	}
+	if err := m.RemoveExport(4); err != ErrUnknownExport {
+		t.Errorf("RemoveExport() error = %v, want %v", err, ErrUnknownExport)
+	}
+
+	// Failed removals leave the export running.
+	if err := m.RemoveExport(1); err == nil {
+		t.Error("RemoveExport() error = nil, want error")
+	}
+
+	wantCalls := []string{"add " + ExportExpr(2), "update " + ExportExpr(2), "remove 1"}
+	if !reflect.DeepEqual(loader.calls, wantCalls) {
+		t.Errorf("calls = %q, want %q", loader.calls, wantCalls)
+	}
+	exports := make(map[uint16]string)
+	for _, export := range running.Get().Exports {
+		exports[export.ExportID] = export.AccessType
+	}
+	if want := map[uint16]string{1: "RW", 2: "RO"}; !reflect.DeepEqual(exports, want) {
+		t.Errorf("running exports = %v, want %v", exports, want)
+	}
+}
+
+// TestExportConfigMgrRestart checks that exports added at runtime are served
+// when the Supervisor restarts the server.
+func TestExportConfigMgrRestart(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "exportconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	restart := filepath.Join(dir, "restart.conf")
+
+	cfg, err := config.ParseString(testExport(1, "RW"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := NewRunningConfig(cfg)
+	running.OnUpdate(func(cfg *config.Config) {
+		if err := cfg.WriteFile(restart); err != nil {
+			t.Error(err)
+		}
+	})
+	m := newExportConfigMgr(&fakeLoader{}, nil, running, dir)
+
+	supervisorConfig := testSupervisorConfig
+	supervisorConfig.RestartConfig = restart
+	nfs := newFakeProcess("ganesha.conf")
+	s := newSupervisor(nfs, supervisorConfig, newFakeClock(), nil)
+	errCh, err := s.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	crash := nfs.next(t)
+
+	if _, err := m.AddExport(mustParseExport(t, 2, "RW")); err != nil {
+		t.Fatalf("AddExport() error = %v", err)
+	}
+
+	crash <- errors.New("crashed")
+	exit := nfs.next(t)
+	s.Close(context.Background())
+	close(exit)
+	for range errCh {
+	}
+
+	nfs.mu.Lock()
+	path := nfs.configs[len(nfs.configs)-1]
+	nfs.mu.Unlock()
+	if path != restart {
+		t.Fatalf("restarted with %s, want %s", path, restart)
+	}
+	restarted, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("failed to load restart config: %v", err)
+	}
+	if restarted.Export(1) == nil || restarted.Export(2) == nil {
+		t.Errorf("restart config exports = %v, want exports 1 and 2", restarted.Exports)
+	}
+}
+
+func isValidationError(err error) bool {
+	_, ok := err.(*config.ValidationError)
+	return ok
+}
@@ -1,28 +1,144 @@
 package ganesha
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/godbus/dbus"
+	"github.com/storageos/nfs/config"
+	nfsdbus "github.com/storageos/nfs/dbus"
+	"golang.org/x/sys/unix"
 )
 
+// Export Structure of the output of ShowExports dbus call.
+//
+// Whenever export traffic for a protocol is detected, the corresponding field
+// for the protocol will be set to true.
+//
+// LastTime is the timestamp of the last recorded activity on the export.
+type Export struct {
+	ExportID uint16
+	Path     string
+	NFSv3    bool
+	MNTv3    bool
+	NLMv4    bool
+	RQUOTA   bool
+	NFSv40   bool
+	NFSv41   bool
+	NFSv42   bool
+	Plan9    bool
+	LastTime unix.Timespec
+}
+
+// ExportDetails is the response to the DisplayExport dbus call.
+type ExportDetails struct {
+	ExportID uint16
+	Path     string
+	Pseudo   string
+	Tag      string
+}
+
 // ExportMgr is a handle to Ganesha's DBus ExportMgr object.
 //
-// It can be used to retrieve per-export protocol statistics.
+// It can be used to manage exports at runtime and to retrieve per-export
+// protocol statistics.
 type ExportMgr struct {
 	dbusObject dbus.BusObject
 }
 
-// NewExportMgr Get a new ExportMgr
-func NewExportMgr() (*ExportMgr, error) {
-	conn, err := dbus.SystemBus()
-	if err != nil {
-		return nil, err
-	}
+// NewExportMgr Get a new ExportMgr using the shared system bus connection.
+func NewExportMgr(conn *nfsdbus.Conn) *ExportMgr {
 	return &ExportMgr{
 		dbusObject: conn.Object(
 			"org.ganesha.nfsd",
 			"/org/ganesha/nfsd/ExportMgr",
 		),
-	}, nil
+	}
+}
+
+// ExportExpr returns the expression used by AddExport and UpdateExport to
+// select a single EXPORT block by its Export_Id.
+func ExportExpr(id uint16) string {
+	return fmt.Sprintf("EXPORT(Export_Id=%d)", id)
+}
+
+// ShowExports returns Ganesha's list of active exports.
+func (mgr *ExportMgr) ShowExports() ([]Export, error) {
+
+	var exports []Export
+	utime := unix.Timespec{}
+
+	if err := mgr.dbusObject.Call("org.ganesha.nfsd.exportmgr.ShowExports", 0).Store(&utime, &exports); err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+// DisplayExport returns the details of a single export.
+func (mgr *ExportMgr) DisplayExport(id uint16) (*ExportDetails, error) {
+
+	out := &ExportDetails{}
+
+	call := mgr.dbusObject.Call("org.ganesha.nfsd.exportmgr.DisplayExport", 0, id)
+	if call.Err != nil {
+		return nil, call.Err
+	}
+
+	// Newer versions of Ganesha append the export's client list, which we
+	// don't currently need.
+	if len(call.Body) < 4 {
+		return nil, fmt.Errorf("unexpected DisplayExport response: %v", call.Body)
+	}
+	if err := dbus.Store(call.Body[:4], &out.ExportID, &out.Path, &out.Pseudo, &out.Tag); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AddExport adds the export matching expr from the config file at path.  The
+// file must be readable by the nfs-ganesha process.
+//
+// The expr is typically generated with ExportExpr.  Ganesha's status message
+// is returned on success.
+func (mgr *ExportMgr) AddExport(path string, expr string) (string, error) {
+
+	var msg string
+
+	if err := mgr.dbusObject.Call("org.ganesha.nfsd.exportmgr.AddExport", 0, path, expr).Store(&msg); err != nil {
+		return "", err
+	}
+	return msg, nil
+}
+
+// UpdateExport replaces the configuration of an existing export with the
+// export matching expr from the config file at path.
+//
+// Existing client connections to the export are maintained.  Ganesha's status
+// message is returned on success.
+func (mgr *ExportMgr) UpdateExport(path string, expr string) (string, error) {
+
+	var msg string
+
+	if err := mgr.dbusObject.Call("org.ganesha.nfsd.exportmgr.UpdateExport", 0, path, expr).Store(&msg); err != nil {
+		return "", err
+	}
+	return msg, nil
+}
+
+// ApplyExport writes the export to a config file at path and updates the
+// running export with the same Export_Id to match.
+func (mgr *ExportMgr) ApplyExport(export *config.Export, path string) (string, error) {
+	cfg := &config.Config{Exports: []*config.Export{export}}
+	if err := cfg.WriteFile(path); err != nil {
+		return "", err
+	}
+	return mgr.UpdateExport(path, ExportExpr(export.ExportID))
+}
+
+// RemoveExport removes the export with the given id.
+func (mgr *ExportMgr) RemoveExport(id uint16) error {
+	return mgr.dbusObject.Call("org.ganesha.nfsd.exportmgr.RemoveExport", 0, id).Err
 }
 
 // GetIOStats returns the basic IO stats for all exports.
@@ -31,19 +147,247 @@ func (mgr *ExportMgr) GetIOStats() (*ExportIOStatsList, error) {
 	out := &ExportIOStatsList{}
 
 	call := mgr.dbusObject.Call("org.ganesha.nfsd.exportstats.GetNFSIO", 0)
-	if call.Err != nil {
-		return nil, call.Err
+	if err := storeStatus(call, &out.StatsBaseAnswer); err != nil {
+		return nil, err
+	}
+	if !out.Status {
+		return out, nil
+	}
+	if err := dbus.Store(call.Body[3:], &out.Exports); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetFullV4Stats returns the per-operation stats for NFSv4 operations across
+// all exports.
+func (mgr *ExportMgr) GetFullV4Stats() (*FullV4Stats, error) {
+
+	out := &FullV4Stats{}
+
+	call := mgr.dbusObject.Call("org.ganesha.nfsd.exportstats.GetFULLV4Stats", 0)
+	if err := storeStatus(call, &out.StatsBaseAnswer); err != nil {
+		return nil, err
+	}
+	if !out.Status {
+		return out, nil
+	}
+	if err := dbus.Store(call.Body[3:], &out.Ops); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetGlobalOPS returns the number of operations handled by the server for each
+// protocol, independent of exports and clients.
+func (mgr *ExportMgr) GetGlobalOPS() (*OPSStats, error) {
+	return getOPSStats(mgr.dbusObject.Call("org.ganesha.nfsd.exportstats.GetGlobalOPS", 0))
+}
+
+// GetTotalOPS returns the number of operations for each protocol on the
+// export with the given id.
+func (mgr *ExportMgr) GetTotalOPS(id uint16) (*OPSStats, error) {
+	return getOPSStats(mgr.dbusObject.Call("org.ganesha.nfsd.exportstats.GetTotalOPS", 0, id))
+}
+
+// getOPSStats decodes the response to an operations call.
+//
+// Operation counts are returned as a struct of alternating protocol name and
+// count fields, e.g. ("NFSv3:", 10, "NFSv4:", 20).  The fields vary with the
+// protocols Ganesha was built with, so the struct is decoded generically.
+func getOPSStats(call *dbus.Call) (*OPSStats, error) {
+
+	out := &OPSStats{}
+
+	if err := storeStatus(call, &out.StatsBaseAnswer); err != nil {
+		return nil, err
+	}
+	if !out.Status {
+		return out, nil
+	}
+	if len(call.Body) < 4 {
+		return nil, fmt.Errorf("operations missing from response")
 	}
 
-	if !call.Body[0].(bool) {
-		if err := call.Store(&out.Status, &out.Error, &out.Time); err != nil {
-			return nil, err
+	fields, ok := call.Body[3].([]interface{})
+	if !ok || len(fields)%2 != 0 {
+		return nil, fmt.Errorf("unexpected operations format: %v", call.Body[3])
+	}
+	out.Ops = make(map[string]uint64)
+	for i := 0; i < len(fields); i += 2 {
+		name, ok := fields[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected protocol name: %v", fields[i])
+		}
+		count, ok := fields[i+1].(uint64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected count for %s: %v", name, fields[i+1])
 		}
+		out.Ops[strings.TrimSuffix(name, ":")] = count
+	}
+	return out, nil
+}
+
+// GetFSALStats returns the operation stats for the named FSAL, e.g. VFS.
+func (mgr *ExportMgr) GetFSALStats(fsal string) (*FSALStats, error) {
+
+	out := &FSALStats{}
+
+	call := mgr.dbusObject.Call("org.ganesha.nfsd.exportstats.GetFSALStats", 0, fsal)
+	if err := storeStatus(call, &out.StatsBaseAnswer); err != nil {
+		return nil, err
+	}
+	if !out.Status {
 		return out, nil
 	}
 
-	if err := call.Store(&out.Status, &out.Error, &out.Time, &out.Exports); err != nil {
+	// FSALs report an array of operations, each a struct starting with the
+	// operation name, followed by its count and optionally the average,
+	// minimum and maximum latency.
+	for _, v := range call.Body[3:] {
+		ops, ok := v.([][]interface{})
+		if !ok {
+			continue
+		}
+		for _, fields := range ops {
+			op := FSALOpStats{}
+			var latencies []float64
+			for _, field := range fields {
+				switch f := field.(type) {
+				case string:
+					op.Op = f
+				case uint64:
+					op.Total = f
+				case float64:
+					latencies = append(latencies, f)
+				}
+			}
+			for i, l := range latencies {
+				switch i {
+				case 0:
+					op.Latency = l
+				case 1:
+					op.MinLatency = l
+				case 2:
+					op.MaxLatency = l
+				}
+			}
+			if op.Op != "" {
+				out.Ops = append(out.Ops, op)
+			}
+		}
+	}
+	return out, nil
+}
+
+// ShowMDCache returns the metadata cache and LRU utilisation.
+func (mgr *ExportMgr) ShowMDCache() (*MDCacheStats, error) {
+
+	out := &MDCacheStats{}
+
+	call := mgr.dbusObject.Call("org.ganesha.nfsd.exportstats.ShowMDCache", 0)
+	if err := storeStatus(call, &out.StatsBaseAnswer); err != nil {
 		return nil, err
 	}
+	if !out.Status {
+		return out, nil
+	}
+
+	out.Values = make(map[string]float64)
+	namedValues(call.Body[3:], out.Values)
 	return out, nil
 }
+
+// storeStatus stores the status fields of a stats response.  An error is
+// returned if the call failed or the response is malformed.
+//
+// Successful responses always have the status, error and timestamp, so
+// callers can read any further fields from call.Body[3:].
+func storeStatus(call *dbus.Call, out *StatsBaseAnswer) error {
+
+	if call.Err != nil {
+		return call.Err
+	}
+	if len(call.Body) < 2 {
+		return fmt.Errorf("malformed stats response: %v", call.Body)
+	}
+
+	// Failed calls may not include a timestamp.
+	n := 3
+	if len(call.Body) < n {
+		if status, _ := call.Body[0].(bool); status {
+			return fmt.Errorf("stats response missing timestamp: %v", call.Body)
+		}
+		n = len(call.Body)
+	}
+	if err := dbus.Store(call.Body[:n], []interface{}{&out.Status, &out.Error, &out.Time}[:n]...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// namedValues walks a decoded DBus response, recording each numeric value that
+// follows a string description.  Ganesha uses this format for informational
+// responses, e.g. (" FSAL opened Files: ", 10, " System limit on FDs: ", 1024).
+func namedValues(fields []interface{}, out map[string]float64) {
+
+	var name string
+	for _, field := range fields {
+		var value float64
+		switch f := field.(type) {
+		case string:
+			name = strings.ToLower(strings.Join(strings.Fields(strings.Trim(f, " :")), "_"))
+			continue
+		case []interface{}:
+			namedValues(f, out)
+			name = ""
+			continue
+		case uint64:
+			value = float64(f)
+		case uint32:
+			value = float64(f)
+		case int64:
+			value = float64(f)
+		case int32:
+			value = float64(f)
+		case float64:
+			value = f
+		default:
+			name = ""
+			continue
+		}
+		if name != "" {
+			out[name] = value
+		}
+		name = ""
+	}
+}
+
+// ResetStats clears all stats counters.
+func (mgr *ExportMgr) ResetStats() error {
+	return callStats(mgr.dbusObject.Call("org.ganesha.nfsd.exportstats.ResetStats", 0))
+}
+
+// EnableStats starts collecting the given type of stats.
+func (mgr *ExportMgr) EnableStats(t StatsType) error {
+	return callStats(mgr.dbusObject.Call("org.ganesha.nfsd.exportstats.EnableStats", 0, string(t)))
+}
+
+// DisableStats stops collecting the given type of stats.  Counters for the
+// type are cleared.
+func (mgr *ExportMgr) DisableStats(t StatsType) error {
+	return callStats(mgr.dbusObject.Call("org.ganesha.nfsd.exportstats.DisableStats", 0, string(t)))
+}
+
+// callStats returns an error if a stats control call failed or Ganesha
+// reported an error.
+func callStats(call *dbus.Call) error {
+	out := &StatsBaseAnswer{}
+	if err := storeStatus(call, out); err != nil {
+		return err
+	}
+	if !out.Status {
+		return errors.New(out.Error)
+	}
+	return nil
+}
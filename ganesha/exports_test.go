@@ -0,0 +1,118 @@
+package ganesha
+
+import (
+	"context"
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+// fakeObject is a BusObject that returns body from every call, or the error
+// set for the method.
+type fakeObject struct {
+	body []interface{}
+	errs map[string]error
+}
+
+func (o *fakeObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	return o.CallWithContext(context.Background(), method, flags, args...)
+}
+
+func (o *fakeObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	if err := o.errs[method]; err != nil {
+		return &dbus.Call{Method: method, Args: args, Err: err}
+	}
+	return &dbus.Call{Method: method, Args: args, Body: o.body}
+}
+
+func (o *fakeObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return o.Call(method, flags, args...)
+}
+
+func (o *fakeObject) GoWithContext(ctx context.Context, method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return o.Call(method, flags, args...)
+}
+
+func (o *fakeObject) AddMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	return &dbus.Call{}
+}
+
+func (o *fakeObject) RemoveMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	return &dbus.Call{}
+}
+
+func (o *fakeObject) GetProperty(p string) (dbus.Variant, error) {
+	return dbus.Variant{}, nil
+}
+
+func (o *fakeObject) Destination() string {
+	return "org.ganesha.nfsd"
+}
+
+func (o *fakeObject) Path() dbus.ObjectPath {
+	return "/org/ganesha/nfsd/ExportMgr"
+}
+
+func TestStoreStatus(t *testing.T) {
+
+	timestamp := []interface{}{int64(1571313296), int64(5)}
+
+	tests := []struct {
+		name       string
+		body       []interface{}
+		wantStatus bool
+		wantErr    bool
+	}{
+		{name: "empty", body: nil, wantErr: true},
+		{name: "status only", body: []interface{}{false}, wantErr: true},
+		{name: "failed without timestamp", body: []interface{}{false, "stats disabled"}},
+		{name: "failed with timestamp", body: []interface{}{false, "stats disabled", timestamp}},
+		{name: "ok without timestamp", body: []interface{}{true, "OK"}, wantErr: true},
+		{name: "ok", body: []interface{}{true, "OK", timestamp}, wantStatus: true},
+		{name: "ok with stats", body: []interface{}{true, "OK", timestamp, uint64(1)}, wantStatus: true},
+		{name: "wrong type", body: []interface{}{"true", "OK", timestamp}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out StatsBaseAnswer
+			err := storeStatus(&dbus.Call{Body: tt.body}, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("storeStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && out.Status != tt.wantStatus {
+				t.Errorf("storeStatus() status = %v, want %v", out.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// Responses without stats must not panic the collector.
+func TestShortStatsResponse(t *testing.T) {
+
+	for _, body := range [][]interface{}{nil, {true, "OK"}} {
+		obj := &fakeObject{body: body}
+		mgr := &ExportMgr{dbusObject: obj}
+
+		if _, err := mgr.GetFSALStats("VFS"); err == nil {
+			t.Errorf("GetFSALStats() with %v got no error", body)
+		}
+		if _, err := mgr.ShowMDCache(); err == nil {
+			t.Errorf("ShowMDCache() with %v got no error", body)
+		}
+		if _, err := mgr.GetGlobalOPS(); err == nil {
+			t.Errorf("GetGlobalOPS() with %v got no error", body)
+		}
+		if _, err := mgr.GetIOStats(); err == nil {
+			t.Errorf("GetIOStats() with %v got no error", body)
+		}
+		if _, err := mgr.GetFullV4Stats(); err == nil {
+			t.Errorf("GetFullV4Stats() with %v got no error", body)
+		}
+
+		clientMgr := &ClientMgr{dbusObject: obj}
+		id := ClientID{Orig: "10.0.0.1", reported: true}
+		if _, err := clientMgr.GetNFSv40IO(id); err == nil {
+			t.Errorf("GetNFSv40IO() with %v got no error", body)
+		}
+	}
+}
@@ -2,9 +2,15 @@ package ganesha
 
 import (
 	"context"
-	"log"
+	"errors"
+	"io"
 	"os"
 	"os/exec"
+	"sync"
+
+	nfsdbus "github.com/storageos/nfs/dbus"
+	"github.com/storageos/nfs/logger"
+	"github.com/storageos/nfs/process"
 )
 
 const (
@@ -13,33 +19,60 @@ const (
 
 // Ganesha manages the main nfs-ganesha process.
 type Ganesha struct {
-	cmd *exec.Cmd
 	mgr *AdminMgr
-}
 
-// New creates a new nfs-ganesha process which can be Run and Closed.
-func New(config string) *Ganesha {
+	// logs receives the process's log output.
+	logs io.Writer
+	log  *logger.Logger
 
-	// NewAdminMgr() will error if the system DBus is not operational.  Make
-	// sure DBus is running.  The AdminMgr will be used to read nfs-ganesha
-	// status.
-	mgr, err := NewAdminMgr()
-	if err != nil {
-		log.Fatal(err)
-	}
+	// config is the configuration file used the next time the process is
+	// started.  It is protected by mu.
+	config string
+
+	// cmd is the most recently started process and done is closed once it has
+	// exited.  They are protected by mu.
+	cmd  *exec.Cmd
+	done chan struct{}
+	mu   *sync.Mutex
+}
+
+// New creates a new nfs-ganesha process which can be Run and Closed.  The
+// process's log output, and anything else it writes to stdout or stderr, is
+// written to logs.
+//
+// nfs-ganesha status is read over the shared system bus connection.
+func New(config string, conn *nfsdbus.Conn, logs io.Writer, log *logger.Logger) *Ganesha {
 	return &Ganesha{
-		cmd: &exec.Cmd{
-			Path: nfsDaemon,
-			Args: []string{
-				nfsDaemon,
-				"-F",
-				"-f", config,
-				"-L", "/dev/stdout",
-			},
-			Stdout: os.Stdout,
-			Stderr: os.Stderr,
+		config: config,
+		mgr:    NewAdminMgr(conn),
+		logs:   logs,
+		log:    log,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// SetConfig sets the configuration file used the next time the process is
+// started.  A running process is not affected.
+func (g *Ganesha) SetConfig(config string) {
+	g.mu.Lock()
+	g.config = config
+	g.mu.Unlock()
+}
+
+// command returns a new command for starting the nfs-ganesha process.  A new
+// command is needed each time the process is started.  It must be called with
+// mu held.
+func (g *Ganesha) command() *exec.Cmd {
+	return &exec.Cmd{
+		Path: nfsDaemon,
+		Args: []string{
+			nfsDaemon,
+			"-F",
+			"-f", g.config,
+			"-L", "/dev/stdout",
 		},
-		mgr: mgr,
+		Stdout: g.logs,
+		Stderr: g.logs,
 	}
 }
 
@@ -51,15 +84,27 @@ func New(config string) *Ganesha {
 // returned typically.)
 //
 // Once the process stops, the returned channel is closed.
+//
+// Run may be called again once the previous process has stopped.
 func (g *Ganesha) Run() (<-chan error, error) {
 
-	if err := g.cmd.Start(); err != nil {
+	// Hold the lock while starting so that the pid is known before the
+	// process can be reaped.
+	g.mu.Lock()
+	cmd := g.command()
+	if err := cmd.Start(); err != nil {
+		g.mu.Unlock()
 		return nil, err
 	}
+	done := make(chan struct{})
+	g.cmd = cmd
+	g.done = done
+	g.mu.Unlock()
 
 	errCh := make(chan error)
 	go func() {
-		err := g.cmd.Wait()
+		err := cmd.Wait()
+		close(done)
 		if err != nil {
 			errCh <- err
 			return
@@ -70,15 +115,47 @@ func (g *Ganesha) Run() (<-chan error, error) {
 	return errCh, nil
 }
 
-// Close sends a SIGINT to the nfs-ganesha process.
+// Close sends a SIGINT to the nfs-ganesha process and waits for it to exit.
+// If it has not exited before the context expires, it is killed.
 //
 // Once the process has stopped, the channel returned from Run is closed.
 func (g *Ganesha) Close(ctx context.Context) {
-	if g.cmd != nil {
-		_ = g.cmd.Process.Signal(os.Interrupt)
+	g.mu.Lock()
+	cmd, done := g.cmd, g.done
+	g.mu.Unlock()
+
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	if err := process.Stop(ctx, cmd.Process, done, os.Interrupt); err != nil {
+		g.log.Warnf("nfs server did not stop cleanly: %v", err)
 	}
 }
 
+// Signal sends a signal to the nfs-ganesha process.  nfs-ganesha reloads its
+// exports on receipt of SIGHUP.
+func (g *Ganesha) Signal(sig os.Signal) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.cmd == nil || g.cmd.Process == nil {
+		return errors.New("nfs server not started")
+	}
+	return g.cmd.Process.Signal(sig)
+}
+
+// Pid returns the pid of the most recently started nfs-ganesha process, or 0
+// if it has not been started.
+func (g *Ganesha) Pid() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.cmd == nil || g.cmd.Process == nil {
+		return 0
+	}
+	return g.cmd.Process.Pid
+}
+
 // MonitorStatus listens for status updates and publishes to all status
 // watchers.
 func (g *Ganesha) MonitorStatus(ctx context.Context) error {
@@ -95,20 +172,38 @@ func (g *Ganesha) MonitorStatus(ctx context.Context) error {
 // Heartbeats will not be sent when the server is unhealthy.
 func (g *Ganesha) IsReady(ctx context.Context) bool {
 
-	statusCh := make(chan bool)
-	errCh := make(chan error)
+	statusCh := make(chan bool, 1)
+	errCh := make(chan error, 1)
 
 	g.mgr.AddStatusWatcher(ctx, statusCh, errCh)
 	defer g.mgr.RemoveStatusWatcher(ctx, statusCh)
 
 	select {
 	case <-ctx.Done():
-		log.Printf("timed out waiting for nfs-ganesha heartbeat")
+		g.log.Debugf("timed out waiting for nfs-ganesha heartbeat")
 		return false
 	case err := <-errCh:
-		log.Printf("finished watching for nfs-ganesha heartbeats: %v", err)
+		g.log.Debugf("finished watching for nfs-ganesha heartbeats: %v", err)
 		return false
 	case ok := <-statusCh:
 		return ok
 	}
 }
+
+// StartGrace puts the nfs-ganesha process into its NFSv4 grace period so that
+// clients can reclaim their state.  See AdminMgr.StartGrace.
+func (g *Ganesha) StartGrace(ip string) error {
+	return g.mgr.StartGrace(ip)
+}
+
+// ReleaseIP releases the NFSv4 state of the clients of ip.  See
+// AdminMgr.ReleaseIP.
+func (g *Ganesha) ReleaseIP(ip string) error {
+	return g.mgr.ReleaseIP(ip)
+}
+
+// InGrace returns true if the nfs-ganesha process is in its NFSv4 grace
+// period.
+func (g *Ganesha) InGrace() (bool, error) {
+	return g.mgr.InGrace()
+}
@@ -0,0 +1,258 @@
+package ganesha
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+
+	nfsdbus "github.com/storageos/nfs/dbus"
+	"github.com/storageos/nfs/logger"
+)
+
+// logInterface is the DBus interface whose properties are Ganesha's log
+// component levels.
+const logInterface = "org.ganesha.nfsd.log.component"
+
+// DefaultLogComponent sets the level of every component.
+const DefaultLogComponent = "ALL"
+
+// ErrUnknownLogComponent is returned for components that Ganesha does not
+// have.
+var ErrUnknownLogComponent = errors.New("unknown log component")
+
+// LogLevel is a Ganesha log level.
+type LogLevel string
+
+// Log levels, from least to most verbose.
+const (
+	LogNull      LogLevel = "NULL"
+	LogFatal     LogLevel = "FATAL"
+	LogMajor     LogLevel = "MAJ"
+	LogCritical  LogLevel = "CRIT"
+	LogWarning   LogLevel = "WARN"
+	LogEvent     LogLevel = "EVENT"
+	LogInfo      LogLevel = "INFO"
+	LogDebug     LogLevel = "DEBUG"
+	LogMidDebug  LogLevel = "MID_DEBUG"
+	LogFullDebug LogLevel = "FULL_DEBUG"
+)
+
+// ParseLogLevel returns the LogLevel for s, or an error if it is not known.
+// The `NIV_` prefix used in Ganesha's configuration is optional.
+func ParseLogLevel(s string) (LogLevel, error) {
+	s = strings.TrimPrefix(strings.ToUpper(s), "NIV_")
+	switch l := LogLevel(s); l {
+	case LogNull, LogFatal, LogMajor, LogCritical, LogWarning, LogEvent, LogInfo, LogDebug, LogMidDebug, LogFullDebug:
+		return l, nil
+	}
+	return "", fmt.Errorf("unknown log level %q", s)
+}
+
+// LogRevert is a pending revert of a component to its previous level.
+type LogRevert struct {
+	Component string    `json:"component"`
+	Level     LogLevel  `json:"level"`
+	At        time.Time `json:"at"`
+}
+
+// logRevert is a pending revert and the timer that applies it.
+type logRevert struct {
+	LogRevert
+	timer *time.Timer
+}
+
+// LogMgr is a handle to Ganesha's log component levels.
+//
+// Components are named as in Ganesha's LOG block without the `COMPONENT_`
+// prefix, e.g. NFS_V4, FSAL, DISPATCH or NFS_V4_LOCK.  DefaultLogComponent
+// sets every component.
+type LogMgr struct {
+	dbusObject dbus.BusObject
+	log        *logger.Logger
+
+	// reverts holds the pending reverts, keyed by component.  It is protected
+	// by mu.
+	reverts map[string]*logRevert
+	mu      *sync.Mutex
+}
+
+// NewLogMgr returns a new LogMgr using the shared system bus connection.
+func NewLogMgr(conn *nfsdbus.Conn, log *logger.Logger) *LogMgr {
+	return &LogMgr{
+		dbusObject: conn.Object(
+			"org.ganesha.nfsd",
+			"/org/ganesha/nfsd/admin",
+		),
+		log:     log,
+		reverts: make(map[string]*logRevert),
+		mu:      &sync.Mutex{},
+	}
+}
+
+// Levels returns the level of each component.
+func (mgr *LogMgr) Levels() (map[string]LogLevel, error) {
+
+	var props map[string]dbus.Variant
+	if err := mgr.dbusObject.Call("org.freedesktop.DBus.Properties.GetAll", 0, logInterface).Store(&props); err != nil {
+		return nil, err
+	}
+
+	levels := make(map[string]LogLevel, len(props))
+	for name, v := range props {
+		s, ok := v.Value().(string)
+		if !ok {
+			continue
+		}
+		levels[strings.TrimPrefix(name, "COMPONENT_")] = LogLevel(strings.TrimPrefix(s, "NIV_"))
+	}
+	return levels, nil
+}
+
+// Level returns the level of a single component.
+func (mgr *LogMgr) Level(component string) (LogLevel, error) {
+
+	if err := mgr.checkComponent(component); err != nil {
+		return "", err
+	}
+
+	var v dbus.Variant
+	if err := mgr.dbusObject.Call("org.freedesktop.DBus.Properties.Get", 0, logInterface, componentProperty(component)).Store(&v); err != nil {
+		return "", err
+	}
+	s, ok := v.Value().(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected log level for %s: %v", component, v)
+	}
+	return LogLevel(strings.TrimPrefix(s, "NIV_")), nil
+}
+
+// SetLevel sets the level of a component.  If ttl is set, the components
+// changed are reverted to their previous levels once it expires.
+//
+// Setting a component cancels any pending revert for it.  When a temporary
+// level is replaced by another, the revert restores the level from before the
+// first change.
+func (mgr *LogMgr) SetLevel(component string, level LogLevel, ttl time.Duration) error {
+
+	component = strings.ToUpper(component)
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if err := mgr.checkComponent(component); err != nil {
+		return err
+	}
+
+	// Record the levels to restore before changing them.
+	prev := make(map[string]LogLevel)
+	if ttl > 0 {
+		if component == DefaultLogComponent {
+			levels, err := mgr.Levels()
+			if err != nil {
+				return err
+			}
+			for c, l := range levels {
+				if c != DefaultLogComponent {
+					prev[c] = l
+				}
+			}
+		} else {
+			l, err := mgr.Level(component)
+			if err != nil {
+				return err
+			}
+			prev[component] = l
+		}
+	}
+
+	if err := mgr.set(component, level); err != nil {
+		return err
+	}
+
+	affected := []string{component}
+	if component == DefaultLogComponent {
+		affected = affected[:0]
+		for c := range mgr.reverts {
+			affected = append(affected, c)
+		}
+	}
+	for _, c := range affected {
+		if r, ok := mgr.reverts[c]; ok {
+			r.timer.Stop()
+			delete(mgr.reverts, c)
+			if _, ok := prev[c]; ok {
+				prev[c] = r.Level
+			}
+		}
+	}
+
+	at := time.Now().Add(ttl)
+	for c, l := range prev {
+		r := &logRevert{LogRevert: LogRevert{Component: c, Level: l, At: at}}
+		r.timer = time.AfterFunc(ttl, func() { mgr.revert(r) })
+		mgr.reverts[c] = r
+	}
+	return nil
+}
+
+// Reverts returns the pending reverts, sorted by component.
+func (mgr *LogMgr) Reverts() []LogRevert {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	reverts := make([]LogRevert, 0, len(mgr.reverts))
+	for _, r := range mgr.reverts {
+		reverts = append(reverts, r.LogRevert)
+	}
+	sort.Slice(reverts, func(i, j int) bool { return reverts[i].Component < reverts[j].Component })
+	return reverts
+}
+
+// revert restores a component's previous level, unless the revert has since
+// been cancelled.
+func (mgr *LogMgr) revert(r *logRevert) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if mgr.reverts[r.Component] != r {
+		return
+	}
+	delete(mgr.reverts, r.Component)
+	if err := mgr.set(r.Component, r.Level); err != nil {
+		mgr.log.Errorf("failed to revert nfs log component %s to %s: %v", r.Component, r.Level, err)
+		return
+	}
+	mgr.log.Infof("reverted nfs log component %s to %s", r.Component, r.Level)
+}
+
+// checkComponent returns ErrUnknownLogComponent if Ganesha has no component of
+// that name.  DefaultLogComponent is always known.
+func (mgr *LogMgr) checkComponent(component string) error {
+	component = strings.ToUpper(component)
+	if component == DefaultLogComponent {
+		return nil
+	}
+	levels, err := mgr.Levels()
+	if err != nil {
+		return err
+	}
+	if _, ok := levels[component]; !ok {
+		return ErrUnknownLogComponent
+	}
+	return nil
+}
+
+// set sets the level of a component.
+func (mgr *LogMgr) set(component string, level LogLevel) error {
+	return mgr.dbusObject.Call("org.freedesktop.DBus.Properties.Set", 0, logInterface, componentProperty(component), dbus.MakeVariant("NIV_"+string(level))).Err
+}
+
+// componentProperty returns the DBus property name of a component.
+func componentProperty(component string) string {
+	return "COMPONENT_" + strings.ToUpper(component)
+}
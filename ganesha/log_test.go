@@ -0,0 +1,234 @@
+package ganesha
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+// fakeLogObject holds log component levels as DBus properties.  Setting ALL
+// sets every component, as Ganesha does.
+type fakeLogObject struct {
+	*fakeObject
+	props map[string]string
+}
+
+func newFakeLogObject(levels map[string]LogLevel) *fakeLogObject {
+	o := &fakeLogObject{fakeObject: &fakeObject{}, props: make(map[string]string)}
+	for c, l := range levels {
+		o.props[componentProperty(c)] = "NIV_" + string(l)
+	}
+	return o
+}
+
+func (o *fakeLogObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	return o.CallWithContext(context.Background(), method, flags, args...)
+}
+
+func (o *fakeLogObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	call := &dbus.Call{Method: method, Args: args}
+	switch method {
+	case "org.freedesktop.DBus.Properties.GetAll":
+		props := make(map[string]dbus.Variant)
+		for name, level := range o.props {
+			props[name] = dbus.MakeVariant(level)
+		}
+		call.Body = []interface{}{props}
+	case "org.freedesktop.DBus.Properties.Get":
+		level, ok := o.props[args[1].(string)]
+		if !ok {
+			call.Err = dbus.NewError("org.freedesktop.DBus.Error.UnknownProperty", nil)
+			break
+		}
+		call.Body = []interface{}{dbus.MakeVariant(level)}
+	case "org.freedesktop.DBus.Properties.Set":
+		name := args[1].(string)
+		level := args[2].(dbus.Variant).Value().(string)
+		if name == componentProperty(DefaultLogComponent) {
+			for n := range o.props {
+				o.props[n] = level
+			}
+		}
+		o.props[name] = level
+	}
+	return call
+}
+
+// levels returns the level of each component, without the ALL component.
+func (o *fakeLogObject) levels() map[string]LogLevel {
+	levels := make(map[string]LogLevel)
+	for name, level := range o.props {
+		c := strings.TrimPrefix(name, "COMPONENT_")
+		if c != DefaultLogComponent {
+			levels[c] = LogLevel(strings.TrimPrefix(level, "NIV_"))
+		}
+	}
+	return levels
+}
+
+func newTestLogMgr() (*LogMgr, *fakeLogObject) {
+	o := newFakeLogObject(map[string]LogLevel{
+		DefaultLogComponent: LogEvent,
+		"NFS_V4":            LogEvent,
+		"FSAL":              LogInfo,
+	})
+	mgr := &LogMgr{
+		dbusObject: o,
+		reverts:    make(map[string]*logRevert),
+		mu:         &sync.Mutex{},
+	}
+	return mgr, o
+}
+
+// revertNow applies the pending revert of component.
+func revertNow(t *testing.T, mgr *LogMgr, component string) {
+	t.Helper()
+	mgr.mu.Lock()
+	r, ok := mgr.reverts[component]
+	mgr.mu.Unlock()
+	if !ok {
+		t.Fatalf("no pending revert for %s", component)
+	}
+	r.timer.Stop()
+	mgr.revert(r)
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    LogLevel
+		wantErr bool
+	}{
+		{s: "FULL_DEBUG", want: LogFullDebug},
+		{s: "debug", want: LogDebug},
+		{s: "NIV_EVENT", want: LogEvent},
+		{s: "niv_maj", want: LogMajor},
+		{s: "VERBOSE", wantErr: true},
+		{s: "NIV_", wantErr: true},
+		{s: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLogLevel(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLogLevel(%q) = %q, %v, want %q, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLogMgrUnknownComponent(t *testing.T) {
+
+	mgr, _ := newTestLogMgr()
+
+	if _, err := mgr.Level("NFS_V5"); err != ErrUnknownLogComponent {
+		t.Errorf("Level() error = %v, want %v", err, ErrUnknownLogComponent)
+	}
+	if err := mgr.SetLevel("NFS_V5", LogDebug, 0); err != ErrUnknownLogComponent {
+		t.Errorf("SetLevel() error = %v, want %v", err, ErrUnknownLogComponent)
+	}
+	if level, err := mgr.Level("nfs_v4"); err != nil || level != LogEvent {
+		t.Errorf("Level() = %q, %v, want %q", level, err, LogEvent)
+	}
+}
+
+func TestLogMgrRevert(t *testing.T) {
+
+	t.Run("component", func(t *testing.T) {
+		mgr, o := newTestLogMgr()
+
+		if err := mgr.SetLevel("nfs_v4", LogFullDebug, time.Hour); err != nil {
+			t.Fatalf("SetLevel() error = %v", err)
+		}
+		reverts := mgr.Reverts()
+		if len(reverts) != 1 || reverts[0].Component != "NFS_V4" || reverts[0].Level != LogEvent {
+			t.Fatalf("Reverts() = %+v, want NFS_V4 to EVENT", reverts)
+		}
+
+		revertNow(t, mgr, "NFS_V4")
+		want := map[string]LogLevel{"NFS_V4": LogEvent, "FSAL": LogInfo}
+		if got := o.levels(); !reflect.DeepEqual(got, want) {
+			t.Errorf("levels = %v, want %v", got, want)
+		}
+		if reverts := mgr.Reverts(); len(reverts) != 0 {
+			t.Errorf("Reverts() after revert = %+v, want none", reverts)
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		mgr, o := newTestLogMgr()
+
+		if err := mgr.SetLevel(DefaultLogComponent, LogDebug, time.Hour); err != nil {
+			t.Fatalf("SetLevel() error = %v", err)
+		}
+		if got := o.levels(); got["NFS_V4"] != LogDebug || got["FSAL"] != LogDebug {
+			t.Errorf("levels = %v, want all DEBUG", got)
+		}
+		var components []string
+		for _, r := range mgr.Reverts() {
+			components = append(components, r.Component)
+		}
+		if want := []string{"FSAL", "NFS_V4"}; !reflect.DeepEqual(components, want) {
+			t.Fatalf("reverts for %v, want %v", components, want)
+		}
+
+		revertNow(t, mgr, "FSAL")
+		revertNow(t, mgr, "NFS_V4")
+		want := map[string]LogLevel{"NFS_V4": LogEvent, "FSAL": LogInfo}
+		if got := o.levels(); !reflect.DeepEqual(got, want) {
+			t.Errorf("levels = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("replaced", func(t *testing.T) {
+		mgr, o := newTestLogMgr()
+
+		// A second temporary level reverts to the level before the first.
+		if err := mgr.SetLevel("NFS_V4", LogDebug, time.Hour); err != nil {
+			t.Fatalf("SetLevel() error = %v", err)
+		}
+		first := mgr.reverts["NFS_V4"]
+		if err := mgr.SetLevel("NFS_V4", LogFullDebug, 2*time.Hour); err != nil {
+			t.Fatalf("SetLevel() error = %v", err)
+		}
+		reverts := mgr.Reverts()
+		if len(reverts) != 1 || reverts[0].Level != LogEvent {
+			t.Fatalf("Reverts() = %+v, want NFS_V4 to EVENT", reverts)
+		}
+
+		// The replaced revert does nothing if its timer has already fired.
+		mgr.revert(first)
+		if got := o.levels()["NFS_V4"]; got != LogFullDebug {
+			t.Errorf("NFS_V4 after replaced revert = %q, want %q", got, LogFullDebug)
+		}
+
+		revertNow(t, mgr, "NFS_V4")
+		if got := o.levels()["NFS_V4"]; got != LogEvent {
+			t.Errorf("NFS_V4 = %q, want %q", got, LogEvent)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		mgr, o := newTestLogMgr()
+
+		if err := mgr.SetLevel("NFS_V4", LogDebug, time.Hour); err != nil {
+			t.Fatalf("SetLevel() error = %v", err)
+		}
+		pending := mgr.reverts["NFS_V4"]
+
+		// Setting a level without a ttl cancels the revert.
+		if err := mgr.SetLevel("NFS_V4", LogInfo, 0); err != nil {
+			t.Fatalf("SetLevel() error = %v", err)
+		}
+		if reverts := mgr.Reverts(); len(reverts) != 0 {
+			t.Errorf("Reverts() = %+v, want none", reverts)
+		}
+		mgr.revert(pending)
+		if got := o.levels()["NFS_V4"]; got != LogInfo {
+			t.Errorf("NFS_V4 = %q, want %q", got, LogInfo)
+		}
+	})
+}
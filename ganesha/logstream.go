@@ -0,0 +1,152 @@
+package ganesha
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/storageos/nfs/logger"
+)
+
+// logLineRE matches nfs-ganesha's default log format, e.g.:
+//
+//	17/10/2019 12:34:56 : epoch 5da86c40 : nfs-0 : ganesha.nfsd-1[main] nfs_start :NFS STARTUP :EVENT :Starting
+var logLineRE = regexp.MustCompile(`^(\S+ \S+) : epoch (\S+) : (\S+) : (.+?)-(\d+)\[([^\]]*)\] (\S+) :([^:]*) :([^:]*) :(.*)$`)
+
+// logTimeLayout is nfs-ganesha's default date and time format.
+const logTimeLayout = "02/01/2006 15:04:05"
+
+// LogEntry is a parsed nfs-ganesha log line.
+//
+// Lines that can't be parsed, such as output written directly to stderr, only
+// have Message set.
+type LogEntry struct {
+	Time      time.Time
+	Epoch     string
+	Host      string
+	Program   string
+	Pid       int
+	Thread    string
+	Function  string
+	Component string
+	Level     string
+	Message   string
+}
+
+// ParseLogLine parses an nfs-ganesha log line.  It returns false if the line
+// is not in nfs-ganesha's default format.
+func ParseLogLine(line string) (LogEntry, bool) {
+
+	m := logLineRE.FindStringSubmatch(line)
+	if m == nil {
+		return LogEntry{Message: line}, false
+	}
+
+	entry := LogEntry{
+		Epoch:     m[2],
+		Host:      m[3],
+		Program:   m[4],
+		Thread:    m[6],
+		Function:  m[7],
+		Component: strings.TrimSpace(m[8]),
+		Level:     strings.TrimSpace(m[9]),
+		Message:   m[10],
+	}
+	if t, err := time.ParseInLocation(logTimeLayout, m[1], time.Local); err == nil {
+		entry.Time = t
+	}
+	entry.Pid, _ = strconv.Atoi(m[5])
+	return entry, true
+}
+
+// LogKey identifies a count of nfs-ganesha log lines.
+type LogKey struct {
+	Component string
+	Level     string
+}
+
+// LogStream receives nfs-ganesha's log output, writing each line to the logger
+// with nfs-ganesha's own time and level.  nfs-ganesha's component, thread and
+// function are added as fields.  The parsed lines are counted by component and
+// level.
+//
+// Lines are written regardless of the logger's level, as nfs-ganesha filters
+// its own output.
+//
+// LogStream is an io.Writer so that it can be used as the output of the
+// nfs-ganesha process.  Partial lines are held until they are completed.
+type LogStream struct {
+	log *logger.Logger
+
+	// buf holds an incomplete line, and counts the number of lines parsed.
+	// They are protected by mu.
+	buf    []byte
+	counts map[LogKey]uint64
+	mu     *sync.Mutex
+}
+
+// NewLogStream returns a new LogStream writing to log.
+func NewLogStream(log *logger.Logger) *LogStream {
+	return &LogStream{
+		log:    log,
+		counts: make(map[LogKey]uint64),
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Write processes each complete line in p.
+func (s *LogStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(bytes.TrimRight(s.buf[:i], "\r"))
+		s.buf = s.buf[i+1:]
+		if line == "" {
+			continue
+		}
+		s.writeLine(line)
+	}
+	return len(p), nil
+}
+
+// writeLine parses, counts and writes a single line.  It must be called with
+// mu held.
+func (s *LogStream) writeLine(line string) {
+
+	entry, ok := ParseLogLine(line)
+	if !ok {
+		s.log.Record(time.Now(), logger.Info.String(), entry.Message)
+		return
+	}
+	s.counts[LogKey{Component: entry.Component, Level: entry.Level}]++
+
+	s.log.Record(entry.Time, entry.Level, entry.Message,
+		logger.Field{Key: "ganesha_component", Value: entry.Component},
+		logger.Field{Key: "thread", Value: entry.Thread},
+		logger.Field{Key: "function", Value: entry.Function},
+		logger.Field{Key: "host", Value: entry.Host},
+		logger.Field{Key: "pid", Value: entry.Pid},
+		logger.Field{Key: "epoch", Value: entry.Epoch},
+	)
+}
+
+// Counts returns the number of lines parsed by component and level.
+func (s *LogStream) Counts() map[LogKey]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[LogKey]uint64, len(s.counts))
+	for k, v := range s.counts {
+		counts[k] = v
+	}
+	return counts
+}
@@ -0,0 +1,108 @@
+package ganesha
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/storageos/nfs/logger"
+)
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   LogEntry
+		wantOK bool
+	}{
+		{
+			line: "17/10/2019 12:34:56 : epoch 5da86c40 : nfs-0 : ganesha.nfsd-1[main] nfs_start :NFS STARTUP :EVENT :Starting: Ganesha Version 2.8.2",
+			want: LogEntry{
+				Time:      time.Date(2019, 10, 17, 12, 34, 56, 0, time.Local),
+				Epoch:     "5da86c40",
+				Host:      "nfs-0",
+				Program:   "ganesha.nfsd",
+				Pid:       1,
+				Thread:    "main",
+				Function:  "nfs_start",
+				Component: "NFS STARTUP",
+				Level:     "EVENT",
+				Message:   "Starting: Ganesha Version 2.8.2",
+			},
+			wantOK: true,
+		},
+		{
+			line: "17/10/2019 12:35:01 : epoch 5da86c40 : nfs-0 : ganesha.nfsd-1[svc_12] nfs4_op_lock :NFS4 LOCK :CRIT :Lock failed",
+			want: LogEntry{
+				Time:      time.Date(2019, 10, 17, 12, 35, 1, 0, time.Local),
+				Epoch:     "5da86c40",
+				Host:      "nfs-0",
+				Program:   "ganesha.nfsd",
+				Pid:       1,
+				Thread:    "svc_12",
+				Function:  "nfs4_op_lock",
+				Component: "NFS4 LOCK",
+				Level:     "CRIT",
+				Message:   "Lock failed",
+			},
+			wantOK: true,
+		},
+		{
+			line:   "Segmentation fault",
+			want:   LogEntry{Message: "Segmentation fault"},
+			wantOK: false,
+		},
+	}
+	for _, tt := range tests {
+		got, ok := ParseLogLine(tt.line)
+		if ok != tt.wantOK {
+			t.Errorf("ParseLogLine(%q) ok = %v, want %v", tt.line, ok, tt.wantOK)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseLogLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestLogStream(t *testing.T) {
+
+	var out bytes.Buffer
+	log := logger.New(&out, logger.JSON, logger.Error).With(logger.NameKey, "pvc-1").With(logger.NamespaceKey, "default")
+	s := NewLogStream(log)
+
+	// Lines may be split across writes.
+	input := "17/10/2019 12:34:56 : epoch 5da86c40 : nfs-0 : ganesha.nfsd-1[main] nfs_start :NFS STARTUP :EVENT :Starting\n" +
+		"17/10/2019 12:34:57 : epoch 5da86c40 : nfs-0 : ganesha.nfsd-1[main] nfs_start :NFS STARTUP :EVENT :Started\n" +
+		"unparsed\n"
+	for _, part := range []string{input[:40], input[40:150], input[150:]} {
+		if _, err := s.Write([]byte(part)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %s", len(lines), out.String())
+	}
+	var first, last map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil {
+		t.Fatal(err)
+	}
+	// Lines are written regardless of the logger's level.
+	if first["msg"] != "Starting" || first["level"] != "EVENT" || first["ganesha_component"] != "NFS STARTUP" || first["name"] != "pvc-1" || first["namespace"] != "default" {
+		t.Errorf("unexpected first line: %s", lines[0])
+	}
+	if last["msg"] != "unparsed" || last["level"] != "info" || last["ganesha_component"] != nil {
+		t.Errorf("unexpected last line: %s", lines[2])
+	}
+
+	want := map[LogKey]uint64{{Component: "NFS STARTUP", Level: "EVENT"}: 2}
+	if got := s.Counts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Counts() = %v, want %v", got, want)
+	}
+}
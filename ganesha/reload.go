@@ -0,0 +1,229 @@
+package ganesha
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/storageos/nfs/config"
+	"github.com/storageos/nfs/logger"
+)
+
+// ReloadStats reports the outcome of configuration reloads.
+//
+// RestartRequired is set when the configuration file's settings outside the
+// exports differ from those the container was started with.  They only take
+// effect when the container is restarted, not when the Supervisor restarts the
+// server.
+type ReloadStats struct {
+	Succeeded       uint64
+	Failed          uint64
+	LastReloadTime  time.Time
+	LastSucceeded   bool
+	RestartRequired bool
+}
+
+// exportLoader loads exports from a configuration file into the running
+// server.  It is implemented by *ExportMgr.
+type exportLoader interface {
+	AddExport(path string, expr string) (string, error)
+	UpdateExport(path string, expr string) (string, error)
+	RemoveExport(id uint16) error
+}
+
+// Reloader applies changes to the configuration file to the running server.
+//
+// Exports that were added, removed or changed are applied individually, so a
+// problem with one export does not prevent the others from being updated.
+// Failed exports are retried on the next reload.
+//
+// Only the exports of the running configuration are updated.  Its other
+// settings remain those the server was started with.
+type Reloader struct {
+	exportMgr exportLoader
+	accessMgr *AccessMgr
+	path      string
+	log       *logger.Logger
+
+	// started holds the settings outside the exports that the server was
+	// started with.
+	started string
+
+	// running is the configuration shared with the other managers.
+	running *RunningConfig
+
+	// loaded is the configuration last applied from the file.  It and stats
+	// are protected by mu.
+	loaded *config.Config
+	stats  ReloadStats
+	mu     *sync.Mutex
+}
+
+// NewReloader returns a new Reloader for the configuration file at path, which
+// was loaded into the running configuration when the server was started.
+//
+// If accessMgr is set, clients it has denied remain denied after a reload.
+func NewReloader(exportMgr *ExportMgr, accessMgr *AccessMgr, path string, running *RunningConfig, log *logger.Logger) *Reloader {
+	return newReloader(exportMgr, accessMgr, path, running, log)
+}
+
+func newReloader(exportMgr exportLoader, accessMgr *AccessMgr, path string, running *RunningConfig, log *logger.Logger) *Reloader {
+	cfg := running.Get()
+	return &Reloader{
+		exportMgr: exportMgr,
+		accessMgr: accessMgr,
+		path:      path,
+		log:       log,
+		started:   settings(cfg),
+		running:   running,
+		loaded:    cfg,
+		mu:        &sync.Mutex{},
+	}
+}
+
+// Stats returns the current reload statistics.
+func (r *Reloader) Stats() ReloadStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// Reload reads and validates the configuration file, then applies the changed
+// exports to the running server.  The configuration is not applied if it is
+// invalid.
+func (r *Reloader) Reload() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := config.Load(r.path)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		r.record(false)
+		return fmt.Errorf("invalid config %s: %v", r.path, err)
+	}
+
+	r.stats.RestartRequired = settings(cfg) != r.started
+	if r.stats.RestartRequired {
+		r.log.Warnf("config %s changed settings outside the exports, the container must be restarted to apply them", r.path)
+	}
+
+	// Exports are applied with the running configuration held, so that other
+	// changes to the exports wait until the reload is complete.
+	var problems []string
+	r.running.Update(func(running *config.Config) error {
+		problems = r.apply(cfg, running)
+		return nil
+	})
+
+	if len(problems) > 0 {
+		r.record(false)
+		return fmt.Errorf("config %s partially applied: %s", r.path, strings.Join(problems, "; "))
+	}
+	r.record(true)
+	return nil
+}
+
+// apply applies the changes to the exports between the configuration last
+// loaded and cfg, recording the exports applied as running.  Changes made to
+// the exports at runtime are kept unless the file changes the same export.  Exports that fail
+// to apply keep their previous configuration, and the problems are returned.
+// It must be called with mu and the running configuration held.
+func (r *Reloader) apply(cfg *config.Config, running *config.Config) []string {
+
+	applied := cfg.Copy()
+	applied.Exports = nil
+	changed := make(map[uint16]bool)
+	var problems []string
+
+	for _, old := range r.loaded.Exports {
+		if cfg.Export(old.ExportID) != nil || running.Export(old.ExportID) == nil {
+			continue
+		}
+		if err := r.exportMgr.RemoveExport(old.ExportID); err != nil {
+			problems = append(problems, fmt.Sprintf("failed to remove export %d: %v", old.ExportID, err))
+			applied.Exports = append(applied.Exports, old)
+			continue
+		}
+		r.log.With(logger.ExportIDKey, old.ExportID).Infof("removed export")
+	}
+
+	for _, export := range cfg.Exports {
+		expr := ExportExpr(export.ExportID)
+		old := r.loaded.Export(export.ExportID)
+		switch {
+		case old != nil && exportString(old) == exportString(export):
+			// Unchanged.
+		case old == nil || running.Export(export.ExportID) == nil:
+			if _, err := r.exportMgr.AddExport(r.path, expr); err != nil {
+				problems = append(problems, fmt.Sprintf("failed to add export %d: %v", export.ExportID, err))
+				continue
+			}
+			r.log.With(logger.ExportIDKey, export.ExportID).Infof("added export")
+			changed[export.ExportID] = true
+		default:
+			if _, err := r.exportMgr.UpdateExport(r.path, expr); err != nil {
+				problems = append(problems, fmt.Sprintf("failed to update export %d: %v", export.ExportID, err))
+				applied.Exports = append(applied.Exports, old)
+				continue
+			}
+			r.log.With(logger.ExportIDKey, export.ExportID).Infof("updated export")
+			changed[export.ExportID] = true
+		}
+		applied.Exports = append(applied.Exports, export)
+	}
+
+	// Exports the file left unchanged keep the configuration they are running
+	// with, and exports added at runtime are kept.  Those removed at runtime
+	// are added again only if the file changes them.
+	var exports []*config.Export
+	for _, export := range applied.Exports {
+		if changed[export.ExportID] {
+			exports = append(exports, export)
+		} else if current := running.Export(export.ExportID); current != nil {
+			exports = append(exports, current)
+		}
+	}
+	for _, export := range running.Exports {
+		if r.loaded.Export(export.ExportID) == nil && applied.Export(export.ExportID) == nil {
+			exports = append(exports, export)
+		}
+	}
+
+	r.loaded = applied
+	running.Exports = exports
+	if r.accessMgr != nil {
+		if err := r.accessMgr.restore(running); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// record updates the stats with the outcome of a reload.  It must be called
+// with mu held.
+func (r *Reloader) record(ok bool) {
+	if ok {
+		r.stats.Succeeded++
+	} else {
+		r.stats.Failed++
+	}
+	r.stats.LastReloadTime = time.Now()
+	r.stats.LastSucceeded = ok
+}
+
+// settings returns the configuration without its exports, in nfs-ganesha
+// format.
+func settings(cfg *config.Config) string {
+	c := cfg.Copy()
+	c.Exports = nil
+	return c.String()
+}
+
+// exportString returns the export in nfs-ganesha format.
+func exportString(export *config.Export) string {
+	return (&config.Config{Exports: []*config.Export{export}}).String()
+}
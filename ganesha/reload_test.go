@@ -0,0 +1,199 @@
+package ganesha
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/storageos/nfs/config"
+)
+
+// fakeLoader records the export changes made, failing those in errs.
+type fakeLoader struct {
+	calls []string
+	errs  map[string]error
+}
+
+func (f *fakeLoader) call(call string) error {
+	f.calls = append(f.calls, call)
+	return f.errs[call]
+}
+
+func (f *fakeLoader) AddExport(path string, expr string) (string, error) {
+	return "", f.call("add " + expr)
+}
+
+func (f *fakeLoader) UpdateExport(path string, expr string) (string, error) {
+	return "", f.call("update " + expr)
+}
+
+func (f *fakeLoader) RemoveExport(id uint16) error {
+	return f.call(fmt.Sprintf("remove %d", id))
+}
+
+// testExport returns an export block with the given id and access type.
+func testExport(id int, access string) string {
+	return fmt.Sprintf("EXPORT {\n Export_Id = %d;\n Path = /export/%d;\n Pseudo = /%d;\n Access_Type = %s;\n FSAL {\n  Name = VFS;\n }\n}\n", id, id, id, access)
+}
+
+func TestReload(t *testing.T) {
+
+	initial := testExport(1, "RW") + testExport(2, "RW")
+
+	tests := []struct {
+		name          string
+		config        string
+		errs          map[string]error
+		wantCalls     []string
+		wantErr       bool
+		wantExports   map[uint16]string
+		wantRestart   bool
+		wantSucceeded uint64
+		wantFailed    uint64
+	}{
+		{
+			name:          "unchanged",
+			config:        initial,
+			wantExports:   map[uint16]string{1: "RW", 2: "RW"},
+			wantSucceeded: 1,
+		},
+		{
+			name:          "add, update and remove",
+			config:        testExport(1, "RO") + testExport(3, "RW"),
+			wantCalls:     []string{"remove 2", "update " + ExportExpr(1), "add " + ExportExpr(3)},
+			wantExports:   map[uint16]string{1: "RO", 3: "RW"},
+			wantSucceeded: 1,
+		},
+		{
+			name:        "failed exports keep their configuration",
+			config:      testExport(1, "RO") + testExport(3, "RW"),
+			errs:        map[string]error{"remove 2": errors.New("busy"), "update " + ExportExpr(1): errors.New("failed"), "add " + ExportExpr(3): errors.New("failed")},
+			wantCalls:   []string{"remove 2", "update " + ExportExpr(1), "add " + ExportExpr(3)},
+			wantErr:     true,
+			wantExports: map[uint16]string{1: "RW", 2: "RW"},
+			wantFailed:  1,
+		},
+		{
+			name:        "invalid",
+			config:      testExport(1, "RW") + testExport(1, "RO"),
+			wantErr:     true,
+			wantExports: map[uint16]string{1: "RW", 2: "RW"},
+			wantFailed:  1,
+		},
+		{
+			name:          "settings changed",
+			config:        "NFSV4 {\n Lease_Lifetime = 30;\n}\n" + initial,
+			wantExports:   map[uint16]string{1: "RW", 2: "RW"},
+			wantRestart:   true,
+			wantSucceeded: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			dir, err := ioutil.TempDir("", "reload")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "ganesha.conf")
+
+			cfg, err := config.ParseString(initial)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			loader := &fakeLoader{errs: tt.errs}
+			running := NewRunningConfig(cfg)
+			r := newReloader(loader, nil, path, running, nil)
+
+			if err := r.Reload(); (err != nil) != tt.wantErr {
+				t.Errorf("Reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(loader.calls, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", loader.calls, tt.wantCalls)
+			}
+			exports := make(map[uint16]string)
+			for _, export := range running.Get().Exports {
+				exports[export.ExportID] = export.AccessType
+			}
+			if !reflect.DeepEqual(exports, tt.wantExports) {
+				t.Errorf("running exports = %v, want %v", exports, tt.wantExports)
+			}
+			stats := r.Stats()
+			if stats.RestartRequired != tt.wantRestart || stats.Succeeded != tt.wantSucceeded || stats.Failed != tt.wantFailed {
+				t.Errorf("Stats() = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestReloadKeepsRuntimeChanges(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ganesha.conf")
+
+	initial := testExport(1, "RW") + testExport(2, "RW")
+	cfg, err := config.ParseString(initial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader := &fakeLoader{}
+	running := NewRunningConfig(cfg)
+	r := newReloader(loader, nil, path, running, nil)
+
+	// Export 1 is updated, 2 removed and 3 added at runtime.
+	m := newExportConfigMgr(&fakeLoader{}, nil, running, dir)
+	if _, err := m.UpdateExport(mustParseExport(t, 1, "RO")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveExport(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddExport(mustParseExport(t, 3, "RW")); err != nil {
+		t.Fatal(err)
+	}
+
+	reload := func(content string) map[uint16]string {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Reload(); err != nil {
+			t.Fatalf("Reload() error = %v", err)
+		}
+		exports := make(map[uint16]string)
+		for _, export := range running.Get().Exports {
+			exports[export.ExportID] = export.AccessType
+		}
+		return exports
+	}
+
+	if got, want := reload(initial), map[uint16]string{1: "RO", 3: "RW"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unchanged file: running exports = %v, want %v", got, want)
+	}
+	if len(loader.calls) != 0 {
+		t.Errorf("unchanged file: calls = %q, want none", loader.calls)
+	}
+
+	// Exports the file changes are applied from the file.
+	got := reload(testExport(1, "MDONLY") + testExport(2, "RO"))
+	if want := map[uint16]string{1: "MDONLY", 2: "RO", 3: "RW"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changed file: running exports = %v, want %v", got, want)
+	}
+	wantCalls := []string{"update " + ExportExpr(1), "add " + ExportExpr(2)}
+	if !reflect.DeepEqual(loader.calls, wantCalls) {
+		t.Errorf("changed file: calls = %q, want %q", loader.calls, wantCalls)
+	}
+}
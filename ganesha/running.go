@@ -0,0 +1,59 @@
+package ganesha
+
+import (
+	"sync"
+
+	"github.com/storageos/nfs/config"
+)
+
+// RunningConfig holds the configuration the server is running with.  It is
+// shared by the managers that change the running exports, and serialises their
+// changes.
+type RunningConfig struct {
+	// config is protected by mu.
+	config *config.Config
+	mu     *sync.Mutex
+
+	// onUpdate, if set, is called after each update.
+	onUpdate func(cfg *config.Config)
+}
+
+// NewRunningConfig returns a RunningConfig holding a copy of cfg.
+func NewRunningConfig(cfg *config.Config) *RunningConfig {
+	return &RunningConfig{
+		config: cfg.Copy(),
+		mu:     &sync.Mutex{},
+	}
+}
+
+// OnUpdate sets fn to be called with the running configuration after each
+// update, whether or not it succeeded, for example to save it for restarts.  fn
+// is called with the running configuration held and must not change it.
+//
+// OnUpdate must be called before the RunningConfig is shared.
+func (r *RunningConfig) OnUpdate(fn func(cfg *config.Config)) {
+	r.onUpdate = fn
+}
+
+// Get returns a copy of the running configuration.
+func (r *RunningConfig) Get() *config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.config.Copy()
+}
+
+// Update calls fn with the running configuration, which fn may change.  No
+// other changes are made until fn returns.
+//
+// Copies returned by Get share the exports and settings blocks, so fn must
+// replace those it changes rather than modify them in place.
+func (r *RunningConfig) Update(fn func(cfg *config.Config) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := fn(r.config)
+	if r.onUpdate != nil {
+		r.onUpdate(r.config)
+	}
+	return err
+}
@@ -1,6 +1,11 @@
 package ganesha
 
-import "golang.org/x/sys/unix"
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
 
 // BasicIO stores the basic statistics for NFS operations.  Each field is a
 // counter that is reset when the NFS server is started or when the NFS server
@@ -45,3 +50,116 @@ type ExportIOStats struct {
 	Read     BasicIO
 	Write    BasicIO
 }
+
+// V4OpStats contains the stats for a single NFSv4 operation, such as OPEN or
+// GETATTR.
+//
+// Latencies are in milliseconds.  Latency is the average over all operations
+// since the stats were enabled or reset.
+type V4OpStats struct {
+	Op         string
+	Total      uint64
+	Errors     uint64
+	Latency    float64
+	MinLatency float64
+	MaxLatency float64
+}
+
+// FullV4Stats is the response to the full NFSv4 stats call.  Only operations
+// that have been used are reported.
+//
+// Full NFSv4 stats are disabled by default.  Status is false with an error
+// message if they have not been enabled.
+type FullV4Stats struct {
+	StatsBaseAnswer
+	Ops []V4OpStats
+}
+
+// OPSStats is the response to the global and total operations calls.
+//
+// Ops holds the number of operations keyed by protocol, e.g. NFSv3, NFSv4,
+// NLM, MNT or QUOTA.  The protocols reported depend on those Ganesha was built
+// with.
+type OPSStats struct {
+	StatsBaseAnswer
+	Ops map[string]uint64
+}
+
+// FSALOpStats contains the stats for a single FSAL operation.  Latencies are
+// in milliseconds and are zero if not reported by the FSAL.
+type FSALOpStats struct {
+	Op         string
+	Total      uint64
+	Latency    float64
+	MinLatency float64
+	MaxLatency float64
+}
+
+// FSALStats is the response to the FSAL stats call.  The operations reported
+// are specific to the FSAL.  Status is false with an error message if the FSAL
+// does not support stats or they have not been enabled.
+type FSALStats struct {
+	StatsBaseAnswer
+	Ops []FSALOpStats
+}
+
+// MDCacheStats is the response to the MDCACHE stats call.
+//
+// Values holds the numeric values reported, keyed by their description in
+// lower case with spaces replaced by underscores, e.g. `fsal_opened_files` or
+// `entries_used`.
+type MDCacheStats struct {
+	StatsBaseAnswer
+	Values map[string]float64
+}
+
+// StatsType is a type of stats that can be enabled or disabled at runtime.
+type StatsType string
+
+// Stats types understood by Ganesha.  NFS and FSAL stats are enabled by
+// default.  The others are more expensive to collect and are disabled by
+// default.
+const (
+	StatsAll          StatsType = "all"
+	StatsNFS          StatsType = "nfs"
+	StatsFSAL         StatsType = "fsal"
+	StatsV3Full       StatsType = "v3_full"
+	StatsV4Full       StatsType = "v4_full"
+	StatsAuth         StatsType = "auth"
+	StatsClientAllOps StatsType = "client_all_ops"
+)
+
+// statsAliases maps alternative names to stats types.  Ganesha does not
+// separate NFSv3 and NFSv4 basic stats.
+var statsAliases = map[string]StatsType{
+	"nfsv3":       StatsNFS,
+	"nfsv4":       StatsNFS,
+	"clnt_allops": StatsClientAllOps,
+}
+
+// ParseStatsType returns the StatsType for s, or an error if it is not known.
+func ParseStatsType(s string) (StatsType, error) {
+	s = strings.ToLower(s)
+	if t, ok := statsAliases[s]; ok {
+		return t, nil
+	}
+	switch t := StatsType(s); t {
+	case StatsAll, StatsNFS, StatsFSAL, StatsV3Full, StatsV4Full, StatsAuth, StatsClientAllOps:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown stats type %q", s)
+}
+
+// OpCount contains the number of times an operation was made and how many of
+// those failed.
+type OpCount struct {
+	Op     string
+	Total  uint64
+	Errors uint64
+}
+
+// ClientAllOps is the response to the client all-ops stats call.
+type ClientAllOps struct {
+	StatsBaseAnswer
+	Ops []OpCount
+}
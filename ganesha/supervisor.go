@@ -0,0 +1,331 @@
+package ganesha
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/storageos/nfs/logger"
+)
+
+// SupervisorConfig controls how the Supervisor restarts nfs-ganesha.
+type SupervisorConfig struct {
+	// InitialBackoff is the delay before the first restart.  It doubles after
+	// each consecutive failure, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// MaxRestarts is the crash-loop budget: the number of restarts allowed
+	// within RestartWindow before the Supervisor gives up.  Set to 0 to
+	// disable restarts.
+	MaxRestarts   int
+	RestartWindow time.Duration
+
+	// ReadyTimeout is how long to wait for heartbeats after a restart.
+	ReadyTimeout time.Duration
+
+	// RestartConfig, if set, is the configuration file used when restarting
+	// the process.
+	RestartConfig string
+
+	// GraceOnRestart puts the server into its NFSv4 grace period once it is
+	// ready after a restart, so that clients can reclaim their opens and locks
+	// before other clients are granted conflicting state.  The restart
+	// configuration must not set `Graceless = true`, as Ganesha then ignores
+	// requests to start grace.
+	GraceOnRestart bool
+}
+
+// DefaultSupervisorConfig allows 5 restarts within 10 minutes.
+var DefaultSupervisorConfig = SupervisorConfig{
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	MaxRestarts:    5,
+	RestartWindow:  10 * time.Minute,
+	ReadyTimeout:   30 * time.Second,
+}
+
+// SupervisorStats reports the restart history of the supervised process.
+type SupervisorStats struct {
+	Restarts     uint64
+	LastExitCode int
+	LastExitTime time.Time
+}
+
+// supervised is the process run by the Supervisor.  It is implemented by
+// *Ganesha.
+type supervised interface {
+	Run() (<-chan error, error)
+	Close(ctx context.Context)
+	SetConfig(config string)
+	IsReady(ctx context.Context) bool
+	InGrace() (bool, error)
+	StartGrace(ip string) error
+}
+
+// clock is the Supervisor's source of time, replaced in tests.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock uses the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Supervisor runs nfs-ganesha, restarting it with exponential backoff if it
+// exits unexpectedly.
+//
+// The Supervisor gives up once the crash-loop budget has been used, allowing
+// the orchestrator to restart the container.
+type Supervisor struct {
+	nfs   supervised
+	cfg   SupervisorConfig
+	clock clock
+	log   *logger.Logger
+
+	// stats and restarts are protected by mu.  restarts holds the time of each
+	// restart within the current window.
+	stats    SupervisorStats
+	restarts []time.Time
+	mu       *sync.RWMutex
+
+	// stopCh is closed by Close.  It is closed, and restarts are started,
+	// with runMu held, so that the process is not restarted once closed.
+	stopCh   chan struct{}
+	stopOnce *sync.Once
+	runMu    *sync.Mutex
+}
+
+// NewSupervisor returns a new Supervisor for the nfs-ganesha process.
+func NewSupervisor(nfs *Ganesha, cfg SupervisorConfig, log *logger.Logger) *Supervisor {
+	return newSupervisor(nfs, cfg, realClock{}, log)
+}
+
+func newSupervisor(nfs supervised, cfg SupervisorConfig, clock clock, log *logger.Logger) *Supervisor {
+	return &Supervisor{
+		nfs:      nfs,
+		cfg:      cfg,
+		clock:    clock,
+		log:      log,
+		mu:       &sync.RWMutex{},
+		stopCh:   make(chan struct{}),
+		stopOnce: &sync.Once{},
+		runMu:    &sync.Mutex{},
+	}
+}
+
+// Run starts the nfs-ganesha process, returning an immediate error and nil
+// channel if the process cannot be started.
+//
+// If the process exits it is restarted.  Once the crash-loop budget is
+// exhausted, the returned channel will have the last exit error pushed to it.
+//
+// Once the Supervisor has been closed and the process stops, the returned
+// channel is closed.
+func (s *Supervisor) Run() (<-chan error, error) {
+
+	exitCh, err := s.nfs.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	// The exit error is buffered so that it is not lost, and supervise does
+	// not block, if the caller has stopped receiving.
+	errCh := make(chan error, 1)
+	go s.supervise(exitCh, errCh)
+
+	return errCh, nil
+}
+
+// Close stops restarting nfs-ganesha and closes the process.
+func (s *Supervisor) Close(ctx context.Context) {
+	s.runMu.Lock()
+	s.stopOnce.Do(func() { close(s.stopCh) })
+	s.runMu.Unlock()
+
+	s.nfs.Close(ctx)
+}
+
+// Stats returns the current restart statistics.
+func (s *Supervisor) Stats() SupervisorStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stats
+}
+
+// supervise waits for the process to exit and restarts it until the budget is
+// exhausted or the Supervisor is closed.
+func (s *Supervisor) supervise(exitCh <-chan error, errCh chan<- error) {
+
+	backoff := s.cfg.InitialBackoff
+	started := s.clock.Now()
+
+	for {
+		// A closed channel returns nil, indicating a clean exit.
+		err := <-exitCh
+
+		if s.stopping() {
+			close(errCh)
+			return
+		}
+
+		ran := s.clock.Now().Sub(started)
+		s.recordExit(err)
+		s.log.Errorf("nfs server exited after %s: %v", ran.Round(time.Second), err)
+
+		// Processes that ran for the whole window restart from the initial
+		// backoff.
+		if ran > s.cfg.RestartWindow {
+			backoff = s.cfg.InitialBackoff
+		}
+
+		if !s.allowRestart() {
+			if err == nil {
+				err = fmt.Errorf("nfs server exited")
+			}
+			errCh <- fmt.Errorf("restart budget of %d in %s exhausted: %v", s.cfg.MaxRestarts, s.cfg.RestartWindow, err)
+			return
+		}
+
+		s.log.Infof("restarting nfs server in %s", backoff)
+		select {
+		case <-s.stopCh:
+			close(errCh)
+			return
+		case <-s.clock.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.cfg.MaxBackoff {
+			backoff = s.cfg.MaxBackoff
+		}
+
+		if s.cfg.RestartConfig != "" {
+			s.nfs.SetConfig(s.cfg.RestartConfig)
+		}
+
+		// Close may have been called since the backoff.  If so, the process
+		// must not be started as Close won't stop it.
+		s.runMu.Lock()
+		if s.stopping() {
+			s.runMu.Unlock()
+			close(errCh)
+			return
+		}
+		started = s.clock.Now()
+		ch, err := s.nfs.Run()
+		s.runMu.Unlock()
+		if err != nil {
+			// Treat a failure to start as an immediate exit.
+			failed := make(chan error, 1)
+			failed <- err
+			exitCh = failed
+			continue
+		}
+		exitCh = ch
+
+		if s.waitForReady() && s.cfg.GraceOnRestart {
+			s.startGrace()
+		}
+	}
+}
+
+// waitForReady waits for nfs-ganesha to send heartbeats after a restart.
+// Failure is logged only; if the process has exited it will be restarted.
+func (s *Supervisor) waitForReady() bool {
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ReadyTimeout)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-s.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if s.nfs.IsReady(ctx) {
+		s.log.Infof("nfs server ready after restart")
+		return true
+	}
+	s.log.Warnf("nfs server not ready within %s of restart", s.cfg.ReadyTimeout)
+	return false
+}
+
+// startGrace puts the restarted server into its grace period, unless it
+// already entered grace on startup.  Failure is logged only.
+func (s *Supervisor) startGrace() {
+
+	inGrace, err := s.nfs.InGrace()
+	if err == nil && inGrace {
+		s.log.Infof("nfs server in grace period after restart")
+		return
+	}
+	if err := s.nfs.StartGrace(""); err != nil {
+		s.log.Errorf("failed to start grace period after restart: %v", err)
+		return
+	}
+	s.log.Infof("started nfs server grace period after restart")
+}
+
+// recordExit updates the stats with the exit status of the process.
+func (s *Supervisor) recordExit(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.LastExitCode = exitCode(err)
+	s.stats.LastExitTime = s.clock.Now()
+}
+
+// allowRestart returns true and records a restart if the crash-loop budget
+// allows it.
+func (s *Supervisor) allowRestart() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop restarts that have fallen out of the window.
+	now := s.clock.Now()
+	recent := s.restarts[:0]
+	for _, t := range s.restarts {
+		if now.Sub(t) < s.cfg.RestartWindow {
+			recent = append(recent, t)
+		}
+	}
+	s.restarts = recent
+
+	if len(s.restarts) >= s.cfg.MaxRestarts {
+		return false
+	}
+	s.restarts = append(s.restarts, now)
+	s.stats.Restarts++
+	return true
+}
+
+// stopping returns true once Close has been called.
+func (s *Supervisor) stopping() bool {
+	select {
+	case <-s.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// exitCode returns the process exit code for an error returned from Run.  0 is
+// returned for a clean exit and -1 if the exit code is not known, for example
+// when the process was killed by a signal or failed to start.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
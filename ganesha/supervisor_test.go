@@ -0,0 +1,332 @@
+package ganesha
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProcess sends the exit channel of each run to runs, so that the test
+// can decide when the process exits.
+type fakeProcess struct {
+	runs chan chan<- error
+
+	// config is the config set for the next run, and configs the config used
+	// by each run.  They are protected by mu.
+	config  string
+	configs []string
+	graces  int
+	mu      *sync.Mutex
+}
+
+func newFakeProcess(config string) *fakeProcess {
+	return &fakeProcess{
+		runs:   make(chan chan<- error, 10),
+		config: config,
+		mu:     &sync.Mutex{},
+	}
+}
+
+func (p *fakeProcess) Run() (<-chan error, error) {
+	p.mu.Lock()
+	p.configs = append(p.configs, p.config)
+	p.mu.Unlock()
+
+	ch := make(chan error, 1)
+	p.runs <- ch
+	return ch, nil
+}
+
+func (p *fakeProcess) Close(ctx context.Context) {}
+
+func (p *fakeProcess) SetConfig(config string) {
+	p.mu.Lock()
+	p.config = config
+	p.mu.Unlock()
+}
+
+func (p *fakeProcess) IsReady(ctx context.Context) bool { return true }
+
+func (p *fakeProcess) InGrace() (bool, error) { return false, nil }
+
+func (p *fakeProcess) StartGrace(ip string) error {
+	p.mu.Lock()
+	p.graces++
+	p.mu.Unlock()
+	return nil
+}
+
+// next waits for the process to be run again.
+func (p *fakeProcess) next(t *testing.T) chan<- error {
+	t.Helper()
+	select {
+	case ch := <-p.runs:
+		return ch
+	case <-time.After(5 * time.Second):
+		t.Fatal("process not restarted")
+		return nil
+	}
+}
+
+// fakeClock records each backoff and returns immediately, advancing the time
+// by the backoff.
+type fakeClock struct {
+	now     time.Time
+	backoff []time.Duration
+	mu      *sync.Mutex
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now: time.Date(2019, 10, 17, 12, 0, 0, 0, time.UTC),
+		mu:  &sync.Mutex{},
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backoff = append(c.backoff, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func (c *fakeClock) Backoff() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.backoff...)
+}
+
+// blockedClock never ends a backoff, reporting each backoff started on
+// waiting.
+type blockedClock struct {
+	*fakeClock
+	waiting chan time.Duration
+}
+
+func (c *blockedClock) After(d time.Duration) <-chan time.Time {
+	c.waiting <- d
+	return make(chan time.Time)
+}
+
+var testSupervisorConfig = SupervisorConfig{
+	InitialBackoff: time.Second,
+	MaxBackoff:     3 * time.Second,
+	MaxRestarts:    3,
+	RestartWindow:  10 * time.Minute,
+	ReadyTimeout:   time.Second,
+}
+
+// waitExhausted waits for the Supervisor to give up.
+func waitExhausted(t *testing.T, errCh <-chan error) {
+	t.Helper()
+	select {
+	case err, ok := <-errCh:
+		if !ok || err == nil {
+			t.Errorf("got %v, %v from Run channel, want budget error", err, ok)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("restart budget not exhausted")
+	}
+}
+
+func TestSupervisorBudget(t *testing.T) {
+
+	nfs := newFakeProcess("ganesha.conf")
+	clock := newFakeClock()
+	s := newSupervisor(nfs, testSupervisorConfig, clock, nil)
+
+	errCh, err := s.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// Crash immediately until the budget is used.
+	for i := 0; i <= testSupervisorConfig.MaxRestarts; i++ {
+		nfs.next(t) <- errors.New("crashed")
+	}
+	waitExhausted(t, errCh)
+
+	want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	if got := clock.Backoff(); !reflect.DeepEqual(got, want) {
+		t.Errorf("backoff = %v, want %v", got, want)
+	}
+	stats := s.Stats()
+	if stats.Restarts != 3 || stats.LastExitCode != -1 || !stats.LastExitTime.Equal(clock.Now()) {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestSupervisorWindow(t *testing.T) {
+
+	cfg := testSupervisorConfig
+	cfg.MaxRestarts = 1
+
+	nfs := newFakeProcess("ganesha.conf")
+	clock := newFakeClock()
+	s := newSupervisor(nfs, cfg, clock, nil)
+
+	errCh, err := s.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	nfs.next(t) <- errors.New("crashed")
+
+	// The restart falls out of the window while the process runs, so another
+	// restart is allowed, starting from the initial backoff.
+	exit := nfs.next(t)
+	clock.Advance(cfg.RestartWindow + time.Minute)
+	exit <- errors.New("crashed")
+
+	nfs.next(t) <- errors.New("crashed")
+	waitExhausted(t, errCh)
+
+	want := []time.Duration{time.Second, time.Second}
+	if got := clock.Backoff(); !reflect.DeepEqual(got, want) {
+		t.Errorf("backoff = %v, want %v", got, want)
+	}
+	if got := s.Stats().Restarts; got != 2 {
+		t.Errorf("Stats().Restarts = %d, want 2", got)
+	}
+}
+
+func TestSupervisorClose(t *testing.T) {
+
+	nfs := newFakeProcess("ganesha.conf")
+	s := newSupervisor(nfs, testSupervisorConfig, newFakeClock(), nil)
+
+	errCh, err := s.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	exit := nfs.next(t)
+	s.Close(context.Background())
+	close(exit)
+
+	select {
+	case err, ok := <-errCh:
+		if ok {
+			t.Errorf("got %v from Run channel, want closed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run channel not closed")
+	}
+	if got := s.Stats().Restarts; got != 0 {
+		t.Errorf("Stats().Restarts = %d, want 0", got)
+	}
+}
+
+func TestSupervisorCloseDuringBackoff(t *testing.T) {
+
+	nfs := newFakeProcess("ganesha.conf")
+	clock := &blockedClock{fakeClock: newFakeClock(), waiting: make(chan time.Duration, 1)}
+	s := newSupervisor(nfs, testSupervisorConfig, clock, nil)
+
+	errCh, err := s.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	nfs.next(t) <- errors.New("crashed")
+	select {
+	case <-clock.waiting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("restart backoff not started")
+	}
+	s.Close(context.Background())
+
+	select {
+	case err, ok := <-errCh:
+		if ok {
+			t.Errorf("got %v from Run channel, want closed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run channel not closed")
+	}
+	nfs.mu.Lock()
+	defer nfs.mu.Unlock()
+	if len(nfs.configs) != 1 {
+		t.Errorf("process run %d times, want 1", len(nfs.configs))
+	}
+}
+
+func TestSupervisorRestartConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		restartConfig  string
+		graceOnRestart bool
+		wantConfigs    []string
+		wantGraces     int
+	}{
+		{
+			name:        "defaults",
+			wantConfigs: []string{"ganesha.conf", "ganesha.conf", "ganesha.conf"},
+		},
+		{
+			name:          "restart config",
+			restartConfig: "restart.conf",
+			wantConfigs:   []string{"ganesha.conf", "restart.conf", "restart.conf"},
+		},
+		{
+			name:           "grace on restart",
+			restartConfig:  "restart.conf",
+			graceOnRestart: true,
+			wantConfigs:    []string{"ganesha.conf", "restart.conf", "restart.conf"},
+			wantGraces:     2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			cfg := testSupervisorConfig
+			cfg.RestartConfig = tt.restartConfig
+			cfg.GraceOnRestart = tt.graceOnRestart
+
+			nfs := newFakeProcess("ganesha.conf")
+			s := newSupervisor(nfs, cfg, newFakeClock(), nil)
+
+			errCh, err := s.Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			// Grace is only started after restarts, which have completed once
+			// the Supervisor has stopped.
+			nfs.next(t) <- errors.New("crashed")
+			nfs.next(t) <- errors.New("crashed")
+			exit := nfs.next(t)
+			s.Close(context.Background())
+			close(exit)
+			for range errCh {
+			}
+
+			nfs.mu.Lock()
+			defer nfs.mu.Unlock()
+			if !reflect.DeepEqual(nfs.configs, tt.wantConfigs) {
+				t.Errorf("configs = %q, want %q", nfs.configs, tt.wantConfigs)
+			}
+			if nfs.graces != tt.wantGraces {
+				t.Errorf("graces started = %d, want %d", nfs.graces, tt.wantGraces)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package ganesha
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+	nfsdbus "github.com/storageos/nfs/dbus"
+)
+
+// ClientEventType is the type of a client lifecycle event.
+type ClientEventType string
+
+// Client lifecycle events.
+const (
+	// ClientConnected is sent when a client is first seen.
+	ClientConnected ClientEventType = "connected"
+
+	// ClientProtocolAdded is sent when a known client starts using another
+	// protocol.
+	ClientProtocolAdded ClientEventType = "protocol_added"
+
+	// ClientIdle is sent when a client has had no activity for the idle
+	// timeout.
+	ClientIdle ClientEventType = "idle"
+
+	// ClientActive is sent when an idle client has activity again.
+	ClientActive ClientEventType = "active"
+
+	// ClientGone is sent when Ganesha no longer reports a client.
+	ClientGone ClientEventType = "gone"
+)
+
+// clientEventHistory is the number of recent events kept for new subscribers.
+const clientEventHistory = 256
+
+// ClientEvent describes a change in a client's connection.
+type ClientEvent struct {
+	Type   ClientEventType `json:"type"`
+	Time   time.Time       `json:"time"`
+	Client string          `json:"client"`
+
+	// Protocols lists the protocols the client has used.  Protocol is set to
+	// the new protocol for ClientProtocolAdded events.
+	Protocols []string `json:"protocols,omitempty"`
+	Protocol  string   `json:"protocol,omitempty"`
+
+	// LastActive is the time of the client's last recorded activity.
+	LastActive time.Time `json:"last_active"`
+}
+
+// Protocols returns the names of the protocols the client has used.
+func (c Client) Protocols() []string {
+	var protocols []string
+	for _, p := range []struct {
+		name string
+		used bool
+	}{
+		{"NFSv3", c.NFSv3},
+		{"MNTv3", c.MNTv3},
+		{"NLMv4", c.NLMv4},
+		{"RQUOTA", c.RQUOTA},
+		{"NFSv40", c.NFSv40},
+		{"NFSv41", c.NFSv41},
+		{"NFSv42", c.NFSv42},
+		{"9P", c.Plan9},
+	} {
+		if p.used {
+			protocols = append(protocols, p.name)
+		}
+	}
+	return protocols
+}
+
+// watchedClient is the last known state of a client.
+type watchedClient struct {
+	client Client
+	idle   bool
+}
+
+// ClientWatcher polls Ganesha's client list and sends lifecycle events to
+// subscribers.
+//
+// Ganesha does not currently publish client signals, but any signal on the
+// clientmgr interface triggers an immediate poll so that future versions are
+// picked up without waiting for the poll interval.
+type ClientWatcher struct {
+	clientMgr   *ClientMgr
+	conn        *nfsdbus.Conn
+	interval    time.Duration
+	idleTimeout time.Duration
+
+	// clients is only accessed by Run.
+	clients map[string]*watchedClient
+
+	// subscribers and history are protected by mu.
+	subscribers map[chan ClientEvent]struct{}
+	history     []ClientEvent
+	mu          *sync.Mutex
+
+	// done is closed when Run returns.
+	done chan struct{}
+}
+
+// NewClientWatcher returns a new ClientWatcher that polls the client list every
+// interval.  Clients with no activity for idleTimeout are reported as idle.
+//
+// Signals are received on the shared system bus connection.
+func NewClientWatcher(clientMgr *ClientMgr, conn *nfsdbus.Conn, interval time.Duration, idleTimeout time.Duration) *ClientWatcher {
+	return &ClientWatcher{
+		clientMgr:   clientMgr,
+		conn:        conn,
+		interval:    interval,
+		idleTimeout: idleTimeout,
+		clients:     make(map[string]*watchedClient),
+		subscribers: make(map[chan ClientEvent]struct{}),
+		mu:          &sync.Mutex{},
+		done:        make(chan struct{}),
+	}
+}
+
+// Subscribe returns a channel that receives client events, starting with the
+// most recent events already sent.  Events are dropped if the subscriber does
+// not keep up.
+//
+// The returned func must be called to unsubscribe.  The channel is not closed.
+func (w *ClientWatcher) Subscribe() (<-chan ClientEvent, func()) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ch := make(chan ClientEvent, clientEventHistory+64)
+	for _, event := range w.history {
+		ch <- event
+	}
+	w.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		w.mu.Lock()
+		delete(w.subscribers, ch)
+		w.mu.Unlock()
+	}
+}
+
+// Done returns a channel that is closed once Run has returned.
+func (w *ClientWatcher) Done() <-chan struct{} {
+	return w.done
+}
+
+// Run polls the client list until the context is cancelled.  Poll failures
+// are retried at the next interval, so Ganesha restarts are tolerated.
+//
+// Run must only be called once.
+func (w *ClientWatcher) Run(ctx context.Context) error {
+
+	defer close(w.done)
+
+	match := "type='signal',interface='org.ganesha.nfsd.clientmgr'"
+	w.conn.AddMatch(match)
+	defer w.conn.RemoveMatch(match)
+
+	signalCh := make(chan *dbus.Signal, 1)
+	w.conn.Signal(signalCh)
+	defer w.conn.RemoveSignal(signalCh)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	w.poll()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sig := <-signalCh:
+			// Signals from all matches are delivered, including heartbeats.
+			if !strings.HasPrefix(sig.Name, "org.ganesha.nfsd.clientmgr.") {
+				continue
+			}
+			w.poll()
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+// poll reads the client list and sends events for any changes since the last
+// poll.
+func (w *ClientWatcher) poll() {
+
+	clients, err := w.clientMgr.ShowClients()
+	if err != nil {
+		return
+	}
+	w.update(clients, time.Now())
+}
+
+// update sends events for the changes between the known clients and clients.
+func (w *ClientWatcher) update(clients []Client, now time.Time) {
+
+	seen := make(map[string]bool, len(clients))
+
+	for _, client := range clients {
+		key := client.Client.String()
+		seen[key] = true
+
+		lastActive := time.Unix(client.LastTime.Unix())
+		idle := w.idleTimeout > 0 && now.Sub(lastActive) > w.idleTimeout
+
+		prev, ok := w.clients[key]
+		if !ok {
+			w.clients[key] = &watchedClient{client: client, idle: idle}
+			w.send(newClientEvent(ClientConnected, now, client))
+			continue
+		}
+
+		known := make(map[string]bool)
+		for _, p := range prev.client.Protocols() {
+			known[p] = true
+		}
+		for _, p := range client.Protocols() {
+			if !known[p] {
+				event := newClientEvent(ClientProtocolAdded, now, client)
+				event.Protocol = p
+				w.send(event)
+			}
+		}
+
+		switch {
+		case idle && !prev.idle:
+			w.send(newClientEvent(ClientIdle, now, client))
+		case !idle && prev.idle:
+			w.send(newClientEvent(ClientActive, now, client))
+		}
+
+		prev.client = client
+		prev.idle = idle
+	}
+
+	for key, prev := range w.clients {
+		if !seen[key] {
+			delete(w.clients, key)
+			w.send(newClientEvent(ClientGone, now, prev.client))
+		}
+	}
+}
+
+// send records the event in the history and sends it to all subscribers.
+func (w *ClientWatcher) send(event ClientEvent) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.history = append(w.history, event)
+	if len(w.history) > clientEventHistory {
+		w.history = w.history[len(w.history)-clientEventHistory:]
+	}
+
+	for ch := range w.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func newClientEvent(t ClientEventType, now time.Time, client Client) ClientEvent {
+	return ClientEvent{
+		Type:       t,
+		Time:       now,
+		Client:     client.Client.String(),
+		Protocols:  client.Protocols(),
+		LastActive: time.Unix(client.LastTime.Unix()),
+	}
+}
@@ -0,0 +1,91 @@
+package ganesha
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestClientWatcherUpdate(t *testing.T) {
+
+	start := time.Date(2019, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	client := func(addr string, active time.Time, protocols ...string) Client {
+		id, err := ParseClientID(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := Client{Client: id, LastTime: unix.NsecToTimespec(active.UnixNano())}
+		for _, p := range protocols {
+			switch p {
+			case "NFSv3":
+				c.NFSv3 = true
+			case "NFSv41":
+				c.NFSv41 = true
+			}
+		}
+		return c
+	}
+
+	w := NewClientWatcher(nil, nil, time.Second, time.Minute)
+	events, unsubscribe := w.Subscribe()
+	defer unsubscribe()
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		clients []Client
+		want    []string
+	}{
+		{
+			name:    "connected",
+			now:     start,
+			clients: []Client{client("10.0.0.1", start, "NFSv41"), client("::ffff:10.0.0.2", start, "NFSv3")},
+			want:    []string{"connected 10.0.0.1", "connected 10.0.0.2"},
+		},
+		{
+			name:    "unchanged",
+			now:     start.Add(time.Second),
+			clients: []Client{client("10.0.0.1", start, "NFSv41"), client("10.0.0.2", start, "NFSv3")},
+		},
+		{
+			name:    "protocol added",
+			now:     start.Add(2 * time.Second),
+			clients: []Client{client("10.0.0.1", start, "NFSv41", "NFSv3"), client("10.0.0.2", start, "NFSv3")},
+			want:    []string{"protocol_added 10.0.0.1 NFSv3"},
+		},
+		{
+			name:    "idle",
+			now:     start.Add(2 * time.Minute),
+			clients: []Client{client("10.0.0.1", start.Add(2*time.Minute), "NFSv41", "NFSv3"), client("10.0.0.2", start, "NFSv3")},
+			want:    []string{"idle 10.0.0.2"},
+		},
+		{
+			name:    "active and gone",
+			now:     start.Add(3 * time.Minute),
+			clients: []Client{client("10.0.0.2", start.Add(3*time.Minute), "NFSv3")},
+			want:    []string{"active 10.0.0.2", "gone 10.0.0.1"},
+		},
+	}
+	for _, tt := range tests {
+		w.update(tt.clients, tt.now)
+
+		var got []string
+		for len(events) > 0 {
+			event := <-events
+			s := string(event.Type) + " " + event.Client
+			if event.Protocol != "" {
+				s += " " + event.Protocol
+			}
+			if !event.Time.Equal(tt.now) {
+				t.Errorf("%s: event time = %v, want %v", tt.name, event.Time, tt.now)
+			}
+			got = append(got, s)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: events = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
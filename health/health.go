@@ -2,36 +2,59 @@ package health
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/storageos/nfs/ganesha"
+	"github.com/storageos/nfs/logger"
 )
 
 // Health handles health collection and presentation.
 type Health struct {
 	ganesha *ganesha.Ganesha
+	log     *logger.Logger
 }
 
 // New creates a new health instance.
-func New(nfs *ganesha.Ganesha) *Health {
+func New(nfs *ganesha.Ganesha, log *logger.Logger) *Health {
 	return &Health{
 		ganesha: nfs,
+		log:     log,
 	}
 }
 
+// Status is the health report returned to clients that accept JSON.
+//
+// InGrace is true while the NFS server is in its NFSv4 grace period, during
+// which clients can reclaim state but new opens and locks are refused.  It is
+// omitted if the grace status could not be read.
+type Status struct {
+	Status  string `json:"status"`
+	InGrace *bool  `json:"in_grace,omitempty"`
+}
+
 // Handler returns an http handler for reporting health.
 //
 // The endpoint will return 200/OK when the NFS server is operational and
-// publishing heartbeats.
+// publishing heartbeats.  A JSON Status is returned if the request accepts
+// `application/json`.
 func (h *Health) Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		if h.ganesha.IsReady(ctx) {
+		ready := h.ganesha.IsReady(ctx)
+
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			h.writeStatus(w, ready)
+			return
+		}
+
+		if ready {
 			w.WriteHeader(200)
 			w.Write([]byte("ok"))
 		} else {
@@ -40,3 +63,23 @@ func (h *Health) Handler() http.Handler {
 		}
 	})
 }
+
+// writeStatus writes the JSON health report.
+func (h *Health) writeStatus(w http.ResponseWriter, ready bool) {
+
+	status := Status{Status: "ok"}
+	code := 200
+	if !ready {
+		status.Status = "nfs server not ready"
+		code = 503
+	}
+	if inGrace, err := h.ganesha.InGrace(); err == nil {
+		status.InGrace = &inGrace
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		h.log.Warnf("failed writing health response: %v", err)
+	}
+}
@@ -3,9 +3,10 @@ package http
 import (
 	"context"
 	"html/template"
-	"log"
 	"net/http"
 	"sync"
+
+	"github.com/storageos/nfs/logger"
 )
 
 // HTTP manages the web server that serves metrics.
@@ -14,12 +15,13 @@ type HTTP struct {
 	server   *http.Server
 	handlers map[string]string
 	mu       *sync.RWMutex
+	log      *logger.Logger
 }
 
 // New creates a new HTTP server which can be Run and Closed.
 //
 // Endpoint handlers should be registered using RegisterHandler().
-func New(listenAddr string, name string) *HTTP {
+func New(listenAddr string, name string, log *logger.Logger) *HTTP {
 	return &HTTP{
 		name: name,
 		server: &http.Server{
@@ -27,6 +29,7 @@ func New(listenAddr string, name string) *HTTP {
 		},
 		handlers: make(map[string]string),
 		mu:       &sync.RWMutex{},
+		log:      log,
 	}
 }
 
@@ -58,7 +61,7 @@ func (h *HTTP) Run() (<-chan error, error) {
 func (h *HTTP) Close(ctx context.Context) {
 	if h.server != nil {
 		if err := h.server.Shutdown(ctx); err != nil {
-			log.Printf("error shutting down http server: %v", err)
+			h.log.Warnf("error shutting down http server: %v", err)
 		}
 	}
 }
@@ -83,13 +86,8 @@ func (h *HTTP) RegisterHandler(name string, endpoint string, handler http.Handle
 
 }
 
-// Handler returns the default HTTP handler.
-//
-// This handler typically respondes to the "/" endpoint and generates a list of
-// available endpoints that have been registered with RegisterHandler().
-func (h *HTTP) Handler() http.Handler {
-
-	const index = `<html>
+// indexTemplate is the page listing the registered endpoints.
+var indexTemplate = template.Must(template.New("response").Parse(`<html>
 <head><title>{{.Name}}</title></head>
 <body>
 <h1>{{.Name}}</h1>
@@ -97,7 +95,13 @@ func (h *HTTP) Handler() http.Handler {
 <p><a href="{{$endpoint}}">{{$name}}</a></p>
 {{- end }}
 </body>
-</html>`
+</html>`))
+
+// Handler returns the default HTTP handler.
+//
+// This handler typically respondes to the "/" endpoint and generates a list of
+// available endpoints that have been registered with RegisterHandler().
+func (h *HTTP) Handler() http.Handler {
 
 	type data struct {
 		Name      string
@@ -108,17 +112,12 @@ func (h *HTTP) Handler() http.Handler {
 		Endpoints: h.handlers,
 	}
 
-	t, err := template.New("response").Parse(index)
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		h.mu.RLock()
 		defer h.mu.RUnlock()
 
-		if err := t.Execute(w, config); err != nil {
-			log.Printf("failed writing http response: %v", err)
+		if err := indexTemplate.Execute(w, config); err != nil {
+			h.log.Warnf("failed writing http response: %v", err)
 		}
 	})
 }
@@ -0,0 +1,10 @@
+// Package logger provides the levelled, structured logger shared by the NFS
+// container's packages.
+//
+// Log lines are written as JSON objects or as text, and carry fields
+// identifying where they came from, such as the component, volume name and
+// namespace, client address or export.  Loggers are derived from a root logger
+// with With, so fields added by main are present on every line.
+//
+// A nil *Logger discards all output, so loggers are optional in tests.
+package logger
@@ -0,0 +1,283 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Field keys used consistently across packages.
+const (
+	ComponentKey = "component"
+	NameKey      = "name"
+	NamespaceKey = "namespace"
+	ClientIPKey  = "clientip"
+	ExportIDKey  = "export_id"
+)
+
+// Level is the severity of a log line.
+type Level int
+
+// Log levels, from most to least verbose.
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = map[Level]string{
+	Debug: "debug",
+	Info:  "info",
+	Warn:  "warn",
+	Error: "error",
+}
+
+// String returns the name of the level.
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return strconv.Itoa(int(l))
+}
+
+// ParseLevel returns the Level for s, or an error if it is not known.
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(s)
+	if s == "warning" {
+		return Warn, nil
+	}
+	for l, name := range levelNames {
+		if name == s {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// Format is the encoding of log lines.
+type Format string
+
+// Log formats.
+const (
+	JSON Format = "json"
+	Text Format = "text"
+)
+
+// ParseFormat returns the Format for s, or an error if it is not known.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case JSON, Text:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown log format %q", s)
+}
+
+// Field is a key and value added to log lines.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// output is the destination shared by a root logger and those derived from
+// it.  mu serialises writes.
+type output struct {
+	w      io.Writer
+	format Format
+	mu     *sync.Mutex
+}
+
+// Logger writes levelled log lines with fields.
+type Logger struct {
+	out    *output
+	level  Level
+	fields []Field
+}
+
+// New returns a root logger writing lines of at least level to w.
+func New(w io.Writer, format Format, level Level) *Logger {
+	return &Logger{
+		out: &output{
+			w:      w,
+			format: format,
+			mu:     &sync.Mutex{},
+		},
+		level: level,
+	}
+}
+
+// With returns a logger that adds the field to each line.  A field with the
+// same key as an existing field replaces it.
+func (l *Logger) With(key string, value interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	fields := make([]Field, 0, len(l.fields)+1)
+	for _, f := range l.fields {
+		if f.Key != key {
+			fields = append(fields, f)
+		}
+	}
+	return &Logger{
+		out:    l.out,
+		level:  l.level,
+		fields: append(fields, Field{Key: key, Value: value}),
+	}
+}
+
+// Enabled returns true if lines of the level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.level
+}
+
+// Debugf logs a debug message.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(Debug, format, args...)
+}
+
+// Infof logs an informational message.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(Info, format, args...)
+}
+
+// Warnf logs a warning.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(Warn, format, args...)
+}
+
+// Errorf logs an error.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(Error, format, args...)
+}
+
+// Fatalf logs an error and exits.  It is for use by main only; packages
+// should return errors instead.
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.logf(Error, format, args...)
+	os.Exit(1)
+}
+
+func (l *Logger) logf(level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.Record(time.Now(), level.String(), fmt.Sprintf(format, args...))
+}
+
+// Record writes a line regardless of the logger's level.  It is used to
+// forward the logs of other programs, which have their own time, level names
+// and fields.
+func (l *Logger) Record(t time.Time, level string, msg string, fields ...Field) {
+	if l == nil {
+		return
+	}
+
+	all := l.fields
+	if len(fields) > 0 {
+		all = append(append([]Field(nil), l.fields...), fields...)
+	}
+
+	var buf bytes.Buffer
+	if l.out.format == Text {
+		writeText(&buf, t, level, msg, all)
+	} else {
+		writeJSON(&buf, t, level, msg, all)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+// writeJSON encodes a line as a JSON object.  Fields are written in order
+// after the time, level and message.
+func writeJSON(buf *bytes.Buffer, t time.Time, level string, msg string, fields []Field) {
+	buf.WriteString(`{"time":`)
+	writeJSONValue(buf, t.UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSONValue(buf, level)
+	buf.WriteString(`,"msg":`)
+	writeJSONValue(buf, msg)
+	for _, f := range fields {
+		buf.WriteByte(',')
+		writeJSONValue(buf, f.Key)
+		buf.WriteByte(':')
+		writeJSONValue(buf, fieldValue(f.Value))
+	}
+	buf.WriteString("}\n")
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
+
+// writeText encodes a line as text, with fields as key=value pairs.
+func writeText(buf *bytes.Buffer, t time.Time, level string, msg string, fields []Field) {
+	fmt.Fprintf(buf, "%s %-5s %s", t.UTC().Format(time.RFC3339), strings.ToUpper(level), msg)
+	for _, f := range fields {
+		s := fmt.Sprint(fieldValue(f.Value))
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			s = strconv.Quote(s)
+		}
+		fmt.Fprintf(buf, " %s=%s", f.Key, s)
+	}
+	buf.WriteByte('\n')
+}
+
+// fieldValue returns the value to encode for a field.  Errors and other
+// Stringers are encoded as strings.
+func fieldValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+// Writer returns a writer that logs each line written to it at the level.  It
+// is used for the output of child processes and of the standard library's log
+// package.
+func (l *Logger) Writer(level Level) io.Writer {
+	return &lineWriter{log: l, level: level, mu: &sync.Mutex{}}
+}
+
+// lineWriter logs each complete line written to it.
+type lineWriter struct {
+	log   *Logger
+	level Level
+
+	// buf holds an incomplete line.  It is protected by mu.
+	buf []byte
+	mu  *sync.Mutex
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(w.buf[:i]), "\r")
+		w.buf = w.buf[i+1:]
+		if line != "" {
+			w.log.logf(w.level, "%s", line)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSON(t *testing.T) {
+
+	var out bytes.Buffer
+	log := New(&out, JSON, Info).With(NameKey, "pvc-1").With(ComponentKey, "metrics")
+
+	log.Debugf("not written")
+	log.With(ExportIDKey, 2).Warnf("export %s", "failed")
+	log.With(ComponentKey, "admin").Infof("replaced")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), out.String())
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[0], err)
+	}
+	want := map[string]interface{}{
+		"level":     "warn",
+		"msg":       "export failed",
+		"name":      "pvc-1",
+		"component": "metrics",
+		"export_id": float64(2),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if _, err := time.Parse(time.RFC3339Nano, got["time"].(string)); err != nil {
+		t.Errorf("invalid time %v: %v", got["time"], err)
+	}
+
+	if !strings.Contains(lines[1], `"component":"admin"`) || strings.Contains(lines[1], `"component":"metrics"`) {
+		t.Errorf("With() did not replace field: %s", lines[1])
+	}
+}
+
+func TestText(t *testing.T) {
+
+	var out bytes.Buffer
+	log := New(&out, Text, Debug).With(ClientIPKey, "10.0.0.1").With(NamespaceKey, "")
+
+	ts := time.Date(2019, 10, 17, 12, 34, 56, 0, time.UTC)
+	log.Record(ts, "EVENT", "Starting", Field{Key: "thread", Value: "main thread"})
+
+	want := `2019-10-17T12:34:56Z EVENT Starting clientip=10.0.0.1 namespace="" thread="main thread"` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriter(t *testing.T) {
+
+	var out bytes.Buffer
+	w := New(&out, Text, Info).Writer(Warn)
+
+	w.Write([]byte("first\nsec"))
+	w.Write([]byte("ond\n\n"))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), out.String())
+	}
+	for i, msg := range []string{"WARN  first", "WARN  second"} {
+		if !strings.HasSuffix(lines[i], msg) {
+			t.Errorf("line %d = %q, want suffix %q", i, lines[i], msg)
+		}
+	}
+}
+
+func TestNil(t *testing.T) {
+	var log *Logger
+	log.With(NameKey, "pvc-1").Errorf("discarded")
+	log.Writer(Info).Write([]byte("discarded\n"))
+	if log.Enabled(Error) {
+		t.Error("nil logger enabled")
+	}
+}
+
+func TestParse(t *testing.T) {
+
+	for _, tt := range []struct {
+		s       string
+		want    Level
+		wantErr bool
+	}{
+		{s: "debug", want: Debug},
+		{s: "INFO", want: Info},
+		{s: "warning", want: Warn},
+		{s: "error", want: Error},
+		{s: "trace", wantErr: true},
+	} {
+		got, err := ParseLevel(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if f, err := ParseFormat("Text"); err != nil || f != Text {
+		t.Errorf("ParseFormat(Text) = %v, %v", f, err)
+	}
+	if _, err := ParseFormat("logfmt"); err == nil {
+		t.Error("ParseFormat(logfmt): got no error")
+	}
+}
@@ -2,23 +2,35 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	stdlog "log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/storageos/nfs/admin"
+	"github.com/storageos/nfs/config"
 	"github.com/storageos/nfs/dbus"
+	"github.com/storageos/nfs/events"
 	"github.com/storageos/nfs/ganesha"
 	"github.com/storageos/nfs/health"
 	"github.com/storageos/nfs/http"
+	"github.com/storageos/nfs/logger"
 	"github.com/storageos/nfs/metrics"
+	"github.com/storageos/nfs/process"
+	"github.com/storageos/nfs/recovery"
 )
 
 const (
-	name            string = "StorageOS NFS"
-	healthEndpoint         = "/healthz"
-	metricsEndpoint        = "/metrics"
+	name             string = "StorageOS NFS"
+	healthEndpoint          = "/healthz"
+	metricsEndpoint         = "/metrics"
+	eventsEndpoint          = "/events"
+	recoveryEndpoint        = "/recovery"
 )
 
 const (
@@ -27,19 +39,173 @@ const (
 	nameEnvVar           string = "NAME"
 	namespaceEnvVar      string = "NAMESPACE"
 	disableMetricsEnvVar string = "DISABLE_METRICS"
+	enableAdminEnvVar    string = "ENABLE_ADMIN"
+	adminTokenEnvVar     string = "ADMIN_TOKEN"
+	maxRestartsEnvVar    string = "MAX_RESTARTS"
+	drainTimeoutEnvVar   string = "DRAIN_TIMEOUT"
+	exportVolumesEnvVar  string = "EXPORT_VOLUMES"
+	maxClientsEnvVar     string = "METRICS_MAX_CLIENTS"
+	clientIdleEnvVar     string = "METRICS_CLIENT_IDLE_TIMEOUT"
+	clientResolverEnvVar string = "CLIENT_RESOLVER"
+	clientMappingEnvVar  string = "CLIENT_MAPPING"
+	graceOnRestartEnvVar string = "GRACE_ON_RESTART"
+	recoveryRootEnvVar   string = "RECOVERY_ROOT"
+	recoveryMaxAgeEnvVar string = "RECOVERY_MAX_AGE"
+	logFormatEnvVar      string = "LOG_FORMAT"
+	logLevelEnvVar       string = "LOG_LEVEL"
 )
 
+// Env vars used to generate the ganesha config when GANESHA_CONFIGFILE is not
+// set.
+const (
+	exportSpecEnvVar    string = "EXPORT_SPEC"
+	exportPathEnvVar    string = "EXPORT_PATH"
+	exportPseudoEnvVar  string = "EXPORT_PSEUDO"
+	exportAccessEnvVar  string = "EXPORT_ACCESS"
+	exportSquashEnvVar  string = "EXPORT_SQUASH"
+	exportClientsEnvVar string = "EXPORT_CLIENTS"
+	nfsProtocolsEnvVar  string = "NFS_PROTOCOLS"
+)
+
+// defaultDrainTimeout is the default time allowed for clients to finish IO
+// before the nfs server is stopped.
+const defaultDrainTimeout = 20 * time.Second
+
+// clientMappingRefresh is how often the static client mapping is re-read.
+const clientMappingRefresh = time.Minute
+
+// Client events are generated by polling the client list.  Clients with no
+// activity for the idle timeout are reported as idle.
+const (
+	clientPollInterval = 5 * time.Second
+	clientIdleTimeout  = 5 * time.Minute
+)
+
+// shutdownTimeout is how long each process is given to stop before it is
+// killed.
+const shutdownTimeout = 10 * time.Second
+
+// generatedConfigFile is where the ganesha config is written when it is
+// generated from env vars or a spec file.
+const generatedConfigFile = "/run/ganesha.conf"
+
+// restartConfigFile is where the ganesha config used for restarts is written
+// when grace is enabled on restart.
+const restartConfigFile = "/run/ganesha-restart.conf"
+
 func main() {
 
-	// Rad & validate config.
+	// As PID 1 in the container, handle signals from the start.  Without
+	// handlers, SIGTERM would not run the graceful shutdown.
+	stopCh := make(chan os.Signal, 1)
+	signal.Notify(stopCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	childCh := make(chan os.Signal, 1)
+	signal.Notify(childCh, syscall.SIGCHLD)
+
+	// Set up logging first so that configuration errors are reported in the
+	// requested format.  Output from the standard library's log package, used
+	// by dependencies, is re-written at info level.
+	logFormat, err := logger.ParseFormat(getEnv(logFormatEnvVar, string(logger.JSON)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s env var value must be json or text\n", logFormatEnvVar)
+		os.Exit(1)
+	}
+	logLevel, err := logger.ParseLevel(getEnv(logLevelEnvVar, logger.Info.String()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s env var value must be debug, info, warn or error\n", logLevelEnvVar)
+		os.Exit(1)
+	}
+	log := logger.New(os.Stdout, logFormat, logLevel).
+		With(logger.NameKey, os.Getenv(nameEnvVar)).
+		With(logger.NamespaceKey, os.Getenv(namespaceEnvVar))
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(log.Writer(logger.Info))
+
+	// Read & validate config.  If no ganesha config file was provided,
+	// generate one.
+	var cfg *config.Config
 	ganeshaConfig := getEnv(ganeshaConfigEnvVar, "")
-	if ganeshaConfig == "" {
-		log.Fatalf("ganesha config file must be specified with %s env var", ganeshaConfigEnvVar)
+	if ganeshaConfig != "" {
+		c, err := config.Load(ganeshaConfig)
+		if err != nil {
+			log.Fatalf("failed to read ganesha config: %v", err)
+		}
+		cfg = c
+	} else {
+		spec, err := specFromEnv()
+		if err != nil {
+			log.Fatalf("failed to read export spec: %v", err)
+		}
+		c, err := spec.Config()
+		if err != nil {
+			log.Fatalf("failed to generate ganesha config: %v", err)
+		}
+		cfg = c
+		ganeshaConfig = generatedConfigFile
+	}
+
+	// Prepare the NFSv4 client recovery directory, adding it to generated
+	// configs.  Custom configs must already use it.
+	var recoveryDir *recovery.Dir
+	if root := getEnv(recoveryRootEnvVar, ""); root != "" {
+		maxAge, err := getDurationEnv(recoveryMaxAgeEnvVar, 0)
+		if err != nil {
+			log.Fatalf("%s env var value must be a duration, e.g. 168h, or 0 to keep all records", recoveryMaxAgeEnvVar)
+		}
+		host, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		recoveryDir, err = recovery.New(root, host, log.With(logger.ComponentKey, "recovery"))
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if ganeshaConfig == generatedConfigFile {
+			setRecovery(cfg, recoveryDir.Root())
+		} else if !usesRecovery(cfg, recoveryDir.Root()) {
+			log.Fatalf("ganesha config %s must set RecoveryBackend = %s and RecoveryRoot = %s in the NFSV4 block", ganeshaConfig, recovery.Backend, recoveryDir.Root())
+		} else if cfg.NFSv4.Graceless {
+			log.Fatalf("ganesha config %s must not set Graceless = true with RecoveryBackend = %s, as clients could not reclaim their state", ganeshaConfig, recovery.Backend)
+		}
+		if err := recoveryDir.Prepare(maxAge); err != nil {
+			log.Fatalf("failed to prepare recovery directory: %v", err)
+		}
+		if persistent, err := recoveryDir.Persistent(); err == nil && !persistent {
+			log.Warnf("recovery directory %s is not on a separate mount, client records will be lost if the pod is rescheduled", recoveryDir.Root())
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("ganesha config %s: %v", ganeshaConfig, err)
+	}
+	if ganeshaConfig == generatedConfigFile {
+		if err := cfg.WriteFile(ganeshaConfig); err != nil {
+			log.Fatalf("failed to write ganesha config: %v", err)
+		}
+		log.Infof("generated ganesha config %s", ganeshaConfig)
 	}
 	disableMetrics, err := getBoolEnv(disableMetricsEnvVar, false)
 	if err != nil {
 		log.Fatalf("%s env var value must be true or false/empty/unset", disableMetricsEnvVar)
 	}
+	enableAdmin, err := getBoolEnv(enableAdminEnvVar, false)
+	if err != nil {
+		log.Fatalf("%s env var value must be true or false/empty/unset", enableAdminEnvVar)
+	}
+	maxRestarts, err := getIntEnv(maxRestartsEnvVar, ganesha.DefaultSupervisorConfig.MaxRestarts)
+	if err != nil || maxRestarts < 0 {
+		log.Fatalf("%s env var value must be a positive number or 0 to disable restarts", maxRestartsEnvVar)
+	}
+	drainTimeout, err := getDurationEnv(drainTimeoutEnvVar, defaultDrainTimeout)
+	if err != nil {
+		log.Fatalf("%s env var value must be a duration, e.g. 20s, or 0 to disable draining", drainTimeoutEnvVar)
+	}
+	graceOnRestart, err := getBoolEnv(graceOnRestartEnvVar, false)
+	if err != nil {
+		log.Fatalf("%s env var value must be true or false/empty/unset", graceOnRestartEnvVar)
+	}
 	listenAddr := getEnv(listenAddrEnvVar, ":80")
 
 	// All processes should start and be ready within the context timeout.  Can
@@ -47,85 +213,321 @@ func main() {
 	startCtx, startCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer startCancel()
 
+	// Processes are added to started once running.  If startup fails after
+	// that, they are stopped before exiting, in reverse order, rather than
+	// being left running without their parent.
+	var started []func(ctx context.Context)
+	fatalf := func(format string, args ...interface{}) {
+		log.Errorf(format, args...)
+		for i := len(started) - 1; i >= 0; i-- {
+			stop(started[i])
+		}
+		os.Exit(1)
+	}
+
 	// Start DBus.
-	bus := dbus.New()
+	bus := dbus.New(log.With(logger.ComponentKey, "dbus"))
 	dbusErrCh, err := bus.Run()
 	if err != nil {
-		log.Fatal(err)
+		fatalf("%v", err)
 	}
+	started = append(started, bus.Close)
 
 	// Wait for Dbus to be operational.
 	if err := waitForReady(startCtx, bus.IsReady); err != nil {
-		log.Fatal(err)
+		fatalf("%v", err)
+	}
+
+	// Connect to DBus.  The connection is shared by everything that talks to
+	// Ganesha and is re-established if the daemon restarts.
+	conn := dbus.NewConn(log.With(logger.ComponentKey, "dbus"))
+	connCtx, connCancel := context.WithCancel(context.Background())
+	connDone := make(chan struct{})
+	go func() {
+		conn.Run(connCtx)
+		close(connDone)
+	}()
+	closeConn := func(ctx context.Context) {
+		connCancel()
+		select {
+		case <-connDone:
+		case <-ctx.Done():
+		}
+	}
+	started = append(started, closeConn)
+	if err := waitForReady(startCtx, conn.IsReady); err != nil {
+		fatalf("%v", err)
 	}
 
-	// Start Ganesaha.
-	nfs := ganesha.New(ganeshaConfig)
-	nfsErrCh, err := nfs.Run()
+	// Start Ganesaha.  If it exits, the supervisor will restart it until the
+	// restart budget is exhausted, after which the container will exit.  Its
+	// log output is re-written in the log format.
+	ganeshaLog := log.With(logger.ComponentKey, "ganesha")
+	ganeshaLogs := ganesha.NewLogStream(ganeshaLog)
+	nfs := ganesha.New(ganeshaConfig, conn, ganeshaLogs, ganeshaLog)
+
+	// The running config is shared by everything that changes the exports
+	// at runtime.
+	running := ganesha.NewRunningConfig(cfg)
+	supervisorConfig := ganesha.DefaultSupervisorConfig
+	supervisorConfig.MaxRestarts = maxRestarts
+
+	// A restart by the supervisor uses the running config, so exports changed
+	// at runtime are kept, a provided config file's changed settings are not
+	// applied until the container is restarted, and exports that failed to
+	// reload are not retried.  It is saved after every change.
+	if err := restartConfig(running.Get(), graceOnRestart).WriteFile(restartConfigFile); err != nil {
+		fatalf("failed to write ganesha restart config: %v", err)
+	}
+	supervisorConfig.RestartConfig = restartConfigFile
+	running.OnUpdate(func(cfg *config.Config) {
+		if err := restartConfig(cfg, graceOnRestart).WriteFile(restartConfigFile); err != nil {
+			log.Errorf("failed to write ganesha restart config: %v", err)
+		}
+	})
+	if graceOnRestart {
+		supervisorConfig.GraceOnRestart = true
+
+		// With recovery, the container may be replacing a server whose
+		// clients still hold state, so they must be able to reclaim it.
+		if recoveryDir != nil {
+			nfs.SetConfig(restartConfigFile)
+		}
+	}
+	supervisor := ganesha.NewSupervisor(nfs, supervisorConfig, log.With(logger.ComponentKey, "supervisor"))
+	nfsErrCh, err := supervisor.Run()
 	if err != nil {
-		log.Fatal(err)
+		fatalf("%v", err)
 	}
+	started = append(started, supervisor.Close)
 
-	// Start watching Ganesha status heartbeats.  If it exits, we expect the
-	// healthcheck to timeout and the orchestrator will restart the container.
+	// Start watching Ganesha status heartbeats.  Heartbeats resume once a
+	// restarted process is ready.
 	monitorCtx, monitorCancel := context.WithCancel(context.Background())
 	go func() {
 		if err := nfs.MonitorStatus(monitorCtx); err != nil {
-			log.Printf("status monitor finished: %v", err)
+			log.Infof("status monitor finished: %v", err)
 		}
 	}()
 
 	// Wait for Ganesha to report it is ready.
 	if err := waitForReady(startCtx, nfs.IsReady); err != nil {
-		log.Fatal(err)
+		fatalf("%v", err)
+	}
+
+	// Create handles to Ganesha's export and client managers, used to drain
+	// clients on shutdown and by the admin endpoints.
+	exportMgr := ganesha.NewExportMgr(conn)
+	clientMgr := ganesha.NewClientMgr(conn)
+	accessMgr := ganesha.NewAccessMgr(exportMgr, clientMgr, running, filepath.Dir(generatedConfigFile))
+	configMgr := ganesha.NewExportConfigMgr(exportMgr, accessMgr, running, filepath.Dir(generatedConfigFile))
+
+	// Apply changes to a provided config file, such as one mounted from a
+	// ConfigMap, without restarting.
+	var reloader *ganesha.Reloader
+	if ganeshaConfig != generatedConfigFile {
+		reloader = ganesha.NewReloader(exportMgr, accessMgr, ganeshaConfig, running, log.With(logger.ComponentKey, "reload"))
+		configWatcher, err := config.NewWatcher(ganeshaConfig)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		go func() {
+			err := configWatcher.Run(monitorCtx, func() {
+				log.Infof("ganesha config %s changed, reloading", ganeshaConfig)
+				if err := reloader.Reload(); err != nil {
+					log.Errorf("ganesha config reload failed: %v", err)
+				} else {
+					log.Infof("ganesha config %s reloaded", ganeshaConfig)
+				}
+			})
+			if err != nil && err != context.Canceled {
+				log.Errorf("ganesha config watcher stopped: %v", err)
+			}
+		}()
 	}
 
 	// Start HTTP server.
-	srv := http.New(listenAddr, name)
+	srv := http.New(listenAddr, name, log.With(logger.ComponentKey, "http"))
 	srv.RegisterHandler("Index", "/", srv.Handler())
 
 	httpErrCh, err := srv.Run()
 	if err != nil {
-		log.Fatal(err)
+		fatalf("%v", err)
+	}
+	started = append(started, srv.Close)
+
+	// Register recovery endpoint if the recovery directory is managed.
+	if recoveryDir != nil {
+		srv.RegisterHandler("Recovery", recoveryEndpoint, recoveryDir.Handler())
 	}
 
 	// Register health endpoint.
-	srv.RegisterHandler("Health", healthEndpoint, health.New(nfs).Handler())
+	srv.RegisterHandler("Health", healthEndpoint, health.New(nfs, log.With(logger.ComponentKey, "health")).Handler())
 
 	// Register metrics endpoints if not explicitly disabled.
 	if !disableMetrics {
-		log.Printf("enabling prometheus endpoint on http://%s/metrics", listenAddr)
-		metrics := metrics.New(os.Getenv(nameEnvVar), os.Getenv(namespaceEnvVar))
-		srv.RegisterHandler("Metrics", metricsEndpoint, metrics.Handler())
+		metricsLog := log.With(logger.ComponentKey, "metrics")
+		log.Infof("enabling prometheus endpoint on http://%s/metrics", listenAddr)
+		volumes, err := getVolumesEnv(exportVolumesEnvVar)
+		if err != nil {
+			fatalf("%s env var value must be a list of <export_id>=<namespace>/<name>: %v", exportVolumesEnvVar, err)
+		}
+		maxClients, err := getIntEnv(maxClientsEnvVar, 0)
+		if err != nil || maxClients < 0 {
+			fatalf("%s env var value must be a positive number or 0 to report all clients", maxClientsEnvVar)
+		}
+		clientIdle, err := getDurationEnv(clientIdleEnvVar, 0)
+		if err != nil {
+			fatalf("%s env var value must be a duration, e.g. 1h, or 0 to report idle clients", clientIdleEnvVar)
+		}
+		var resolver metrics.ClientResolver
+		switch getEnv(clientResolverEnvVar, "") {
+		case "":
+		case "dns":
+			dns := metrics.NewDNSResolver()
+			go dns.Run(monitorCtx)
+			resolver = dns
+		case "static":
+			static, err := metrics.NewStaticResolver(getEnv(clientMappingEnvVar, ""))
+			if err != nil {
+				fatalf("%v", err)
+			}
+			go static.Run(monitorCtx, clientMappingRefresh, metricsLog)
+			resolver = static
+		default:
+			fatalf("%s env var value must be dns, static or empty/unset", clientResolverEnvVar)
+		}
+		reg, err := metrics.New(metrics.Options{
+			Name:      os.Getenv(nameEnvVar),
+			Namespace: os.Getenv(namespaceEnvVar),
+			Volumes:   volumes,
+			ClientLimits: metrics.ClientLimits{
+				MaxClients:  maxClients,
+				IdleTimeout: clientIdle,
+			},
+			ClientResolver: resolver,
+			FSALs:          cfg.FSALs(),
+			ExportMgr:      exportMgr,
+			ClientMgr:      clientMgr,
+			Logger:         metricsLog,
+		})
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if err := reg.Register(metrics.NewSupervisorCollector(os.Getenv(nameEnvVar), os.Getenv(namespaceEnvVar), supervisor)); err != nil {
+			fatalf("%v", err)
+		}
+		if err := reg.Register(metrics.NewGraceCollector(os.Getenv(nameEnvVar), os.Getenv(namespaceEnvVar), nfs, metricsLog)); err != nil {
+			fatalf("%v", err)
+		}
+		if err := reg.Register(metrics.NewGaneshaLogCollector(os.Getenv(nameEnvVar), os.Getenv(namespaceEnvVar), ganeshaLogs)); err != nil {
+			fatalf("%v", err)
+		}
+		if reloader != nil {
+			if err := reg.Register(metrics.NewReloadCollector(os.Getenv(nameEnvVar), os.Getenv(namespaceEnvVar), reloader)); err != nil {
+				fatalf("%v", err)
+			}
+		}
+		srv.RegisterHandler("Metrics", metricsEndpoint, reg.Handler())
 	}
 
-	var stopCh = make(chan os.Signal)
-	signal.Notify(stopCh, os.Interrupt)
+	// Register admin endpoints if explicitly enabled.
+	if enableAdmin {
+		log.Infof("enabling admin endpoints on http://%s%s", listenAddr, admin.ExportsEndpoint)
+		adminToken := getEnv(adminTokenEnvVar, "")
+		if adminToken == "" {
+			log.Warnf("%s not set, admin endpoints will be read-only", adminTokenEnvVar)
+		}
+		adminLog := log.With(logger.ComponentKey, "admin")
+		logMgr := ganesha.NewLogMgr(conn, adminLog)
+		adm := admin.New(exportMgr, configMgr, accessMgr, nfs, logMgr, adminToken, adminLog)
+		srv.RegisterHandler("Exports", admin.ExportsEndpoint, adm.ExportsHandler())
+		srv.RegisterHandler("Export", admin.ExportsEndpoint+"/", adm.ExportsHandler())
+		srv.RegisterHandler("Stats", admin.StatsEndpoint, adm.StatsHandler())
+		srv.RegisterHandler("Clients", admin.ClientsEndpoint, adm.ClientsHandler())
+		srv.RegisterHandler("Grace", admin.GraceEndpoint, adm.GraceHandler())
+		srv.RegisterHandler("Log", admin.LogEndpoint, adm.LogHandler())
+		srv.RegisterHandler("LogComponent", admin.LogEndpoint+"/", adm.LogHandler())
 
-	select {
-	case <-stopCh:
-		log.Print("shutdown requested")
-	case err := <-dbusErrCh:
-		log.Printf("dbus daemon stopped: %v", err)
-	case err := <-nfsErrCh:
-		log.Printf("nfs server stopped: %v", err)
-	case err := <-httpErrCh:
-		log.Printf("http server stopped: %v", err)
+		// Watch for client connection changes, streamed from the events
+		// endpoint.  Client addresses are only shown with the admin token.
+		watcher := ganesha.NewClientWatcher(clientMgr, conn, clientPollInterval, clientIdleTimeout)
+		go func() {
+			if err := watcher.Run(monitorCtx); err != nil && err != context.Canceled {
+				log.Errorf("client watcher stopped: %v", err)
+			}
+		}()
+		srv.RegisterHandler("Events", eventsEndpoint, adm.Restrict(events.New(watcher, log.With(logger.ComponentKey, "events")).Handler()))
+	}
+
+	// Reap orphaned processes that have been re-parented to us, leaving dbus
+	// and ganesha to be waited on by their own managers.  Any other child
+	// started with os/exec must have been waited on before this point.
+	reaper := process.NewReaper(func(pid int) bool {
+		return pid == bus.Pid() || pid == nfs.Pid()
+	})
+	reaper.Reap()
+
+	// Clients are only drained when shutdown was requested, otherwise one of
+	// the processes needed to drain has already stopped.
+	drain := false
+
+wait:
+	for {
+		select {
+		case sig := <-stopCh:
+			log.Infof("shutdown requested: %v", sig)
+			drain = drainTimeout > 0
+			break wait
+		case <-reloadCh:
+			log.Infof("forwarding SIGHUP to nfs server")
+			if err := nfs.Signal(syscall.SIGHUP); err != nil {
+				log.Errorf("failed to forward SIGHUP to nfs server: %v", err)
+			}
+		case <-childCh:
+			reaper.Reap()
+		case err := <-dbusErrCh:
+			log.Errorf("dbus daemon stopped: %v", err)
+			break wait
+		case err := <-nfsErrCh:
+			log.Errorf("nfs server stopped: %v", err)
+			break wait
+		case err := <-httpErrCh:
+			log.Errorf("http server stopped: %v", err)
+			break wait
+		}
 	}
 
 	// Stop monitoring
 	monitorCancel()
 
-	// Graceful stop
-	stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer stopCancel()
+	// Stop new clients and wait for IO to finish before stopping the nfs
+	// server.
+	if drain {
+		log.Infof("draining nfs clients for up to %s", drainTimeout)
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), drainTimeout)
+		ganesha.NewDrainer(exportMgr, clientMgr, running, filepath.Dir(generatedConfigFile), log.With(logger.ComponentKey, "drain")).Drain(drainCtx)
+		drainCancel()
+	}
+
+	// Graceful stop, nfs server first so that it is not left without DBus.
+	stop(supervisor.Close)
+	stop(srv.Close)
+	stop(closeConn)
+	stop(bus.Close)
+	reaper.Reap()
 
-	nfs.Close(stopCtx)
-	srv.Close(stopCtx)
-	bus.Close(stopCtx)
+	log.Infof("graceful shutdown completed")
 
-	log.Print("graceful shutdown completed")
+}
 
+// stop calls a process's close function.  Each process is given its own
+// timeout before it is killed so that a slow nfs server shutdown does not
+// prevent the others from stopping cleanly.
+func stop(close func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	close(ctx)
 }
 
 // waitForReady waits for readyFunc to return true or the context to expire.
@@ -153,6 +555,67 @@ func waitForReady(ctx context.Context, readyFunc func(ctx context.Context) bool)
 	}
 }
 
+// specFromEnv returns the export spec to generate the ganesha config from.
+//
+// If EXPORT_SPEC is set, the spec is read from the JSON or YAML file it refers
+// to.
+// Otherwise a single export is described by the EXPORT_* and NFS_PROTOCOLS env
+// vars, with defaults applied for unset values.
+func specFromEnv() (*config.Spec, error) {
+
+	if path := getEnv(exportSpecEnvVar, ""); path != "" {
+		return config.LoadSpec(path)
+	}
+
+	return &config.Spec{
+		Protocols: getListEnv(nfsProtocolsEnvVar),
+		Exports: []config.ExportSpec{
+			{
+				Path:    getEnv(exportPathEnvVar, ""),
+				Pseudo:  getEnv(exportPseudoEnvVar, ""),
+				Access:  getEnv(exportAccessEnvVar, ""),
+				Squash:  getEnv(exportSquashEnvVar, ""),
+				Clients: getListEnv(exportClientsEnvVar),
+			},
+		},
+	}, nil
+}
+
+// restartConfig returns a copy of cfg for restarting the server.  If grace is
+// set, the copy allows the NFSv4 grace period, so that clients can reclaim
+// their state when the server is restarted.
+func restartConfig(cfg *config.Config, grace bool) *config.Config {
+	restart := cfg.Copy()
+	if !grace {
+		return restart
+	}
+	v4 := config.NFSv4{}
+	if cfg.NFSv4 != nil {
+		v4 = *cfg.NFSv4
+	}
+	v4.Graceless = false
+	restart.NFSv4 = &v4
+	return restart
+}
+
+// setRecovery configures cfg to record NFSv4 clients in the recovery root, and
+// allows the grace period so that they can reclaim their state.
+func setRecovery(cfg *config.Config, root string) {
+	if cfg.NFSv4 == nil {
+		cfg.NFSv4 = &config.NFSv4{}
+	}
+	cfg.NFSv4.RecoveryBackend = recovery.Backend
+	cfg.NFSv4.RecoveryRoot = root
+	cfg.NFSv4.Graceless = false
+}
+
+// usesRecovery returns true if cfg records NFSv4 clients in the recovery root.
+func usesRecovery(cfg *config.Config, root string) bool {
+	return cfg.NFSv4 != nil &&
+		cfg.NFSv4.RecoveryBackend == recovery.Backend &&
+		filepath.Clean(cfg.NFSv4.RecoveryRoot) == root
+}
+
 // getEnv reads an environment variable by key name and returns the value or a
 // default value if not set.
 func getEnv(key string, defaultVal string) string {
@@ -162,6 +625,71 @@ func getEnv(key string, defaultVal string) string {
 	return defaultVal
 }
 
+// getListEnv reads an environment variable by key name and returns its
+// comma-separated values, or nil if not set.  Whitespace around values is
+// ignored.
+func getListEnv(key string) []string {
+
+	var list []string
+	for _, val := range strings.Split(getEnv(key, ""), ",") {
+		if val = strings.TrimSpace(val); val != "" {
+			list = append(list, val)
+		}
+	}
+	return list
+}
+
+// getIntEnv reads an environment variable by key name and returns its integer
+// value or the default value if not set.
+func getIntEnv(key string, defaultVal int) (int, error) {
+
+	val := getEnv(key, "")
+	if val == "" {
+		return defaultVal, nil
+	}
+
+	return strconv.Atoi(val)
+}
+
+// getDurationEnv reads an environment variable by key name and returns its
+// duration value or the default value if not set.
+func getDurationEnv(key string, defaultVal time.Duration) (time.Duration, error) {
+
+	val := getEnv(key, "")
+	if val == "" {
+		return defaultVal, nil
+	}
+
+	return time.ParseDuration(val)
+}
+
+// getVolumesEnv reads an environment variable by key name containing a comma
+// separated list of `<export_id>=<namespace>/<name>` and returns the PVC for
+// each export.  A nil map is returned if not set.
+func getVolumesEnv(key string) (map[uint16]metrics.Volume, error) {
+
+	var volumes map[uint16]metrics.Volume
+	for _, entry := range getListEnv(key) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("missing export id: %q", entry)
+		}
+		id, err := strconv.ParseUint(parts[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid export id: %q", entry)
+		}
+		ref := strings.SplitN(parts[1], "/", 2)
+		if len(ref) != 2 || ref[0] == "" || ref[1] == "" {
+			return nil, fmt.Errorf("volume must be <namespace>/<name>: %q", entry)
+		}
+		if volumes == nil {
+			volumes = make(map[uint16]metrics.Volume)
+		}
+		volumes[uint16(id)] = metrics.Volume{Namespace: ref[0], Name: ref[1]}
+	}
+	return volumes, nil
+}
+
 // getBoolEnv reads an evironment variable by key name and returns its boolean
 // value or the default value if not set.  It will log a fatal error if the
 // value can not be parsed as a boolean since it's expected to be used during
@@ -2,7 +2,13 @@ package main
 
 import (
 	"os"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/storageos/nfs/config"
+	"github.com/storageos/nfs/metrics"
+	"github.com/storageos/nfs/recovery"
 )
 
 func Test_getEnv(t *testing.T) {
@@ -55,6 +61,225 @@ func Test_getEnv(t *testing.T) {
 	}
 }
 
+func Test_getListEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		setVal string
+		want   []string
+	}{
+		{
+			name: "not set",
+			key:  "Test_getListEnv",
+			want: nil,
+		},
+		{
+			name:   "single value",
+			key:    "Test_getListEnv",
+			setVal: "4",
+			want:   []string{"4"},
+		},
+		{
+			name:   "multiple values with whitespace",
+			key:    "Test_getListEnv",
+			setVal: "10.0.0.1, 10.1.0.0/16 ,",
+			want:   []string{"10.0.0.1", "10.1.0.0/16"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			os.Clearenv()
+
+			if tt.setVal != "" {
+				os.Setenv(tt.key, tt.setVal)
+				defer os.Setenv(tt.key, "")
+			}
+
+			if got := getListEnv(tt.key); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getListEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getVolumesEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		setVal  string
+		want    map[uint16]metrics.Volume
+		wantErr bool
+	}{
+		{
+			name: "not set",
+			key:  "Test_getVolumesEnv",
+			want: nil,
+		},
+		{
+			name:   "multiple volumes",
+			key:    "Test_getVolumesEnv",
+			setVal: "77=default/pvc-a, 78=team/pvc-b",
+			want: map[uint16]metrics.Volume{
+				77: {Namespace: "default", Name: "pvc-a"},
+				78: {Namespace: "team", Name: "pvc-b"},
+			},
+		},
+		{
+			name:    "missing namespace",
+			key:     "Test_getVolumesEnv",
+			setVal:  "77=pvc-a",
+			wantErr: true,
+		},
+		{
+			name:    "invalid export id",
+			key:     "Test_getVolumesEnv",
+			setVal:  "export=default/pvc-a",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			os.Clearenv()
+
+			if tt.setVal != "" {
+				os.Setenv(tt.key, tt.setVal)
+				defer os.Setenv(tt.key, "")
+			}
+
+			got, err := getVolumesEnv(tt.key)
+			if err == nil && tt.wantErr {
+				t.Error("getVolumesEnv(): got no error even though we wanted one")
+			} else if err != nil && !tt.wantErr {
+				t.Errorf("getVolumesEnv(): got an error even though we wanted none, got: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getVolumesEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getIntEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		defaultVal int
+		setVal     string
+		want       int
+		wantErr    bool
+	}{
+		{
+			name:   "set",
+			key:    "Test_getIntEnv",
+			setVal: "3",
+			want:   3,
+		},
+		{
+			name:       "not set with default",
+			key:        "Test_getIntEnv",
+			defaultVal: 5,
+			want:       5,
+		},
+		{
+			name:       "set with default",
+			key:        "Test_getIntEnv",
+			defaultVal: 5,
+			setVal:     "0",
+			want:       0,
+		},
+		{
+			name:    "set non-int",
+			key:     "Test_getIntEnv",
+			setVal:  "five",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			os.Clearenv()
+
+			if tt.setVal != "" {
+				os.Setenv(tt.key, tt.setVal)
+				defer os.Setenv(tt.key, "")
+			}
+
+			got, err := getIntEnv(tt.key, tt.defaultVal)
+			if err == nil && tt.wantErr {
+				t.Error("getIntEnv(): got no error even though we wanted one")
+			} else if err != nil && !tt.wantErr {
+				t.Errorf("getIntEnv(): got an error even though we wanted none, got: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("getIntEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getDurationEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		defaultVal time.Duration
+		setVal     string
+		want       time.Duration
+		wantErr    bool
+	}{
+		{
+			name:   "set",
+			key:    "Test_getDurationEnv",
+			setVal: "1m30s",
+			want:   90 * time.Second,
+		},
+		{
+			name:       "not set with default",
+			key:        "Test_getDurationEnv",
+			defaultVal: time.Second,
+			want:       time.Second,
+		},
+		{
+			name:       "set zero with default",
+			key:        "Test_getDurationEnv",
+			defaultVal: time.Second,
+			setVal:     "0",
+			want:       0,
+		},
+		{
+			name:    "set non-duration",
+			key:     "Test_getDurationEnv",
+			setVal:  "10",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			os.Clearenv()
+
+			if tt.setVal != "" {
+				os.Setenv(tt.key, tt.setVal)
+				defer os.Setenv(tt.key, "")
+			}
+
+			got, err := getDurationEnv(tt.key, tt.defaultVal)
+			if err == nil && tt.wantErr {
+				t.Error("getDurationEnv(): got no error even though we wanted one")
+			} else if err != nil && !tt.wantErr {
+				t.Errorf("getDurationEnv(): got an error even though we wanted none, got: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("getDurationEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_getBoolEnv(t *testing.T) {
 	type args struct {
 		key        string
@@ -147,3 +372,33 @@ func Test_getBoolEnv(t *testing.T) {
 		})
 	}
 }
+
+func Test_setRecovery(t *testing.T) {
+
+	cfg := &config.Config{NFSv4: &config.NFSv4{Graceless: true, LeaseLifetime: 30}}
+	setRecovery(cfg, "/recovery")
+
+	want := &config.NFSv4{RecoveryBackend: recovery.Backend, RecoveryRoot: "/recovery", LeaseLifetime: 30}
+	if !reflect.DeepEqual(cfg.NFSv4, want) {
+		t.Errorf("setRecovery() NFSv4 = %+v, want %+v", cfg.NFSv4, want)
+	}
+	if !usesRecovery(cfg, "/recovery") {
+		t.Error("usesRecovery() = false, want true")
+	}
+}
+
+func Test_restartConfig(t *testing.T) {
+
+	cfg := &config.Config{NFSv4: &config.NFSv4{Graceless: true, LeaseLifetime: 30}}
+
+	if got := restartConfig(cfg, false); !got.NFSv4.Graceless {
+		t.Error("restartConfig() without grace allows grace")
+	}
+	got := restartConfig(cfg, true)
+	if got.NFSv4.Graceless || got.NFSv4.LeaseLifetime != 30 {
+		t.Errorf("restartConfig() with grace NFSv4 = %+v, want Graceless false and Lease_Lifetime 30", got.NFSv4)
+	}
+	if !cfg.NFSv4.Graceless {
+		t.Error("restartConfig() changed the running config")
+	}
+}
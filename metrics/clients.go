@@ -1,253 +1,519 @@
 package metrics
 
 import (
-	"log"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/storageos/nfs/ganesha"
+	"github.com/storageos/nfs/logger"
 )
 
 var clientsPrefix = "storageos_clients"
 
+// clientLabelNames are the labels used for per-client metrics.
+var clientLabelNames = []string{"op", "name", "namespace", "clientip", "client_pod", "client_namespace"}
+
+// clientIODescriptors returns the descriptors for a client stats family.
+// metric is the protocol part of the metric name and protocol its
+// description, e.g. "nfs_v40" and "NFSv4.0".
+func clientIODescriptors(metric string, protocol string) IODescriptors {
+	labels := clientLabelNames
+	return IODescriptors{
+		Requested: prometheus.NewDesc(
+			clientsPrefix+"_"+metric+"_requested_bytes_total",
+			"Number of requested bytes for "+protocol+" operations",
+			labels, nil,
+		),
+		Transferred: prometheus.NewDesc(
+			clientsPrefix+"_"+metric+"_transfered_bytes_total",
+			"Number of transfered bytes for "+protocol+" operations",
+			labels, nil,
+		),
+		Operations: prometheus.NewDesc(
+			clientsPrefix+"_"+metric+"_operations_total",
+			"Number of operations for "+protocol,
+			labels, nil,
+		),
+		Errors: prometheus.NewDesc(
+			clientsPrefix+"_"+metric+"_operations_errors_total",
+			"Number of operations in error for "+protocol,
+			labels, nil,
+		),
+		Latency: prometheus.NewDesc(
+			clientsPrefix+"_"+metric+"_operations_latency_seconds_total",
+			"Cumulative time consumed by operations for "+protocol,
+			labels, nil,
+		),
+		QueueWait: prometheus.NewDesc(
+			clientsPrefix+"_"+metric+"_operations_queue_wait_seconds_total",
+			"Cumulative time spent in rpc wait queue for "+protocol,
+			labels, nil,
+		),
+	}
+}
+
+var clientDescriptors = map[ganesha.ClientStatsFamily]IODescriptors{
+	ganesha.ClientStatsNFSv3:  clientIODescriptors("nfs_v3", "NFSv3"),
+	ganesha.ClientStatsNFSv40: clientIODescriptors("nfs_v40", "NFSv4.0"),
+	ganesha.ClientStatsNFSv41: clientIODescriptors("nfs_v41", "NFSv4.1"),
+	ganesha.ClientStatsNFSv42: clientIODescriptors("nfs_v42", "NFSv4.2"),
+	ganesha.ClientStatsNLM:    clientIODescriptors("nlm_v4", "NLMv4"),
+	ganesha.ClientStatsMNT:    clientIODescriptors("mnt_v3", "MNTv3"),
+}
+
 var (
-	clientsNfsV40RequestedDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v40_requested_bytes_total",
-		"Number of requested bytes for NFSv4.0 operations",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
-	)
-	clientsNfsV40TransferedDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v40_transfered_bytes_total",
-		"Number of transfered bytes for NFSv4.0 operations",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
-	)
-	clientsNfsV40OperationsDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v40_operations_total",
-		"Number of operations for NFSv4.0",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
-	)
-	clientsNfsV40ErrorsDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v40_operations_errors_total",
-		"Number of operations in error for NFSv4.0",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
-	)
-	clientsNfsV40LatencyDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v40_operations_latency_seconds_total",
-		"Cumulative time consumed by operations for NFSv4.0",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
-	)
-	clientsNfsV40QueueWaitDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v40_operations_queue_wait_seconds_total",
-		"Cumulative time spent in rpc wait queue for NFSv4.0",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
-	)
-	clientsNfsV41RequestedDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v41_requested_bytes_total",
-		"Number of requested bytes for NFSv4.1 operations",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
-	)
-	clientsNfsV41TransferedDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v41_transfered_bytes_total",
-		"Number of transfered bytes for NFSv4.1 operations",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
-	)
-	clientsNfsV41OperationsDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v41_operations_total",
-		"Number of operations for NFSv4.1",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
+	clientsAllOpsDesc = prometheus.NewDesc(
+		clientsPrefix+"_all_operations_total",
+		"Number of operations by operation across all protocols",
+		clientLabelNames, nil,
 	)
-	clientsNfsV41ErrorsDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v41_operations_errors_total",
-		"Number of operations in error for NFSv4.1",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
+	clientsAllOpsErrorsDesc = prometheus.NewDesc(
+		clientsPrefix+"_all_operations_errors_total",
+		"Number of operations in error by operation across all protocols",
+		clientLabelNames, nil,
 	)
-	clientsNfsV41LatencyDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v41_operations_latency_seconds_total",
-		"Cumulative time consumed by operations for NFSv4.1",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
+	clientsStatsInfoDesc = prometheus.NewDesc(
+		clientsPrefix+"_stats_info",
+		"Client stats families and whether the running NFS server supports them",
+		[]string{"family", "supported", "name", "namespace"}, nil,
 	)
-	clientsNfsV41QueueWaitDesc = prometheus.NewDesc(
-		clientsPrefix+"_nfs_v41_operations_queue_wait_seconds_total",
-		"Cumulative time spent in rpc wait queue for NFSv4.1",
-		[]string{"op", "name", "namespace", "clientip"}, nil,
+	clientsOmittedDesc = prometheus.NewDesc(
+		clientsPrefix+"_omitted",
+		"Number of active clients summed as clientip=\"other\" due to the client limit",
+		[]string{"name", "namespace"}, nil,
 	)
 )
 
+// otherClientIP is the clientip label of the clients not reported
+// individually due to the client limit.
+const otherClientIP = "other"
+
+// ClientLimits bound the number of client label sets reported.
+type ClientLimits struct {
+	// MaxClients is the number of clients with the most traffic that are
+	// reported.  The remaining clients are summed and reported as
+	// clientip="other".  0 reports all clients.
+	MaxClients int
+
+	// IdleTimeout drops clients with no activity for longer than the timeout.
+	// 0 reports clients until the server restarts.
+	IdleTimeout time.Duration
+}
+
+// clientStats holds the stats collected for a single client.
+type clientStats struct {
+	ip       string
+	identity ClientIdentity
+	io       map[ganesha.ClientStatsFamily]*ganesha.BasicStats
+	allOps   map[string]ganesha.OpCount
+}
+
+func newClientStats(ip string) *clientStats {
+	return &clientStats{
+		ip:     ip,
+		io:     make(map[ganesha.ClientStatsFamily]*ganesha.BasicStats),
+		allOps: make(map[string]ganesha.OpCount),
+	}
+}
+
+// traffic returns the total bytes transferred by the client.
+func (s *clientStats) traffic() uint64 {
+	var total uint64
+	for _, stats := range s.io {
+		total += stats.Read.Transfered + stats.Write.Transfered
+	}
+	return total
+}
+
+// add sums the stats of other into s.
+func (s *clientStats) add(other *clientStats) {
+	for family, stats := range other.io {
+		sum, ok := s.io[family]
+		if !ok {
+			sum = &ganesha.BasicStats{}
+			s.io[family] = sum
+		}
+		addBasicIO(&sum.Read, stats.Read)
+		addBasicIO(&sum.Write, stats.Write)
+	}
+	for name, op := range other.allOps {
+		sum := s.allOps[name]
+		sum.Op = name
+		sum.Total += op.Total
+		sum.Errors += op.Errors
+		s.allOps[name] = sum
+	}
+}
+
+func addBasicIO(sum *ganesha.BasicIO, io ganesha.BasicIO) {
+	sum.Requested += io.Requested
+	sum.Transfered += io.Transfered
+	sum.Total += io.Total
+	sum.Errors += io.Errors
+	sum.Latency += io.Latency
+	sum.QueueWait += io.QueueWait
+}
+
+// clientStatsReader reads the clients and their stats from the NFS server.
+// It is implemented by *ganesha.ClientMgr.
+type clientStatsReader interface {
+	ShowClients() ([]ganesha.Client, error)
+	ProbeStats() (map[ganesha.ClientStatsFamily]bool, error)
+	GetNFSv3IO(id ganesha.ClientID) (*ganesha.BasicStats, error)
+	GetNFSv40IO(id ganesha.ClientID) (*ganesha.BasicStats, error)
+	GetNFSv41IO(id ganesha.ClientID) (*ganesha.BasicStats, error)
+	GetNFSv42IO(id ganesha.ClientID) (*ganesha.BasicStats, error)
+	GetNLMIO(id ganesha.ClientID) (*ganesha.BasicStats, error)
+	GetMNTIO(id ganesha.ClientID) (*ganesha.BasicStats, error)
+	GetClientAllOps(id ganesha.ClientID) (*ganesha.ClientAllOps, error)
+}
+
+// cachedClient holds the stats of a client read at readAt, while its last
+// activity was at lastTime.
+type cachedClient struct {
+	stats    *clientStats
+	lastTime time.Time
+	readAt   time.Time
+}
+
+// current returns true if the client has had no activity since its stats were
+// read, given the time of its last activity.  Ganesha records the time of
+// activity to the second, so activity within a second of the read may not
+// have been included.
+func (c cachedClient) current(lastTime time.Time) bool {
+	return lastTime.Equal(c.lastTime) && lastTime.Before(c.readAt.Add(-time.Second))
+}
+
 // ClientsCollector Collector for ganesha clients.
+//
+// The client stats families supported vary between Ganesha versions, so
+// support is probed on collection until the server has answered.  Unsupported
+// families are skipped.
+//
+// Reading a client's stats takes a call per family, so the stats of clients
+// with no activity since they were last read are reused.
 type ClientsCollector struct {
 	name      string
 	namespace string
-	clientMgr *ganesha.ClientMgr
+	limits    ClientLimits
+	resolver  ClientResolver
+	clientMgr clientStatsReader
+	log       *logger.Logger
+
+	// supported is set once the server has answered the probe.  cache holds
+	// the stats of each client as last read, keyed by the address reported
+	// by Ganesha.  They are protected by mu.
+	supported map[ganesha.ClientStatsFamily]bool
+	cache     map[string]cachedClient
+	mu        *sync.Mutex
 }
 
 // NewClientsCollector creates a new collector.
-func NewClientsCollector(name string, namespace string) ClientsCollector {
-
-	mgr, err := ganesha.NewClientMgr()
-	if err != nil {
-		log.Fatal(err)
-	}
-	return ClientsCollector{
+//
+// If resolver is not nil, it is used to label the reported clients' metrics
+// with the pod using the client address.
+func NewClientsCollector(name string, namespace string, limits ClientLimits, resolver ClientResolver, clientMgr *ganesha.ClientMgr, log *logger.Logger) *ClientsCollector {
+	return &ClientsCollector{
 		name:      name,
 		namespace: namespace,
-		clientMgr: mgr,
+		limits:    limits,
+		resolver:  resolver,
+		clientMgr: clientMgr,
+		log:       log,
+		mu:        &sync.Mutex{},
 	}
 }
 
 // Describe prometheus description
-func (c ClientsCollector) Describe(ch chan<- *prometheus.Desc) {
+func (c *ClientsCollector) Describe(ch chan<- *prometheus.Desc) {
 	prometheus.DescribeByCollect(c, ch)
 }
 
 // Collect do the actual job
-func (c ClientsCollector) Collect(ch chan<- prometheus.Metric) {
+//
+// Ganesha never forgets clients, so idle clients are dropped and only the
+// clients with the most traffic are reported individually, as configured by
+// the ClientLimits.
+func (c *ClientsCollector) Collect(ch chan<- prometheus.Metric) {
+
+	var failed bool
+	defer func() { collectScrapeError(ch, "clients", c.name, c.namespace, failed) }()
 
 	clients, err := c.clientMgr.ShowClients()
 	if err != nil {
-		log.Printf("failed to get nfs client list: %v", err)
+		c.log.Warnf("failed to get nfs client list: %v", err)
+		failed = true
 		return
 	}
 
-	for _, client := range clients {
+	supported, err := c.probe()
+	if err != nil {
+		c.log.Warnf("%v", err)
+		failed = true
+		return
+	}
+
+	for family, ok := range supported {
+		supported := "false"
+		if ok {
+			supported = "true"
+		}
+		ch <- prometheus.MustNewConstMetric(
+			clientsStatsInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			string(family), supported, c.name, c.namespace)
+	}
 
-		// Only NFSv40 and NFSv41 client metrics are supported by Ganesha.
+	active := clients[:0:0]
+	for _, client := range clients {
+		if c.limits.IdleTimeout > 0 && time.Since(time.Unix(client.LastTime.Unix())) > c.limits.IdleTimeout {
+			continue
+		}
+		active = append(active, client)
+	}
+	stats := mergeClients(c.readClients(active, supported))
 
-		if client.NFSv40 {
+	if c.limits.MaxClients > 0 {
+		rankClients(stats)
 
-			stats, err := c.clientMgr.GetNFSv40IO(client.Client)
-			if err != nil {
-				log.Printf("failed to get nfs 4.0 stats for client: %v", err)
-				continue
+		omitted := 0
+		if len(stats) > c.limits.MaxClients {
+			omitted = len(stats) - c.limits.MaxClients
+			other := newClientStats(otherClientIP)
+			for _, s := range stats[c.limits.MaxClients:] {
+				other.add(s)
 			}
+			stats = append(stats[:c.limits.MaxClients:c.limits.MaxClients], other)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			clientsOmittedDesc,
+			prometheus.GaugeValue,
+			float64(omitted),
+			c.name, c.namespace)
+	}
 
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40RequestedDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.Requested),
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40TransferedDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.Transfered),
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40OperationsDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.Total),
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40ErrorsDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.Errors),
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40LatencyDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.Latency)/1e9,
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40QueueWaitDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.QueueWait)/1e9,
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40RequestedDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.Requested),
-				"write", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40TransferedDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.Transfered),
-				"write", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40OperationsDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.Total),
-				"write", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40ErrorsDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.Errors),
-				"write", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40LatencyDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.Latency)/1e9,
-				"write", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV40QueueWaitDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.QueueWait)/1e9,
-				"write", c.name, c.namespace, client.Client)
+	for _, s := range stats {
+		if c.resolver != nil && s.ip != otherClientIP {
+			s.identity, _ = c.resolver.Resolve(s.ip)
 		}
-		if client.NFSv41 {
+		c.collectClient(ch, s)
+	}
+}
+
+// readClients returns the stats of each client.  Stats are only read from the
+// server for clients with activity since they were last read, or whose stats
+// could not all be read.
+func (c *ClientsCollector) readClients(clients []ganesha.Client, supported map[ganesha.ClientStatsFamily]bool) []*clientStats {
+
+	c.mu.Lock()
+	cache := c.cache
+	c.mu.Unlock()
 
-			stats, err := c.clientMgr.GetNFSv41IO(client.Client)
-			if err != nil {
-				log.Printf("failed to get nfs 4.1 stats for client: %v", err)
-				continue
+	current := make(map[string]cachedClient, len(clients))
+	stats := make([]*clientStats, 0, len(clients))
+	for _, client := range clients {
+		lastTime := time.Unix(client.LastTime.Unix())
+		cached, ok := cache[client.Client.Orig]
+		if !ok || !cached.current(lastTime) {
+			cached = cachedClient{lastTime: lastTime, readAt: time.Now()}
+			var complete bool
+			if cached.stats, complete = c.clientStats(client, supported); !complete {
+				cached.readAt = time.Time{}
 			}
+		}
+		current[client.Client.Orig] = cached
+		stats = append(stats, cached.stats)
+	}
+
+	c.mu.Lock()
+	c.cache = current
+	c.mu.Unlock()
+
+	return stats
+}
+
+// mergeClients merges the stats of clients with the same canonical address.
+// Ganesha may list a client under both its IPv4 and IPv4-mapped IPv6 address,
+// and both would otherwise be reported with the same labels.
+//
+// The stats returned are new, so the stats given are not modified.
+func mergeClients(stats []*clientStats) []*clientStats {
 
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41RequestedDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.Requested),
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41TransferedDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.Transfered),
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41OperationsDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.Total),
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41ErrorsDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.Errors),
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41LatencyDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.Latency)/1e9,
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41QueueWaitDesc,
-				prometheus.CounterValue,
-				float64(stats.Read.QueueWait)/1e9,
-				"read", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41RequestedDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.Requested),
-				"write", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41TransferedDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.Transfered),
-				"write", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41OperationsDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.Total),
-				"write", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41ErrorsDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.Errors),
-				"write", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41LatencyDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.Latency)/1e9,
-				"write", c.name, c.namespace, client.Client)
-			ch <- prometheus.MustNewConstMetric(
-				clientsNfsV41QueueWaitDesc,
-				prometheus.CounterValue,
-				float64(stats.Write.QueueWait)/1e9,
-				"write", c.name, c.namespace, client.Client)
+	merged := make([]*clientStats, 0, len(stats))
+	byIP := make(map[string]*clientStats, len(stats))
+	for _, s := range stats {
+		sum, ok := byIP[s.ip]
+		if !ok {
+			sum = newClientStats(s.ip)
+			byIP[s.ip] = sum
+			merged = append(merged, sum)
 		}
+		sum.add(s)
 	}
+	return merged
+}
+
+// rankClients sorts the clients by their total traffic, most first.  The
+// ranking depends only on the server's counters, so every scraper is given
+// the same clients.
+func rankClients(stats []*clientStats) {
+
+	traffic := make(map[*clientStats]uint64, len(stats))
+	for _, s := range stats {
+		traffic[s] = s.traffic()
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if traffic[stats[i]] != traffic[stats[j]] {
+			return traffic[stats[i]] > traffic[stats[j]]
+		}
+		return stats[i].ip < stats[j].ip
+	})
+}
+
+// probe returns the client stats families supported by the server, probing
+// until the server gives a definitive answer.
+func (c *ClientsCollector) probe() (map[ganesha.ClientStatsFamily]bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.supported != nil {
+		return c.supported, nil
+	}
+	supported, err := c.clientMgr.ProbeStats()
+	if err != nil {
+		return nil, err
+	}
+	for family, ok := range supported {
+		if !ok {
+			c.log.Infof("nfs client stats not supported by nfs server: %s", family)
+		}
+	}
+	c.supported = supported
+	return supported, nil
+}
+
+// clientStats reads the stats for each family used by the client and
+// supported by the server.  Families that fail to be read are logged and
+// skipped, and complete is false.
+func (c *ClientsCollector) clientStats(client ganesha.Client, supported map[ganesha.ClientStatsFamily]bool) (out *clientStats, complete bool) {
+
+	out = newClientStats(client.Client.String())
+	complete = true
+
+	// RQUOTA and 9P client metrics are not supported by Ganesha.
+	families := map[ganesha.ClientStatsFamily]bool{
+		ganesha.ClientStatsNFSv3:  client.NFSv3,
+		ganesha.ClientStatsNFSv40: client.NFSv40,
+		ganesha.ClientStatsNFSv41: client.NFSv41,
+		ganesha.ClientStatsNFSv42: client.NFSv42,
+		ganesha.ClientStatsNLM:    client.NLMv4,
+		ganesha.ClientStatsMNT:    client.MNTv3,
+	}
+	for family, used := range families {
+		if !used || !supported[family] {
+			continue
+		}
+
+		var stats *ganesha.BasicStats
+		var err error
+
+		switch family {
+		case ganesha.ClientStatsNFSv3:
+			stats, err = c.clientMgr.GetNFSv3IO(client.Client)
+		case ganesha.ClientStatsNFSv40:
+			stats, err = c.clientMgr.GetNFSv40IO(client.Client)
+		case ganesha.ClientStatsNFSv41:
+			stats, err = c.clientMgr.GetNFSv41IO(client.Client)
+		case ganesha.ClientStatsNFSv42:
+			stats, err = c.clientMgr.GetNFSv42IO(client.Client)
+		case ganesha.ClientStatsNLM:
+			stats, err = c.clientMgr.GetNLMIO(client.Client)
+		case ganesha.ClientStatsMNT:
+			stats, err = c.clientMgr.GetMNTIO(client.Client)
+		}
+		if err != nil {
+			c.log.With(logger.ClientIPKey, client.Client.String()).Warnf("failed to get %s stats for client: %v", family, err)
+			complete = false
+			continue
+		}
+		if stats.Status {
+			out.io[family] = stats
+		}
+	}
+
+	// Nothing is collected until client all-ops stats have been enabled.
+	if supported[ganesha.ClientStatsAllOps] {
+		stats, err := c.clientMgr.GetClientAllOps(client.Client)
+		if err != nil {
+			c.log.With(logger.ClientIPKey, client.Client.String()).Warnf("failed to get all operation stats for client: %v", err)
+			complete = false
+		} else if stats.Status {
+			for _, op := range stats.Ops {
+				out.allOps[op.Op] = op
+			}
+		}
+	}
+
+	return out, complete
+}
+
+// collectClient collects the metrics for a client.
+func (c *ClientsCollector) collectClient(ch chan<- prometheus.Metric, s *clientStats) {
+
+	for family, stats := range s.io {
+		desc := clientDescriptors[family]
+		c.collectBasicIO(ch, desc, "read", stats.Read, s)
+		c.collectBasicIO(ch, desc, "write", stats.Write, s)
+	}
+
+	for _, op := range s.allOps {
+		ch <- prometheus.MustNewConstMetric(
+			clientsAllOpsDesc,
+			prometheus.CounterValue,
+			float64(op.Total),
+			op.Op, c.name, c.namespace, s.ip, s.identity.Pod, s.identity.Namespace)
+		ch <- prometheus.MustNewConstMetric(
+			clientsAllOpsErrorsDesc,
+			prometheus.CounterValue,
+			float64(op.Errors),
+			op.Op, c.name, c.namespace, s.ip, s.identity.Pod, s.identity.Namespace)
+	}
+}
+
+// collectBasicIO collects the counters for read or write operations.
+func (c *ClientsCollector) collectBasicIO(ch chan<- prometheus.Metric, desc IODescriptors, op string, io ganesha.BasicIO, s *clientStats) {
+	ch <- prometheus.MustNewConstMetric(
+		desc.Requested,
+		prometheus.CounterValue,
+		float64(io.Requested),
+		op, c.name, c.namespace, s.ip, s.identity.Pod, s.identity.Namespace)
+	ch <- prometheus.MustNewConstMetric(
+		desc.Transferred,
+		prometheus.CounterValue,
+		float64(io.Transfered),
+		op, c.name, c.namespace, s.ip, s.identity.Pod, s.identity.Namespace)
+	ch <- prometheus.MustNewConstMetric(
+		desc.Operations,
+		prometheus.CounterValue,
+		float64(io.Total),
+		op, c.name, c.namespace, s.ip, s.identity.Pod, s.identity.Namespace)
+	ch <- prometheus.MustNewConstMetric(
+		desc.Errors,
+		prometheus.CounterValue,
+		float64(io.Errors),
+		op, c.name, c.namespace, s.ip, s.identity.Pod, s.identity.Namespace)
+	ch <- prometheus.MustNewConstMetric(
+		desc.Latency,
+		prometheus.CounterValue,
+		float64(io.Latency)/1e9,
+		op, c.name, c.namespace, s.ip, s.identity.Pod, s.identity.Namespace)
+	ch <- prometheus.MustNewConstMetric(
+		desc.QueueWait,
+		prometheus.CounterValue,
+		float64(io.QueueWait)/1e9,
+		op, c.name, c.namespace, s.ip, s.identity.Pod, s.identity.Namespace)
 }
@@ -0,0 +1,214 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/storageos/nfs/ganesha"
+	"golang.org/x/sys/unix"
+)
+
+// testClient returns the stats of a client that read and wrote bytes over
+// NFSv4.1.
+func testClient(ip string, read, write uint64) *clientStats {
+	return &clientStats{
+		ip: ip,
+		io: map[ganesha.ClientStatsFamily]*ganesha.BasicStats{
+			ganesha.ClientStatsNFSv41: {
+				Read:  ganesha.BasicIO{Transfered: read, Total: 1},
+				Write: ganesha.BasicIO{Transfered: write, Total: 1},
+			},
+		},
+		allOps: map[string]ganesha.OpCount{
+			"READ": {Op: "READ", Total: 1},
+		},
+	}
+}
+
+func TestClientStatsAdd(t *testing.T) {
+
+	s := testClient("10.0.0.1", 10, 20)
+	other := testClient("10.0.0.1", 1, 2)
+	other.io[ganesha.ClientStatsNFSv3] = &ganesha.BasicStats{
+		Read: ganesha.BasicIO{Transfered: 100, Errors: 1},
+	}
+	other.allOps["WRITE"] = ganesha.OpCount{Op: "WRITE", Total: 2, Errors: 1}
+
+	s.add(other)
+
+	if got := s.traffic(); got != 133 {
+		t.Errorf("traffic() = %d, want 133", got)
+	}
+	v41 := s.io[ganesha.ClientStatsNFSv41]
+	if v41.Read.Transfered != 11 || v41.Write.Transfered != 22 || v41.Read.Total != 2 {
+		t.Errorf("NFSv4.1 stats = %+v", v41)
+	}
+	if v3 := s.io[ganesha.ClientStatsNFSv3]; v3 == nil || v3.Read.Errors != 1 {
+		t.Errorf("NFSv3 stats = %+v, want added", v3)
+	}
+	want := map[string]ganesha.OpCount{
+		"READ":  {Op: "READ", Total: 2},
+		"WRITE": {Op: "WRITE", Total: 2, Errors: 1},
+	}
+	if !reflect.DeepEqual(s.allOps, want) {
+		t.Errorf("allOps = %+v, want %+v", s.allOps, want)
+	}
+}
+
+func TestMergeClients(t *testing.T) {
+
+	var stats []*clientStats
+	for _, client := range []struct {
+		addr  string
+		read  uint64
+		write uint64
+	}{
+		{"::ffff:10.0.0.1", 10, 20},
+		{"10.0.0.2", 5, 5},
+		{"10.0.0.1", 1, 2},
+	} {
+		id, err := ganesha.ParseClientID(client.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats = append(stats, testClient(id.String(), client.read, client.write))
+	}
+
+	merged := mergeClients(stats)
+
+	if len(merged) != 2 {
+		t.Fatalf("mergeClients() returned %d clients, want 2", len(merged))
+	}
+	if merged[0].ip != "10.0.0.1" || merged[0].traffic() != 33 {
+		t.Errorf("merged client = %s with traffic %d, want 10.0.0.1 with 33", merged[0].ip, merged[0].traffic())
+	}
+	if got := merged[0].allOps["READ"].Total; got != 2 {
+		t.Errorf("merged READ total = %d, want 2", got)
+	}
+	if merged[1].ip != "10.0.0.2" || merged[1].traffic() != 10 {
+		t.Errorf("second client = %s with traffic %d, want 10.0.0.2 with 10", merged[1].ip, merged[1].traffic())
+	}
+}
+
+func TestRankClients(t *testing.T) {
+
+	stats := []*clientStats{
+		testClient("10.0.0.1", 100, 0),
+		testClient("10.0.0.2", 500, 0),
+		testClient("10.0.0.3", 50, 50),
+	}
+	rankClients(stats)
+
+	var got []string
+	for _, s := range stats {
+		got = append(got, s.ip)
+	}
+	if want := []string{"10.0.0.2", "10.0.0.1", "10.0.0.3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ranking = %v, want %v", got, want)
+	}
+}
+
+// fakeClientStats returns the stats it holds for each client, and counts the
+// calls made for each client.
+type fakeClientStats struct {
+	clients []ganesha.Client
+	v41     map[string]*ganesha.BasicStats
+	calls   map[string]int
+}
+
+func (f *fakeClientStats) ShowClients() ([]ganesha.Client, error) {
+	return f.clients, nil
+}
+
+func (f *fakeClientStats) ProbeStats() (map[ganesha.ClientStatsFamily]bool, error) {
+	return map[ganesha.ClientStatsFamily]bool{ganesha.ClientStatsNFSv41: true}, nil
+}
+
+func (f *fakeClientStats) GetNFSv41IO(id ganesha.ClientID) (*ganesha.BasicStats, error) {
+	f.calls[id.Orig]++
+	return f.v41[id.Orig], nil
+}
+
+func (f *fakeClientStats) unsupported() (*ganesha.BasicStats, error) {
+	return nil, errors.New("unsupported")
+}
+
+func (f *fakeClientStats) GetNFSv3IO(ganesha.ClientID) (*ganesha.BasicStats, error) {
+	return f.unsupported()
+}
+func (f *fakeClientStats) GetNFSv40IO(ganesha.ClientID) (*ganesha.BasicStats, error) {
+	return f.unsupported()
+}
+func (f *fakeClientStats) GetNFSv42IO(ganesha.ClientID) (*ganesha.BasicStats, error) {
+	return f.unsupported()
+}
+func (f *fakeClientStats) GetNLMIO(ganesha.ClientID) (*ganesha.BasicStats, error) {
+	return f.unsupported()
+}
+func (f *fakeClientStats) GetMNTIO(ganesha.ClientID) (*ganesha.BasicStats, error) {
+	return f.unsupported()
+}
+func (f *fakeClientStats) GetClientAllOps(ganesha.ClientID) (*ganesha.ClientAllOps, error) {
+	return nil, errors.New("unsupported")
+}
+
+func TestClientsCollector(t *testing.T) {
+
+	idle := unix.NsecToTimespec(time.Now().Add(-time.Hour).UnixNano())
+	fake := &fakeClientStats{calls: make(map[string]int)}
+	for i, read := range []uint64{100, 500, 30, 20} {
+		addr := fmt.Sprintf("10.0.0.%d", i+1)
+		id, err := ganesha.ParseClientID(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fake.clients = append(fake.clients, ganesha.Client{Client: id, NFSv41: true, LastTime: idle})
+		if fake.v41 == nil {
+			fake.v41 = make(map[string]*ganesha.BasicStats)
+		}
+		fake.v41[addr] = &ganesha.BasicStats{StatsBaseAnswer: statsOK, Read: ganesha.BasicIO{Transfered: read, Total: 1}}
+	}
+
+	c := NewClientsCollector("pvc-1", "default", ClientLimits{MaxClients: 2}, nil, nil, nil)
+	c.clientMgr = fake
+
+	key := func(metric, ip string) string {
+		return fmt.Sprintf(`storageos_clients_nfs_v41_%s{client_namespace="",client_pod="",clientip=%q,name="pvc-1",namespace="default",op="read"}`, metric, ip)
+	}
+
+	// The busiest clients are reported, and the rest summed as "other".
+	got := collect(t, c)
+	want := map[string]float64{
+		key("transfered_bytes_total", "10.0.0.2"):                     500,
+		key("transfered_bytes_total", "10.0.0.1"):                     100,
+		key("transfered_bytes_total", "other"):                        50,
+		key("operations_total", "other"):                              2,
+		`storageos_clients_omitted{name="pvc-1",namespace="default"}`: 2,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if _, ok := got[key("transfered_bytes_total", "10.0.0.3")]; ok {
+		t.Error("omitted client 10.0.0.3 reported individually")
+	}
+
+	// Idle clients are not read again, and clients with activity are.
+	fake.clients[2].LastTime = unix.NsecToTimespec(time.Now().Add(-time.Minute).UnixNano())
+	fake.v41["10.0.0.3"].Read.Transfered = 1000
+	got = collect(t, c)
+	if got[key("transfered_bytes_total", "10.0.0.3")] != 1000 {
+		t.Errorf("active client not read again: %v", got)
+	}
+	if got[key("transfered_bytes_total", "other")] != 120 {
+		t.Errorf("other transfered = %v, want 120", got[key("transfered_bytes_total", "other")])
+	}
+	wantCalls := map[string]int{"10.0.0.1": 1, "10.0.0.2": 1, "10.0.0.3": 2, "10.0.0.4": 1}
+	if !reflect.DeepEqual(fake.calls, wantCalls) {
+		t.Errorf("calls = %v, want %v", fake.calls, wantCalls)
+	}
+}
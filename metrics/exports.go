@@ -1,135 +1,153 @@
 package metrics
 
 import (
-	"log"
+	"strconv"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/storageos/nfs/ganesha"
+	"github.com/storageos/nfs/logger"
 )
 
 const (
 	exportsPrefix = "storageos"
 )
 
+// exportLabelNames are the labels used for per-export metrics.
+var exportLabelNames = []string{"op", "name", "namespace", "export_id", "pseudo"}
+
 var exportDescriptors = map[string]IODescriptors{
 	NFSv40: IODescriptors{
 		Requested: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v40_requested_bytes_total",
 			"Number of requested bytes for NFSv4.0 operations",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Transferred: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v40_transfered_bytes_total",
 			"Number of transfered bytes for NFSv4.0 operations",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Operations: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v40_operations_total",
 			"Number of operations for NFSv4.0",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Errors: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v40_operations_errors_total",
 			"Number of operations in error for NFSv4.0",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Latency: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v40_operations_latency_seconds_total",
 			"Cumulative time consumed by operations for NFSv4.0",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		QueueWait: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v40_operations_queue_wait_seconds_total",
 			"Cumulative time spent in rpc wait queue for NFSv4.0",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 	},
 	NFSv41: IODescriptors{
 		Requested: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v41_requested_bytes_total",
 			"Number of requested bytes for NFSv4.1 operations",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Transferred: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v41_transfered_bytes_total",
 			"Number of transfered bytes for NFSv4.1 operations",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Operations: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v41_operations_total",
 			"Number of operations for NFSv4.1",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Errors: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v41_operations_errors_total",
 			"Number of operations in error for NFSv4.1",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Latency: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v41_operations_latency_seconds_total",
 			"Cumulative time consumed by operations for NFSv4.1",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		QueueWait: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v41_operations_queue_wait_seconds_total",
 			"Cumulative time spent in rpc wait queue for NFSv4.1",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 	},
 	NFSv42: IODescriptors{
 		Requested: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v42_requested_bytes_total",
 			"Number of requested bytes for NFSv4.2 operations",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Transferred: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v42_transfered_bytes_total",
 			"Number of transfered bytes for NFSv4.2 operations",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Operations: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v42_operations_total",
 			"Number of operations for NFSv4.2",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Errors: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v42_operations_errors_total",
 			"Number of operations in error for NFSv4.2",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		Latency: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v42_operations_latency_seconds_total",
 			"Cumulative time consumed by operations for NFSv4.2",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 		QueueWait: prometheus.NewDesc(
 			exportsPrefix+"_nfs_v42_operations_queue_wait_seconds_total",
 			"Cumulative time spent in rpc wait queue for NFSv4.2",
-			[]string{"op", "name", "namespace"}, nil,
+			exportLabelNames, nil,
 		),
 	},
 }
 
+// exportStats reads the exports and their stats from the NFS server.  It is
+// implemented by *ganesha.ExportMgr.
+type exportStats interface {
+	ShowExports() ([]ganesha.Export, error)
+	DisplayExport(id uint16) (*ganesha.ExportDetails, error)
+	GetIOStats() (*ganesha.ExportIOStatsList, error)
+	GetFullV4Stats() (*ganesha.FullV4Stats, error)
+	GetGlobalOPS() (*ganesha.OPSStats, error)
+	GetTotalOPS(id uint16) (*ganesha.OPSStats, error)
+	GetFSALStats(fsal string) (*ganesha.FSALStats, error)
+	ShowMDCache() (*ganesha.MDCacheStats, error)
+}
+
 // ExportsCollector for NFS exports.
 type ExportsCollector struct {
 	name      string
 	namespace string
-	exportMgr *ganesha.ExportMgr
+	volumes   map[uint16]Volume
+	exportMgr exportStats
+	log       *logger.Logger
 }
 
 // NewExportsCollector creates a new collector for NFS exports.
 //
 // name and namespace should be set to the PVC name and namespace to label the
-// metrics for the export.
-func NewExportsCollector(name string, namespace string) ExportsCollector {
-	mgr, err := ganesha.NewExportMgr()
-	if err != nil {
-		log.Fatal(err)
-	}
+// metrics for exports that are not in volumes.  volumes maps export IDs to the
+// PVC they serve, and may be nil when the server has a single export.
+func NewExportsCollector(name string, namespace string, volumes map[uint16]Volume, exportMgr *ganesha.ExportMgr, log *logger.Logger) ExportsCollector {
 	return ExportsCollector{
 		name:      name,
 		namespace: namespace,
-		exportMgr: mgr,
+		volumes:   volumes,
+		exportMgr: exportMgr,
+		log:       log,
 	}
 }
 
@@ -140,19 +158,26 @@ func (c ExportsCollector) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect IO stats for NFS exports.
 //
-// We expect there to be a single export per server, but GetIOStats will return
-// an export record for each protocol that was used to access.  Each record will
-// have the same ExportID.
-//
-// If we ever support multiple exports per server then the ExportID should be
-// added as a label.  Since the ExportID is only used internally, we label with
-// the PVC name & namespace instead so that user's can correlate with references
-// they understand.
+// GetIOStats returns an export record for each protocol that was used to
+// access an export.  Records are labeled with the export's ExportID and pseudo
+// path, and the name & namespace of the PVC it serves so that user's can
+// correlate with references they understand.
 func (c ExportsCollector) Collect(ch chan<- prometheus.Metric) {
 
+	var failed bool
+	defer func() { collectScrapeError(ch, "exports", c.name, c.namespace, failed) }()
+
 	stats, err := c.exportMgr.GetIOStats()
 	if err != nil {
-		log.Printf("failed to get nfs stats for exports: %v", err)
+		c.log.Warnf("failed to get nfs stats for exports: %v", err)
+		failed = true
+		return
+	}
+
+	labels, err := exportLabels(c.exportMgr, c.name, c.namespace, c.volumes)
+	if err != nil {
+		c.log.Warnf("failed to get nfs export list: %v", err)
+		failed = true
 		return
 	}
 
@@ -161,70 +186,90 @@ func (c ExportsCollector) Collect(ch chan<- prometheus.Metric) {
 		// Get descriptors for the export's specific NFS version.
 		desc, ok := exportDescriptors[export.Name]
 		if !ok {
-			log.Printf("unhandled NFS version: %s", export.Name)
+			c.log.With(logger.ExportIDKey, export.ExportID).Warnf("unhandled NFS version: %s", export.Name)
+			continue
+		}
+
+		l, ok := labels[export.ExportID]
+		if !ok {
+			// The export was added since the list was read.
 			continue
 		}
 
-		ch <- prometheus.MustNewConstMetric(
-			desc.Requested,
-			prometheus.CounterValue,
-			float64(export.Read.Requested),
-			"read", c.name, c.namespace)
-		ch <- prometheus.MustNewConstMetric(
-			desc.Transferred,
-			prometheus.CounterValue,
-			float64(export.Read.Transfered),
-			"read", c.name, c.namespace)
-		ch <- prometheus.MustNewConstMetric(
-			desc.Operations,
-			prometheus.CounterValue,
-			float64(export.Read.Total),
-			"read", c.name, c.namespace)
-		ch <- prometheus.MustNewConstMetric(
-			desc.Errors,
-			prometheus.CounterValue,
-			float64(export.Read.Errors),
-			"read", c.name, c.namespace)
-		ch <- prometheus.MustNewConstMetric(
-			desc.Latency,
-			prometheus.CounterValue,
-			float64(export.Read.Latency)/1e9,
-			"read", c.name, c.namespace)
-		ch <- prometheus.MustNewConstMetric(
-			desc.QueueWait,
-			prometheus.CounterValue,
-			float64(export.Read.QueueWait)/1e9,
-			"read", c.name, c.namespace)
-
-		ch <- prometheus.MustNewConstMetric(
-			desc.Requested,
-			prometheus.CounterValue,
-			float64(export.Write.Requested),
-			"write", c.name, c.namespace)
-		ch <- prometheus.MustNewConstMetric(
-			desc.Transferred,
-			prometheus.CounterValue,
-			float64(export.Write.Transfered),
-			"write", c.name, c.namespace)
-		ch <- prometheus.MustNewConstMetric(
-			desc.Operations,
-			prometheus.CounterValue,
-			float64(export.Write.Total),
-			"write", c.name, c.namespace)
-		ch <- prometheus.MustNewConstMetric(
-			desc.Errors,
-			prometheus.CounterValue,
-			float64(export.Write.Errors),
-			"write", c.name, c.namespace)
-		ch <- prometheus.MustNewConstMetric(
-			desc.Latency,
-			prometheus.CounterValue,
-			float64(export.Write.Latency)/1e9,
-			"write", c.name, c.namespace)
-		ch <- prometheus.MustNewConstMetric(
-			desc.QueueWait,
-			prometheus.CounterValue,
-			float64(export.Write.QueueWait)/1e9,
-			"write", c.name, c.namespace)
+		collectExportIO(ch, desc, "read", export.Read, l)
+		collectExportIO(ch, desc, "write", export.Write, l)
+	}
+}
+
+// collectExportIO collects the counters for read or write operations on an
+// export.
+func collectExportIO(ch chan<- prometheus.Metric, desc IODescriptors, op string, io ganesha.BasicIO, l exportLabelValues) {
+	ch <- prometheus.MustNewConstMetric(
+		desc.Requested,
+		prometheus.CounterValue,
+		float64(io.Requested),
+		op, l.name, l.namespace, l.exportID, l.pseudo)
+	ch <- prometheus.MustNewConstMetric(
+		desc.Transferred,
+		prometheus.CounterValue,
+		float64(io.Transfered),
+		op, l.name, l.namespace, l.exportID, l.pseudo)
+	ch <- prometheus.MustNewConstMetric(
+		desc.Operations,
+		prometheus.CounterValue,
+		float64(io.Total),
+		op, l.name, l.namespace, l.exportID, l.pseudo)
+	ch <- prometheus.MustNewConstMetric(
+		desc.Errors,
+		prometheus.CounterValue,
+		float64(io.Errors),
+		op, l.name, l.namespace, l.exportID, l.pseudo)
+	ch <- prometheus.MustNewConstMetric(
+		desc.Latency,
+		prometheus.CounterValue,
+		float64(io.Latency)/1e9,
+		op, l.name, l.namespace, l.exportID, l.pseudo)
+	ch <- prometheus.MustNewConstMetric(
+		desc.QueueWait,
+		prometheus.CounterValue,
+		float64(io.QueueWait)/1e9,
+		op, l.name, l.namespace, l.exportID, l.pseudo)
+}
+
+// exportLabelValues holds the label values identifying an export.
+type exportLabelValues struct {
+	name      string
+	namespace string
+	exportID  string
+	pseudo    string
+}
+
+// exportLabels returns the label values for each active export, keyed by
+// ExportID.
+//
+// Exports are labeled with the PVC from volumes, or name and namespace if not
+// listed.  The pseudo path is left empty if it can't be read.
+func exportLabels(mgr exportStats, name string, namespace string, volumes map[uint16]Volume) (map[uint16]exportLabelValues, error) {
+
+	exports, err := mgr.ShowExports()
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[uint16]exportLabelValues, len(exports))
+	for _, export := range exports {
+		l := exportLabelValues{
+			name:      name,
+			namespace: namespace,
+			exportID:  strconv.Itoa(int(export.ExportID)),
+		}
+		if v, ok := volumes[export.ExportID]; ok {
+			l.name, l.namespace = v.Name, v.Namespace
+		}
+		if details, err := mgr.DisplayExport(export.ExportID); err == nil {
+			l.pseudo = details.Pseudo
+		}
+		labels[export.ExportID] = l
 	}
+	return labels, nil
 }
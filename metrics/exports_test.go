@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/storageos/nfs/ganesha"
+)
+
+// fakeExportStats returns the stats it holds.  Calls fail with err if set,
+// and calls for a single FSAL or export with the error in fsalErrs or
+// exportErrs.
+type fakeExportStats struct {
+	exports    []ganesha.Export
+	details    map[uint16]*ganesha.ExportDetails
+	io         *ganesha.ExportIOStatsList
+	v4         *ganesha.FullV4Stats
+	global     *ganesha.OPSStats
+	total      map[uint16]*ganesha.OPSStats
+	fsal       map[string]*ganesha.FSALStats
+	mdcache    *ganesha.MDCacheStats
+	err        error
+	fsalErrs   map[string]error
+	exportErrs map[uint16]error
+}
+
+func (f *fakeExportStats) ShowExports() ([]ganesha.Export, error) {
+	return f.exports, f.err
+}
+
+func (f *fakeExportStats) DisplayExport(id uint16) (*ganesha.ExportDetails, error) {
+	if details, ok := f.details[id]; ok && f.err == nil {
+		return details, nil
+	}
+	return nil, fmt.Errorf("no export %d", id)
+}
+
+func (f *fakeExportStats) GetIOStats() (*ganesha.ExportIOStatsList, error) {
+	return f.io, f.err
+}
+
+func (f *fakeExportStats) GetFullV4Stats() (*ganesha.FullV4Stats, error) {
+	return f.v4, f.err
+}
+
+func (f *fakeExportStats) GetGlobalOPS() (*ganesha.OPSStats, error) {
+	return f.global, f.err
+}
+
+func (f *fakeExportStats) GetTotalOPS(id uint16) (*ganesha.OPSStats, error) {
+	if err := f.exportErrs[id]; err != nil {
+		return nil, err
+	}
+	return f.total[id], f.err
+}
+
+func (f *fakeExportStats) GetFSALStats(fsal string) (*ganesha.FSALStats, error) {
+	if err := f.fsalErrs[fsal]; err != nil {
+		return nil, err
+	}
+	return f.fsal[fsal], f.err
+}
+
+func (f *fakeExportStats) ShowMDCache() (*ganesha.MDCacheStats, error) {
+	return f.mdcache, f.err
+}
+
+// statsOK is the status of a successful stats response.
+var statsOK = ganesha.StatsBaseAnswer{Status: true}
+
+// collect registers c with a pedantic registry and returns the value of each
+// metric gathered, keyed by name and labels, e.g.
+// `storageos_nfs_v4_ops_total{name="pvc-1",namespace="default",op="OPEN"}`.
+func collect(t *testing.T, c prometheus.Collector) map[string]float64 {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			var labels []string
+			for _, l := range m.GetLabel() {
+				labels = append(labels, fmt.Sprintf("%s=%q", l.GetName(), l.GetValue()))
+			}
+			sort.Strings(labels)
+			key := f.GetName() + "{" + strings.Join(labels, ",") + "}"
+			switch {
+			case m.Counter != nil:
+				values[key] = m.GetCounter().GetValue()
+			case m.Gauge != nil:
+				values[key] = m.GetGauge().GetValue()
+			default:
+				t.Fatalf("unexpected metric type for %s", key)
+			}
+		}
+	}
+	return values
+}
+
+// scrapeErrorKey returns the collect key of the scrape error metric of the
+// named collector.
+func scrapeErrorKey(collector string) string {
+	return fmt.Sprintf(`%s_nfs_scrape_error{collector=%q,name="pvc-1",namespace="default"}`, exportsPrefix, collector)
+}
+
+func TestExportsCollector(t *testing.T) {
+
+	exports := []ganesha.Export{{ExportID: 1}, {ExportID: 2}}
+	details := map[uint16]*ganesha.ExportDetails{1: {Pseudo: "/one"}, 2: {Pseudo: "/two"}}
+	volumes := map[uint16]Volume{2: {Name: "pvc-2", Namespace: "other"}}
+
+	tests := []struct {
+		name  string
+		stats *fakeExportStats
+		want  map[string]float64
+	}{
+		{
+			name: "exports",
+			stats: &fakeExportStats{
+				exports: exports,
+				details: details,
+				io: &ganesha.ExportIOStatsList{StatsBaseAnswer: statsOK, Exports: []ganesha.ExportIOStats{
+					{
+						ExportID: 1,
+						Name:     NFSv41,
+						Read:     ganesha.BasicIO{Requested: 4096, Transfered: 2048, Total: 2, Errors: 1, Latency: 3e9, QueueWait: 5e8},
+					},
+					{ExportID: 2, Name: NFSv42, Write: ganesha.BasicIO{Total: 1}},
+					// Unknown protocols and exports are skipped.
+					{ExportID: 1, Name: "NFSv3", Read: ganesha.BasicIO{Total: 1}},
+					{ExportID: 3, Name: NFSv41, Read: ganesha.BasicIO{Total: 1}},
+				}},
+			},
+			want: map[string]float64{
+				`storageos_nfs_v41_requested_bytes_total{export_id="1",name="pvc-1",namespace="default",op="read",pseudo="/one"}`:                4096,
+				`storageos_nfs_v41_transfered_bytes_total{export_id="1",name="pvc-1",namespace="default",op="read",pseudo="/one"}`:               2048,
+				`storageos_nfs_v41_operations_total{export_id="1",name="pvc-1",namespace="default",op="read",pseudo="/one"}`:                     2,
+				`storageos_nfs_v41_operations_errors_total{export_id="1",name="pvc-1",namespace="default",op="read",pseudo="/one"}`:              1,
+				`storageos_nfs_v41_operations_latency_seconds_total{export_id="1",name="pvc-1",namespace="default",op="read",pseudo="/one"}`:     3,
+				`storageos_nfs_v41_operations_queue_wait_seconds_total{export_id="1",name="pvc-1",namespace="default",op="read",pseudo="/one"}`:  0.5,
+				`storageos_nfs_v41_requested_bytes_total{export_id="1",name="pvc-1",namespace="default",op="write",pseudo="/one"}`:               0,
+				`storageos_nfs_v41_transfered_bytes_total{export_id="1",name="pvc-1",namespace="default",op="write",pseudo="/one"}`:              0,
+				`storageos_nfs_v41_operations_total{export_id="1",name="pvc-1",namespace="default",op="write",pseudo="/one"}`:                    0,
+				`storageos_nfs_v41_operations_errors_total{export_id="1",name="pvc-1",namespace="default",op="write",pseudo="/one"}`:             0,
+				`storageos_nfs_v41_operations_latency_seconds_total{export_id="1",name="pvc-1",namespace="default",op="write",pseudo="/one"}`:    0,
+				`storageos_nfs_v41_operations_queue_wait_seconds_total{export_id="1",name="pvc-1",namespace="default",op="write",pseudo="/one"}`: 0,
+				`storageos_nfs_v42_requested_bytes_total{export_id="2",name="pvc-2",namespace="other",op="read",pseudo="/two"}`:                  0,
+				`storageos_nfs_v42_transfered_bytes_total{export_id="2",name="pvc-2",namespace="other",op="read",pseudo="/two"}`:                 0,
+				`storageos_nfs_v42_operations_total{export_id="2",name="pvc-2",namespace="other",op="read",pseudo="/two"}`:                       0,
+				`storageos_nfs_v42_operations_errors_total{export_id="2",name="pvc-2",namespace="other",op="read",pseudo="/two"}`:                0,
+				`storageos_nfs_v42_operations_latency_seconds_total{export_id="2",name="pvc-2",namespace="other",op="read",pseudo="/two"}`:       0,
+				`storageos_nfs_v42_operations_queue_wait_seconds_total{export_id="2",name="pvc-2",namespace="other",op="read",pseudo="/two"}`:    0,
+				`storageos_nfs_v42_requested_bytes_total{export_id="2",name="pvc-2",namespace="other",op="write",pseudo="/two"}`:                 0,
+				`storageos_nfs_v42_transfered_bytes_total{export_id="2",name="pvc-2",namespace="other",op="write",pseudo="/two"}`:                0,
+				`storageos_nfs_v42_operations_total{export_id="2",name="pvc-2",namespace="other",op="write",pseudo="/two"}`:                      1,
+				`storageos_nfs_v42_operations_errors_total{export_id="2",name="pvc-2",namespace="other",op="write",pseudo="/two"}`:               0,
+				`storageos_nfs_v42_operations_latency_seconds_total{export_id="2",name="pvc-2",namespace="other",op="write",pseudo="/two"}`:      0,
+				`storageos_nfs_v42_operations_queue_wait_seconds_total{export_id="2",name="pvc-2",namespace="other",op="write",pseudo="/two"}`:   0,
+				scrapeErrorKey("exports"): 0,
+			},
+		},
+		{
+			name: "stats disabled",
+			stats: &fakeExportStats{
+				exports: exports,
+				details: details,
+				io:      &ganesha.ExportIOStatsList{StatsBaseAnswer: ganesha.StatsBaseAnswer{Error: "stats disabled"}},
+			},
+			want: map[string]float64{scrapeErrorKey("exports"): 0},
+		},
+		{
+			name:  "error",
+			stats: &fakeExportStats{err: errors.New("dbus: not connected")},
+			want:  map[string]float64{scrapeErrorKey("exports"): 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewExportsCollector("pvc-1", "default", volumes, nil, nil)
+			c.exportMgr = tt.stats
+
+			if got := collect(t, c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collected %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/storageos/nfs/ganesha"
+	"github.com/storageos/nfs/logger"
+)
+
+var (
+	fsalOpsDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_fsal_operations_total",
+		"Number of FSAL operations by operation",
+		[]string{"fsal", "op", "name", "namespace"}, nil,
+	)
+	fsalLatencyDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_fsal_operations_latency_seconds_total",
+		"Cumulative time consumed by FSAL operations by operation",
+		[]string{"fsal", "op", "name", "namespace"}, nil,
+	)
+	fsalMaxLatencyDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_fsal_operations_max_latency_seconds",
+		"Maximum latency of FSAL operations by operation",
+		[]string{"fsal", "op", "name", "namespace"}, nil,
+	)
+)
+
+// mdcacheDescs maps the values reported by Ganesha's MDCACHE stats to metric
+// descriptors.  Values not listed are ignored.
+var mdcacheDescs = map[string]*prometheus.Desc{
+	"fsal_opened_files": prometheus.NewDesc(
+		exportsPrefix+"_nfs_mdcache_open_files",
+		"Number of files held open by the FSAL",
+		[]string{"name", "namespace"}, nil,
+	),
+	"system_limit_on_fds": prometheus.NewDesc(
+		exportsPrefix+"_nfs_mdcache_open_files_limit",
+		"System limit on file descriptors available to the FSAL",
+		[]string{"name", "namespace"}, nil,
+	),
+	"entries_used": prometheus.NewDesc(
+		exportsPrefix+"_nfs_mdcache_entries",
+		"Number of entries in the metadata cache",
+		[]string{"name", "namespace"}, nil,
+	),
+	"chunks_in_use": prometheus.NewDesc(
+		exportsPrefix+"_nfs_mdcache_dirent_chunks",
+		"Number of directory entry chunks in the metadata cache",
+		[]string{"name", "namespace"}, nil,
+	),
+}
+
+// FSALCollector collects FSAL operation stats and metadata cache utilisation.
+//
+// Not all FSALs support stats and older versions of Ganesha do not report
+// MDCACHE stats.  Unavailable stats are logged once and then skipped.
+type FSALCollector struct {
+	name      string
+	namespace string
+	fsals     []string
+	exportMgr exportStats
+	log       *logger.Logger
+
+	// fsalOnce holds a sync.Once for each FSAL.
+	fsalOnce    map[string]*sync.Once
+	mdcacheOnce *sync.Once
+}
+
+// NewFSALCollector creates a new collector for the named FSALs, e.g. VFS.
+func NewFSALCollector(name string, namespace string, exportMgr *ganesha.ExportMgr, log *logger.Logger, fsals ...string) FSALCollector {
+	fsalOnce := make(map[string]*sync.Once, len(fsals))
+	for _, fsal := range fsals {
+		fsalOnce[fsal] = &sync.Once{}
+	}
+	return FSALCollector{
+		name:        name,
+		namespace:   namespace,
+		fsals:       fsals,
+		exportMgr:   exportMgr,
+		log:         log,
+		fsalOnce:    fsalOnce,
+		mdcacheOnce: &sync.Once{},
+	}
+}
+
+// Describe prometheus description
+func (c FSALCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+// Collect FSAL and MDCACHE stats.  Stats that are unavailable are not
+// reported as scrape errors.
+func (c FSALCollector) Collect(ch chan<- prometheus.Metric) {
+
+	var failed bool
+	defer func() { collectScrapeError(ch, "fsal", c.name, c.namespace, failed) }()
+
+	for _, fsal := range c.fsals {
+		stats, err := c.exportMgr.GetFSALStats(fsal)
+		if err != nil {
+			failed = failed || !ganesha.IsUnknownMethod(err)
+			c.fsalOnce[fsal].Do(func() { c.log.Infof("fsal stats unavailable for %s: %v", fsal, err) })
+			continue
+		}
+		if !stats.Status {
+			c.fsalOnce[fsal].Do(func() { c.log.Infof("fsal stats unavailable for %s: %s", fsal, stats.Error) })
+			continue
+		}
+		for _, op := range stats.Ops {
+			ch <- prometheus.MustNewConstMetric(
+				fsalOpsDesc,
+				prometheus.CounterValue,
+				float64(op.Total),
+				fsal, op.Op, c.name, c.namespace)
+			ch <- prometheus.MustNewConstMetric(
+				fsalLatencyDesc,
+				prometheus.CounterValue,
+				op.Latency*float64(op.Total)/1e3,
+				fsal, op.Op, c.name, c.namespace)
+			ch <- prometheus.MustNewConstMetric(
+				fsalMaxLatencyDesc,
+				prometheus.GaugeValue,
+				op.MaxLatency/1e3,
+				fsal, op.Op, c.name, c.namespace)
+		}
+	}
+
+	stats, err := c.exportMgr.ShowMDCache()
+	if err != nil {
+		failed = failed || !ganesha.IsUnknownMethod(err)
+		c.mdcacheOnce.Do(func() { c.log.Infof("mdcache stats unavailable: %v", err) })
+		return
+	}
+	if !stats.Status {
+		c.mdcacheOnce.Do(func() { c.log.Infof("mdcache stats unavailable: %s", stats.Error) })
+		return
+	}
+	for key, value := range stats.Values {
+		desc, ok := mdcacheDescs[key]
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			desc,
+			prometheus.GaugeValue,
+			value,
+			c.name, c.namespace)
+	}
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/godbus/dbus"
+	"github.com/storageos/nfs/ganesha"
+)
+
+func TestFSALCollector(t *testing.T) {
+
+	unknownMethod := dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownMethod"}
+
+	tests := []struct {
+		name  string
+		stats *fakeExportStats
+		want  map[string]float64
+	}{
+		{
+			name: "fsal and mdcache",
+			stats: &fakeExportStats{
+				fsal: map[string]*ganesha.FSALStats{
+					"VFS": {StatsBaseAnswer: statsOK, Ops: []ganesha.FSALOpStats{{Op: "read", Total: 2, Latency: 1.5, MaxLatency: 3}}},
+				},
+				mdcache: &ganesha.MDCacheStats{StatsBaseAnswer: statsOK, Values: map[string]float64{
+					"fsal_opened_files": 10,
+					"entries_used":      5,
+					"lru_runs":          1,
+				}},
+			},
+			want: map[string]float64{
+				`storageos_nfs_fsal_operations_total{fsal="VFS",name="pvc-1",namespace="default",op="read"}`:                 2,
+				`storageos_nfs_fsal_operations_latency_seconds_total{fsal="VFS",name="pvc-1",namespace="default",op="read"}`: 0.003,
+				`storageos_nfs_fsal_operations_max_latency_seconds{fsal="VFS",name="pvc-1",namespace="default",op="read"}`:   0.003,
+				`storageos_nfs_mdcache_open_files{name="pvc-1",namespace="default"}`:                                         10,
+				`storageos_nfs_mdcache_entries{name="pvc-1",namespace="default"}`:                                            5,
+				scrapeErrorKey("fsal"): 0,
+			},
+		},
+		{
+			name: "unavailable",
+			stats: &fakeExportStats{
+				fsalErrs: map[string]error{"VFS": unknownMethod},
+				mdcache:  &ganesha.MDCacheStats{StatsBaseAnswer: ganesha.StatsBaseAnswer{Error: "stats disabled"}},
+			},
+			want: map[string]float64{scrapeErrorKey("fsal"): 0},
+		},
+		{
+			name:  "error",
+			stats: &fakeExportStats{err: errors.New("dbus: not connected")},
+			want:  map[string]float64{scrapeErrorKey("fsal"): 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewFSALCollector("pvc-1", "default", nil, nil, "VFS")
+			c.exportMgr = tt.stats
+
+			if got := collect(t, c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collected %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
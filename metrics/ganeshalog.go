@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/storageos/nfs/ganesha"
+)
+
+var ganeshaLogLinesDesc = prometheus.NewDesc(
+	exportsPrefix+"_nfs_server_log_lines_total",
+	"Number of NFS server log lines by component and level",
+	[]string{"component", "level", "name", "namespace"}, nil,
+)
+
+// GaneshaLogCollector collects the number of nfs-ganesha log lines, so that
+// alerts can be raised on CRIT and MAJ events.
+type GaneshaLogCollector struct {
+	name      string
+	namespace string
+	logs      *ganesha.LogStream
+}
+
+// NewGaneshaLogCollector creates a new collector for nfs-ganesha log lines.
+func NewGaneshaLogCollector(name string, namespace string, logs *ganesha.LogStream) GaneshaLogCollector {
+	return GaneshaLogCollector{
+		name:      name,
+		namespace: namespace,
+		logs:      logs,
+	}
+}
+
+// Describe prometheus description
+func (c GaneshaLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+// Collect log line counts.  Only components and levels that have been logged
+// are reported.
+func (c GaneshaLogCollector) Collect(ch chan<- prometheus.Metric) {
+	for key, count := range c.logs.Counts() {
+		ch <- prometheus.MustNewConstMetric(
+			ganeshaLogLinesDesc,
+			prometheus.CounterValue,
+			float64(count),
+			key.Component, key.Level, c.name, c.namespace)
+	}
+}
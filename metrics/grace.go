@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/storageos/nfs/ganesha"
+	"github.com/storageos/nfs/logger"
+)
+
+var graceDesc = prometheus.NewDesc(
+	exportsPrefix+"_nfs_server_in_grace",
+	"Whether the NFS server is in its NFSv4 grace period, 1 if in grace",
+	[]string{"name", "namespace"}, nil,
+)
+
+// graceStatus reads the grace period status of the NFS server.  It is
+// implemented by *ganesha.Ganesha.
+type graceStatus interface {
+	InGrace() (bool, error)
+}
+
+// GraceCollector collects the NFSv4 grace period status of the NFS server.
+type GraceCollector struct {
+	name      string
+	namespace string
+	nfs       graceStatus
+	log       *logger.Logger
+}
+
+// NewGraceCollector creates a new collector for the grace period status.
+func NewGraceCollector(name string, namespace string, nfs *ganesha.Ganesha, log *logger.Logger) GraceCollector {
+	return GraceCollector{
+		name:      name,
+		namespace: namespace,
+		nfs:       nfs,
+		log:       log,
+	}
+}
+
+// Describe prometheus description
+func (c GraceCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+// Collect grace period status.  Nothing is reported if the status can not be
+// read, for example while the server is restarting.
+func (c GraceCollector) Collect(ch chan<- prometheus.Metric) {
+
+	inGrace, err := c.nfs.InGrace()
+	if err != nil {
+		failed := !ganesha.IsUnknownMethod(err)
+		if failed {
+			c.log.Warnf("failed to read grace period status: %v", err)
+		}
+		collectScrapeError(ch, "grace", c.name, c.namespace, failed)
+		return
+	}
+	collectScrapeError(ch, "grace", c.name, c.namespace, false)
+
+	ch <- prometheus.MustNewConstMetric(
+		graceDesc,
+		prometheus.GaugeValue,
+		boolValue(inGrace),
+		c.name, c.namespace)
+}
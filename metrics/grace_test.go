@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+type fakeGraceStatus struct {
+	inGrace bool
+	err     error
+}
+
+func (f fakeGraceStatus) InGrace() (bool, error) { return f.inGrace, f.err }
+
+func TestGraceCollector(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		status fakeGraceStatus
+		want   map[string]float64
+	}{
+		{
+			name:   "in grace",
+			status: fakeGraceStatus{inGrace: true},
+			want: map[string]float64{
+				`storageos_nfs_server_in_grace{name="pvc-1",namespace="default"}`: 1,
+				scrapeErrorKey("grace"): 0,
+			},
+		},
+		{
+			name:   "not in grace",
+			status: fakeGraceStatus{},
+			want: map[string]float64{
+				`storageos_nfs_server_in_grace{name="pvc-1",namespace="default"}`: 0,
+				scrapeErrorKey("grace"): 0,
+			},
+		},
+		{
+			name:   "unsupported",
+			status: fakeGraceStatus{err: dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownMethod"}},
+			want:   map[string]float64{scrapeErrorKey("grace"): 0},
+		},
+		{
+			name:   "error",
+			status: fakeGraceStatus{err: errors.New("dbus: not connected")},
+			want:   map[string]float64{scrapeErrorKey("grace"): 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewGraceCollector("pvc-1", "default", nil, nil)
+			c.nfs = tt.status
+
+			if got := collect(t, c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collected %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
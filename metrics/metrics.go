@@ -5,6 +5,9 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/storageos/nfs/config"
+	"github.com/storageos/nfs/ganesha"
+	"github.com/storageos/nfs/logger"
 )
 
 // Labels used by Ganesha to identify the NFS version in use.
@@ -25,25 +28,81 @@ type IODescriptors struct {
 	QueueWait   *prometheus.Desc
 }
 
+// Volume identifies the PVC served by an export.
+type Volume struct {
+	Name      string
+	Namespace string
+}
+
+// Options configures the metrics collectors.
+type Options struct {
+	// Name and Namespace label server-wide metrics, and export metrics for
+	// exports not listed in Volumes.
+	Name      string
+	Namespace string
+
+	// Volumes maps export IDs to the PVC they serve, allowing a server with
+	// several exports to label each with its own PVC.
+	Volumes map[uint16]Volume
+
+	// ClientLimits bound the number of client label sets reported.
+	ClientLimits ClientLimits
+
+	// ClientResolver labels client metrics with the pod using the client
+	// address.  Optional.
+	ClientResolver ClientResolver
+
+	// FSALs are the names of the FSALs used by the exports, e.g. VFS.  If
+	// empty, config.DefaultFSAL is used.
+	FSALs []string
+
+	// ExportMgr and ClientMgr read the stats from the NFS server.
+	ExportMgr *ganesha.ExportMgr
+	ClientMgr *ganesha.ClientMgr
+
+	// Logger receives collection failures.  Optional.
+	Logger *logger.Logger
+}
+
 // Metrics handles metrics collection and presentation.
 type Metrics struct {
 	registry *prometheus.Registry
 }
 
 // New creates a new Metrics instance.
-func New(name string, namespace string) *Metrics {
+//
+// The system bus does not need to be reachable yet.  Collectors that can't
+// read their stats report a scrape error.
+func New(opts Options) (*Metrics, error) {
+
+	fsals := opts.FSALs
+	if len(fsals) == 0 {
+		fsals = []string{config.DefaultFSAL}
+	}
 
 	reg := prometheus.NewPedanticRegistry()
-	reg.MustRegister(
+	for _, c := range []prometheus.Collector{
 		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
 		prometheus.NewGoCollector(),
-		NewExportsCollector(name, namespace),
-		NewClientsCollector(name, namespace),
-	)
+		NewExportsCollector(opts.Name, opts.Namespace, opts.Volumes, opts.ExportMgr, opts.Logger),
+		NewClientsCollector(opts.Name, opts.Namespace, opts.ClientLimits, opts.ClientResolver, opts.ClientMgr, opts.Logger),
+		NewV4OpsCollector(opts.Name, opts.Namespace, opts.ExportMgr, opts.Logger),
+		NewOpsCollector(opts.Name, opts.Namespace, opts.Volumes, opts.ExportMgr, opts.Logger),
+		NewFSALCollector(opts.Name, opts.Namespace, opts.ExportMgr, opts.Logger, fsals...),
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
 
 	return &Metrics{
 		registry: reg,
-	}
+	}, nil
+}
+
+// Register adds a collector to the metrics registry.
+func (s *Metrics) Register(c prometheus.Collector) error {
+	return s.registry.Register(c)
 }
 
 // Handler registers the http endpoint for serving metrics data.
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/storageos/nfs/ganesha"
+	"github.com/storageos/nfs/logger"
+)
+
+var (
+	serverOpsDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_server_operations_total",
+		"Number of operations handled by the NFS server by protocol",
+		[]string{"protocol", "name", "namespace"}, nil,
+	)
+	exportOpsDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_export_operations_total",
+		"Number of operations on the NFS export by protocol",
+		[]string{"protocol", "name", "namespace", "export_id", "pseudo"}, nil,
+	)
+)
+
+// OpsCollector collects operation counts for the whole NFS server and for the
+// exports, by protocol.
+type OpsCollector struct {
+	name      string
+	namespace string
+	volumes   map[uint16]Volume
+	exportMgr exportStats
+	log       *logger.Logger
+}
+
+// NewOpsCollector creates a new collector for operation counts.  Exports are
+// labeled as for the ExportsCollector.
+func NewOpsCollector(name string, namespace string, volumes map[uint16]Volume, exportMgr *ganesha.ExportMgr, log *logger.Logger) OpsCollector {
+	return OpsCollector{
+		name:      name,
+		namespace: namespace,
+		volumes:   volumes,
+		exportMgr: exportMgr,
+		log:       log,
+	}
+}
+
+// Describe prometheus description
+func (c OpsCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+// Collect operation counts.
+func (c OpsCollector) Collect(ch chan<- prometheus.Metric) {
+
+	var failed bool
+	defer func() { collectScrapeError(ch, "ops", c.name, c.namespace, failed) }()
+
+	global, err := c.exportMgr.GetGlobalOPS()
+	if err != nil {
+		c.log.Warnf("failed to get nfs server operation stats: %v", err)
+		failed = true
+	} else if global.Status {
+		for protocol, count := range global.Ops {
+			ch <- prometheus.MustNewConstMetric(
+				serverOpsDesc,
+				prometheus.CounterValue,
+				float64(count),
+				protocol, c.name, c.namespace)
+		}
+	}
+
+	labels, err := exportLabels(c.exportMgr, c.name, c.namespace, c.volumes)
+	if err != nil {
+		c.log.Warnf("failed to get nfs export list: %v", err)
+		failed = true
+		return
+	}
+
+	for id, l := range labels {
+		stats, err := c.exportMgr.GetTotalOPS(id)
+		if err != nil {
+			c.log.With(logger.ExportIDKey, id).Warnf("failed to get nfs operation stats for export: %v", err)
+			continue
+		}
+		if !stats.Status {
+			continue
+		}
+		for protocol, count := range stats.Ops {
+			ch <- prometheus.MustNewConstMetric(
+				exportOpsDesc,
+				prometheus.CounterValue,
+				float64(count),
+				protocol, l.name, l.namespace, l.exportID, l.pseudo)
+		}
+	}
+}
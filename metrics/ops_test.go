@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/storageos/nfs/ganesha"
+)
+
+func TestOpsCollector(t *testing.T) {
+
+	exports := []ganesha.Export{{ExportID: 1}, {ExportID: 2}}
+	details := map[uint16]*ganesha.ExportDetails{1: {ExportID: 1, Pseudo: "/one"}}
+	volumes := map[uint16]Volume{2: {Name: "pvc-2", Namespace: "other"}}
+
+	tests := []struct {
+		name  string
+		stats *fakeExportStats
+		want  map[string]float64
+	}{
+		{
+			name: "server and exports",
+			stats: &fakeExportStats{
+				exports: exports,
+				details: details,
+				global:  &ganesha.OPSStats{StatsBaseAnswer: statsOK, Ops: map[string]uint64{"NFSv4": 10, "NLM": 2}},
+				total: map[uint16]*ganesha.OPSStats{
+					1: {StatsBaseAnswer: statsOK, Ops: map[string]uint64{"NFSv4": 7}},
+					2: {StatsBaseAnswer: statsOK, Ops: map[string]uint64{"NFSv4": 3}},
+				},
+			},
+			want: map[string]float64{
+				`storageos_nfs_server_operations_total{name="pvc-1",namespace="default",protocol="NFSv4"}`:                             10,
+				`storageos_nfs_server_operations_total{name="pvc-1",namespace="default",protocol="NLM"}`:                               2,
+				`storageos_nfs_export_operations_total{export_id="1",name="pvc-1",namespace="default",protocol="NFSv4",pseudo="/one"}`: 7,
+				`storageos_nfs_export_operations_total{export_id="2",name="pvc-2",namespace="other",protocol="NFSv4",pseudo=""}`:       3,
+				scrapeErrorKey("ops"): 0,
+			},
+		},
+		{
+			name: "stats disabled",
+			stats: &fakeExportStats{
+				exports: exports,
+				global:  &ganesha.OPSStats{StatsBaseAnswer: ganesha.StatsBaseAnswer{Error: "stats disabled"}},
+				total: map[uint16]*ganesha.OPSStats{
+					1: {StatsBaseAnswer: ganesha.StatsBaseAnswer{Error: "stats disabled"}},
+					2: {StatsBaseAnswer: ganesha.StatsBaseAnswer{Error: "stats disabled"}},
+				},
+			},
+			want: map[string]float64{scrapeErrorKey("ops"): 0},
+		},
+		{
+			name: "export removed",
+			stats: &fakeExportStats{
+				exports:    exports,
+				global:     &ganesha.OPSStats{StatsBaseAnswer: statsOK},
+				total:      map[uint16]*ganesha.OPSStats{1: {StatsBaseAnswer: statsOK, Ops: map[string]uint64{"NFSv4": 7}}},
+				exportErrs: map[uint16]error{2: errors.New("export not found")},
+			},
+			want: map[string]float64{
+				`storageos_nfs_export_operations_total{export_id="1",name="pvc-1",namespace="default",protocol="NFSv4",pseudo=""}`: 7,
+				scrapeErrorKey("ops"): 0,
+			},
+		},
+		{
+			name:  "error",
+			stats: &fakeExportStats{err: errors.New("dbus: not connected")},
+			want:  map[string]float64{scrapeErrorKey("ops"): 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewOpsCollector("pvc-1", "default", volumes, nil, nil)
+			c.exportMgr = tt.stats
+
+			if got := collect(t, c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collected %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/storageos/nfs/ganesha"
+)
+
+var (
+	reloadsDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_config_reloads_total",
+		"Number of times the configuration file was reloaded, by result",
+		[]string{"result", "name", "namespace"}, nil,
+	)
+	reloadLastSuccessDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_config_last_reload_successful",
+		"Whether the last configuration reload was fully applied, 1 if successful",
+		[]string{"name", "namespace"}, nil,
+	)
+	reloadLastTimeDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_config_last_reload_timestamp_seconds",
+		"Time of the last configuration reload since unix epoch in seconds",
+		[]string{"name", "namespace"}, nil,
+	)
+	reloadRestartRequiredDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_config_restart_required",
+		"Whether the configuration file has changed settings that require a restart, 1 if required",
+		[]string{"name", "namespace"}, nil,
+	)
+)
+
+// ReloadCollector collects configuration reload statistics.
+type ReloadCollector struct {
+	name      string
+	namespace string
+	reloader  *ganesha.Reloader
+}
+
+// NewReloadCollector creates a new collector for configuration reloads.
+func NewReloadCollector(name string, namespace string, reloader *ganesha.Reloader) ReloadCollector {
+	return ReloadCollector{
+		name:      name,
+		namespace: namespace,
+		reloader:  reloader,
+	}
+}
+
+// Describe prometheus description
+func (c ReloadCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+// Collect reload statistics.  The last reload metrics are only reported once
+// the configuration has been reloaded.
+func (c ReloadCollector) Collect(ch chan<- prometheus.Metric) {
+
+	stats := c.reloader.Stats()
+
+	ch <- prometheus.MustNewConstMetric(
+		reloadsDesc,
+		prometheus.CounterValue,
+		float64(stats.Succeeded),
+		"success", c.name, c.namespace)
+	ch <- prometheus.MustNewConstMetric(
+		reloadsDesc,
+		prometheus.CounterValue,
+		float64(stats.Failed),
+		"failure", c.name, c.namespace)
+	ch <- prometheus.MustNewConstMetric(
+		reloadRestartRequiredDesc,
+		prometheus.GaugeValue,
+		boolValue(stats.RestartRequired),
+		c.name, c.namespace)
+
+	if stats.LastReloadTime.IsZero() {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		reloadLastSuccessDesc,
+		prometheus.GaugeValue,
+		boolValue(stats.LastSucceeded),
+		c.name, c.namespace)
+	ch <- prometheus.MustNewConstMetric(
+		reloadLastTimeDesc,
+		prometheus.GaugeValue,
+		float64(stats.LastReloadTime.Unix()),
+		c.name, c.namespace)
+}
+
+// boolValue returns 1 for true and 0 for false.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
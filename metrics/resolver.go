@@ -0,0 +1,310 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/storageos/nfs/ganesha"
+	"github.com/storageos/nfs/logger"
+)
+
+// ClientIdentity identifies the Kubernetes pod using a client address.  Fields
+// that could not be determined are empty.
+//
+// Node is the node running the pod.  Only the pod and namespace label client
+// metrics.
+type ClientIdentity struct {
+	Pod       string `json:"pod"`
+	Namespace string `json:"namespace"`
+	Node      string `json:"node"`
+}
+
+// ClientResolver maps client addresses to the pod using them.  Resolve returns
+// false if the address is not known.
+//
+// Resolve is called while collecting metrics, so must not block.
+type ClientResolver interface {
+	Resolve(ip string) (ClientIdentity, bool)
+}
+
+// canonicalIP returns the canonical form of a client address, so that
+// `::ffff:10.0.0.1` and `10.0.0.1` are equivalent.
+func canonicalIP(s string) string {
+	id, err := ganesha.ParseClientID(s)
+	if err != nil {
+		return s
+	}
+	return id.String()
+}
+
+const (
+	// dnsLookupTimeout bounds each reverse lookup.
+	dnsLookupTimeout = time.Second
+
+	// dnsCacheTTL is how long lookup results, including failures, are used
+	// before being looked up again.
+	dnsCacheTTL = 5 * time.Minute
+
+	// dnsCacheSize bounds the number of cached results.  Expired results are
+	// evicted first, then those closest to expiry.
+	dnsCacheSize = 1024
+
+	// dnsQueueSize bounds the number of lookups waiting to run.  Addresses
+	// that can't be queued are retried when next resolved.
+	dnsQueueSize = 64
+)
+
+// dnsEntry is a cached reverse lookup result.
+type dnsEntry struct {
+	identity ClientIdentity
+	ok       bool
+	expires  time.Time
+}
+
+// DNSResolver resolves client addresses using reverse DNS.
+//
+// Kubernetes DNS returns names such as `<hostname>.<subdomain>.<namespace>.svc.
+// cluster.local` for pods behind a headless service, and
+// `<ip>.<namespace>.pod.cluster.local` for other pods.  The namespace is always
+// set when the name has this form, but the pod name is only known for pods
+// behind a headless service that set their hostname.  Pods that don't are
+// given a hostname from their address, e.g. `10-1-2-3`, which is not used as
+// the pod name.  Other names are not resolved, and the node is never known.
+//
+// Lookups are made by Run, so Resolve only returns cached results.  Addresses
+// are unknown until first looked up, and keep their previous identity while
+// being looked up again.
+type DNSResolver struct {
+	lookup func(ctx context.Context, ip string) ([]string, error)
+	queue  chan string
+
+	// cache holds the lookup results, and pending the addresses queued for
+	// lookup.  They are protected by mu.
+	cache   map[string]dnsEntry
+	pending map[string]bool
+	mu      *sync.Mutex
+}
+
+// NewDNSResolver returns a new reverse DNS resolver.  Run must be called to
+// make lookups.
+func NewDNSResolver() *DNSResolver {
+	return &DNSResolver{
+		lookup:  net.DefaultResolver.LookupAddr,
+		queue:   make(chan string, dnsQueueSize),
+		cache:   make(map[string]dnsEntry),
+		pending: make(map[string]bool),
+		mu:      &sync.Mutex{},
+	}
+}
+
+// Resolve returns the cached identity for ip, queueing a lookup if it has not
+// been looked up or the result has expired.
+func (r *DNSResolver) Resolve(ip string) (ClientIdentity, bool) {
+
+	ip = canonicalIP(ip)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.cache[ip]
+	if (!ok || !time.Now().Before(entry.expires)) && !r.pending[ip] {
+		select {
+		case r.queue <- ip:
+			r.pending[ip] = true
+		default:
+		}
+	}
+	return entry.identity, entry.ok
+}
+
+// Run looks up the queued addresses until the context is cancelled.
+func (r *DNSResolver) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ip := <-r.queue:
+			entry := r.resolve(ctx, ip)
+
+			r.mu.Lock()
+			delete(r.pending, ip)
+			r.store(ip, entry)
+			r.mu.Unlock()
+		}
+	}
+}
+
+// resolve looks up ip.
+func (r *DNSResolver) resolve(ctx context.Context, ip string) dnsEntry {
+
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+
+	entry := dnsEntry{expires: time.Now().Add(dnsCacheTTL)}
+	names, err := r.lookup(ctx, ip)
+	if err == nil && len(names) > 0 {
+		entry.identity, entry.ok = identityFromName(names[0])
+	}
+	return entry
+}
+
+// store caches a lookup result, evicting entries if the cache is full.  It must
+// be called with mu held.
+func (r *DNSResolver) store(ip string, entry dnsEntry) {
+
+	if _, ok := r.cache[ip]; !ok && len(r.cache) >= dnsCacheSize {
+		now := time.Now()
+		var oldest string
+		for cached, e := range r.cache {
+			if !now.Before(e.expires) {
+				delete(r.cache, cached)
+				continue
+			}
+			if oldest == "" || e.expires.Before(r.cache[oldest].expires) {
+				oldest = cached
+			}
+		}
+		if len(r.cache) >= dnsCacheSize {
+			delete(r.cache, oldest)
+		}
+	}
+	r.cache[ip] = entry
+}
+
+// identityFromName parses a Kubernetes DNS name.
+func identityFromName(name string) (ClientIdentity, bool) {
+
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	if len(labels) == 0 || labels[0] == "" {
+		return ClientIdentity{}, false
+	}
+
+	for i := 1; i < len(labels); i++ {
+		switch labels[i] {
+		case "svc":
+			// <hostname>.<subdomain>.<namespace>.svc or <service>.<namespace>.svc
+			id := ClientIdentity{Namespace: labels[i-1]}
+			if i >= 3 && !isDashedIP(labels[0]) {
+				id.Pod = labels[0]
+			}
+			return id, true
+		case "pod":
+			// <ip>.<namespace>.pod
+			return ClientIdentity{Namespace: labels[i-1]}, true
+		}
+	}
+	return ClientIdentity{}, false
+}
+
+// isDashedIP returns true if the DNS label is an address with dashes for
+// separators, as Kubernetes uses for pods without a hostname.
+func isDashedIP(label string) bool {
+	return net.ParseIP(strings.Replace(label, "-", ".", -1)) != nil ||
+		net.ParseIP(strings.Replace(label, "-", ":", -1)) != nil
+}
+
+// StaticResolver resolves client addresses from a JSON mapping of address to
+// identity, read from a file or an http(s) URL, e.g.:
+//
+//	{"10.244.1.5": {"pod": "web-0", "namespace": "default", "node": "node-1"}}
+//
+// The mapping is read on creation and again on each Refresh, so it can be
+// maintained by an external controller.
+type StaticResolver struct {
+	source string
+	client *http.Client
+
+	// identities is protected by mu.
+	identities map[string]ClientIdentity
+	mu         *sync.RWMutex
+}
+
+// NewStaticResolver returns a new resolver for the mapping at source, which may
+// be a file path or an http(s) URL.  An error is returned if the mapping can't
+// be read.
+func NewStaticResolver(source string) (*StaticResolver, error) {
+	r := &StaticResolver{
+		source: source,
+		client: &http.Client{Timeout: 10 * time.Second},
+		mu:     &sync.RWMutex{},
+	}
+	if err := r.Refresh(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Resolve returns the identity for ip from the mapping.
+func (r *StaticResolver) Resolve(ip string) (ClientIdentity, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.identities[canonicalIP(ip)]
+	return id, ok
+}
+
+// Refresh reads the mapping from the source.  The previous mapping is kept if
+// it can't be read.
+func (r *StaticResolver) Refresh() error {
+
+	data, err := r.read()
+	if err != nil {
+		return fmt.Errorf("failed to read client mapping from %s: %v", r.source, err)
+	}
+
+	var raw map[string]ClientIdentity
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("failed to decode client mapping from %s: %v", r.source, err)
+	}
+	identities := make(map[string]ClientIdentity, len(raw))
+	for ip, id := range raw {
+		identities[canonicalIP(ip)] = id
+	}
+
+	r.mu.Lock()
+	r.identities = identities
+	r.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the mapping every interval until the context is cancelled.
+// Failures are logged to log.
+func (r *StaticResolver) Run(ctx context.Context, interval time.Duration, log *logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Refresh(); err != nil {
+				log.Warnf("%v", err)
+			}
+		}
+	}
+}
+
+func (r *StaticResolver) read() ([]byte, error) {
+
+	if !strings.HasPrefix(r.source, "http://") && !strings.HasPrefix(r.source, "https://") {
+		return ioutil.ReadFile(r.source)
+	}
+
+	resp, err := r.client.Get(r.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testMapping = `{
+	"10.244.1.5": {"pod": "web-0", "namespace": "default", "node": "node-1"},
+	"::ffff:10.244.1.6": {"pod": "web-1", "namespace": "default"}
+}`
+
+func TestStaticResolver(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "clients.json")
+	if err := ioutil.WriteFile(file, []byte(testMapping), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testMapping)
+	}))
+	defer srv.Close()
+
+	for _, source := range []string{file, srv.URL} {
+		t.Run(source, func(t *testing.T) {
+			r, err := NewStaticResolver(source)
+			if err != nil {
+				t.Fatalf("NewStaticResolver() error = %v", err)
+			}
+
+			tests := []struct {
+				ip     string
+				want   ClientIdentity
+				wantOK bool
+			}{
+				{"::ffff:10.244.1.5", ClientIdentity{Pod: "web-0", Namespace: "default", Node: "node-1"}, true},
+				{"10.244.1.6", ClientIdentity{Pod: "web-1", Namespace: "default"}, true},
+				{"10.244.1.7", ClientIdentity{}, false},
+			}
+			for _, tt := range tests {
+				got, ok := r.Resolve(tt.ip)
+				if ok != tt.wantOK || got != tt.want {
+					t.Errorf("Resolve(%s) = %+v, %v, want %+v, %v", tt.ip, got, ok, tt.want, tt.wantOK)
+				}
+			}
+		})
+	}
+
+	if _, err := NewStaticResolver(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("NewStaticResolver() with missing file: got no error")
+	}
+}
+
+func TestIdentityFromName(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   ClientIdentity
+		wantOK bool
+	}{
+		{"web-0.web.default.svc.cluster.local.", ClientIdentity{Pod: "web-0", Namespace: "default"}, true},
+		{"10-244-1-5.apps.pod.cluster.local.", ClientIdentity{Namespace: "apps"}, true},
+		{"web.default.svc.cluster.local.", ClientIdentity{Namespace: "default"}, true},
+		{"10-1-2-3.web.default.svc.cluster.local.", ClientIdentity{Namespace: "default"}, true},
+		{"fd00--1.web.default.svc.cluster.local.", ClientIdentity{Namespace: "default"}, true},
+		{"node-1.example.com.", ClientIdentity{}, false},
+		{"", ClientIdentity{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := identityFromName(tt.name)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("identityFromName(%q) = %+v, %v, want %+v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestDNSResolver(t *testing.T) {
+
+	var lookups []string
+	mu := &sync.Mutex{}
+	done := make(chan struct{}, 10)
+
+	r := NewDNSResolver()
+	r.lookup = func(ctx context.Context, ip string) ([]string, error) {
+		mu.Lock()
+		lookups = append(lookups, ip)
+		mu.Unlock()
+		defer func() { done <- struct{}{} }()
+		if ip == "10.244.1.5" {
+			return []string{"web-0.web.default.svc.cluster.local."}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+
+	// Unknown until looked up, and queued only once.
+	for i := 0; i < 2; i++ {
+		if got, ok := r.Resolve("::ffff:10.244.1.5"); ok {
+			t.Errorf("Resolve() before lookup = %+v, want unknown", got)
+		}
+	}
+	r.Resolve("10.244.1.6")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("lookup not made")
+		}
+	}
+	// The result is stored after the lookup returns.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := r.Resolve("10.244.1.5"); ok || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	want := ClientIdentity{Pod: "web-0", Namespace: "default"}
+	if got, ok := r.Resolve("10.244.1.5"); !ok || got != want {
+		t.Errorf("Resolve() = %+v, %v, want %+v, true", got, ok, want)
+	}
+	if got, ok := r.Resolve("10.244.1.6"); ok {
+		t.Errorf("Resolve() of failed lookup = %+v, want unknown", got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lookups) != 2 {
+		t.Errorf("lookups = %v, want one per address", lookups)
+	}
+}
+
+func TestDNSResolverStore(t *testing.T) {
+
+	r := NewDNSResolver()
+	now := time.Now()
+
+	for i := 0; i < dnsCacheSize; i++ {
+		r.store(fmt.Sprintf("10.0.%d.%d", i/256, i%256), dnsEntry{expires: now.Add(time.Hour + time.Duration(i)*time.Second)})
+	}
+	r.store("10.1.0.1", dnsEntry{expires: now.Add(2 * time.Hour)})
+	if len(r.cache) != dnsCacheSize {
+		t.Fatalf("cache size = %d, want %d", len(r.cache), dnsCacheSize)
+	}
+	if _, ok := r.cache["10.0.0.0"]; ok {
+		t.Error("entry closest to expiry not evicted")
+	}
+
+	// Expired entries are evicted first.
+	r.cache["10.0.0.1"] = dnsEntry{expires: now.Add(-time.Minute)}
+	r.cache["10.0.0.2"] = dnsEntry{expires: now.Add(-time.Minute)}
+	r.store("10.1.0.2", dnsEntry{expires: now.Add(2 * time.Hour)})
+	if len(r.cache) != dnsCacheSize-1 {
+		t.Errorf("cache size = %d, want %d", len(r.cache), dnsCacheSize-1)
+	}
+	if _, ok := r.cache["10.0.0.3"]; !ok {
+		t.Error("unexpired entry evicted")
+	}
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrapeErrorDescs holds the scrape error descriptor of each collector.  The
+// collector is a constant label so that each collector describes its own
+// metric to the registry.
+var scrapeErrorDescs = map[string]*prometheus.Desc{
+	"exports": newScrapeErrorDesc("exports"),
+	"clients": newScrapeErrorDesc("clients"),
+	"v4ops":   newScrapeErrorDesc("v4ops"),
+	"ops":     newScrapeErrorDesc("ops"),
+	"fsal":    newScrapeErrorDesc("fsal"),
+	"grace":   newScrapeErrorDesc("grace"),
+}
+
+func newScrapeErrorDesc(collector string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		exportsPrefix+"_nfs_scrape_error",
+		"Whether the collector failed to read stats from the NFS server, 1 if it failed",
+		[]string{"name", "namespace"},
+		prometheus.Labels{"collector": collector},
+	)
+}
+
+// collectScrapeError reports whether a collector failed to read its stats.
+func collectScrapeError(ch chan<- prometheus.Metric, collector string, name string, namespace string, failed bool) {
+	ch <- prometheus.MustNewConstMetric(
+		scrapeErrorDescs[collector],
+		prometheus.GaugeValue,
+		boolValue(failed),
+		name, namespace)
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/storageos/nfs/dbus"
+	"github.com/storageos/nfs/ganesha"
+)
+
+func TestCollectScrapeError(t *testing.T) {
+
+	tests := []struct {
+		collector string
+		failed    bool
+		want      float64
+	}{
+		{collector: "exports", failed: true, want: 1},
+		{collector: "clients", failed: false, want: 0},
+		{collector: "grace", failed: true, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.collector, func(t *testing.T) {
+			ch := make(chan prometheus.Metric, 1)
+			collectScrapeError(ch, tt.collector, "pvc-1", "default", tt.failed)
+			m := <-ch
+
+			if m.Desc() != scrapeErrorDescs[tt.collector] {
+				t.Errorf("Desc() = %v, want %v", m.Desc(), scrapeErrorDescs[tt.collector])
+			}
+			var metric dto.Metric
+			if err := m.Write(&metric); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if got := metric.GetGauge().GetValue(); got != tt.want {
+				t.Errorf("value = %v, want %v", got, tt.want)
+			}
+			labels := make(map[string]string)
+			for _, l := range metric.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			want := map[string]string{"collector": tt.collector, "name": "pvc-1", "namespace": "default"}
+			for k, v := range want {
+				if labels[k] != v {
+					t.Errorf("label %s = %q, want %q", k, labels[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestScrapeError(t *testing.T) {
+
+	// The connection is never run, so every call fails.
+	conn := dbus.NewConn(nil)
+	m, err := New(Options{
+		Name:      "pvc-1",
+		Namespace: "default",
+		ExportMgr: ganesha.NewExportMgr(conn),
+		ClientMgr: ganesha.NewClientMgr(conn),
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// Collection is retried on each scrape.
+	for i := 0; i < 2; i++ {
+		families, err := m.registry.Gather()
+		if err != nil {
+			t.Fatalf("Gather() error = %v", err)
+		}
+
+		failed := make(map[string]float64)
+		for _, f := range families {
+			if f.GetName() != exportsPrefix+"_nfs_scrape_error" {
+				continue
+			}
+			for _, metric := range f.GetMetric() {
+				for _, l := range metric.GetLabel() {
+					if l.GetName() == "collector" {
+						failed[l.GetValue()] = metric.GetGauge().GetValue()
+					}
+				}
+			}
+		}
+
+		for _, collector := range []string{"exports", "clients", "v4ops", "ops", "fsal"} {
+			if v, ok := failed[collector]; !ok || v != 1 {
+				t.Errorf("scrape %d: %s scrape error = %v, %v, want 1", i, collector, v, ok)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/storageos/nfs/ganesha"
+)
+
+var (
+	supervisorRestartsDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_server_restarts_total",
+		"Number of times the NFS server has been restarted after exiting",
+		[]string{"name", "namespace"}, nil,
+	)
+	supervisorLastExitCodeDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_server_last_exit_code",
+		"Exit code of the last NFS server process exit, -1 if killed by a signal",
+		[]string{"name", "namespace"}, nil,
+	)
+	supervisorLastExitTimeDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_server_last_exit_timestamp_seconds",
+		"Time of the last NFS server process exit since unix epoch in seconds",
+		[]string{"name", "namespace"}, nil,
+	)
+)
+
+// SupervisorCollector collects restart statistics from the NFS server
+// supervisor.
+type SupervisorCollector struct {
+	name       string
+	namespace  string
+	supervisor *ganesha.Supervisor
+}
+
+// NewSupervisorCollector creates a new collector for the supervisor.
+func NewSupervisorCollector(name string, namespace string, supervisor *ganesha.Supervisor) SupervisorCollector {
+	return SupervisorCollector{
+		name:       name,
+		namespace:  namespace,
+		supervisor: supervisor,
+	}
+}
+
+// Describe prometheus description
+func (c SupervisorCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+// Collect restart statistics.  Exit metrics are only reported once the process
+// has exited.
+func (c SupervisorCollector) Collect(ch chan<- prometheus.Metric) {
+
+	stats := c.supervisor.Stats()
+
+	ch <- prometheus.MustNewConstMetric(
+		supervisorRestartsDesc,
+		prometheus.CounterValue,
+		float64(stats.Restarts),
+		c.name, c.namespace)
+
+	if stats.LastExitTime.IsZero() {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		supervisorLastExitCodeDesc,
+		prometheus.GaugeValue,
+		float64(stats.LastExitCode),
+		c.name, c.namespace)
+	ch <- prometheus.MustNewConstMetric(
+		supervisorLastExitTimeDesc,
+		prometheus.GaugeValue,
+		float64(stats.LastExitTime.Unix()),
+		c.name, c.namespace)
+}
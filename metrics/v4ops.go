@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/storageos/nfs/ganesha"
+	"github.com/storageos/nfs/logger"
+)
+
+var (
+	v4OpsTotalDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_v4_ops_total",
+		"Number of NFSv4 operations by operation",
+		[]string{"op", "name", "namespace"}, nil,
+	)
+	v4OpsErrorsDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_v4_ops_errors_total",
+		"Number of NFSv4 operations in error by operation",
+		[]string{"op", "name", "namespace"}, nil,
+	)
+	v4OpsLatencyDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_v4_ops_latency_seconds_total",
+		"Cumulative time consumed by NFSv4 operations by operation",
+		[]string{"op", "name", "namespace"}, nil,
+	)
+	v4OpsMinLatencyDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_v4_ops_min_latency_seconds",
+		"Minimum latency of NFSv4 operations by operation",
+		[]string{"op", "name", "namespace"}, nil,
+	)
+	v4OpsMaxLatencyDesc = prometheus.NewDesc(
+		exportsPrefix+"_nfs_v4_ops_max_latency_seconds",
+		"Maximum latency of NFSv4 operations by operation",
+		[]string{"op", "name", "namespace"}, nil,
+	)
+)
+
+// V4OpsCollector collects per-operation stats for NFSv4, such as OPEN, CLOSE,
+// GETATTR and LOOKUP.
+type V4OpsCollector struct {
+	name      string
+	namespace string
+	exportMgr exportStats
+	log       *logger.Logger
+}
+
+// NewV4OpsCollector creates a new collector for NFSv4 operations.
+func NewV4OpsCollector(name string, namespace string, exportMgr *ganesha.ExportMgr, log *logger.Logger) V4OpsCollector {
+	return V4OpsCollector{
+		name:      name,
+		namespace: namespace,
+		exportMgr: exportMgr,
+		log:       log,
+	}
+}
+
+// Describe prometheus description
+func (c V4OpsCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+// Collect NFSv4 operation stats.
+//
+// Ganesha only keeps full NFSv4 stats once they have been enabled, so no
+// metrics are reported until then.  Ganesha reports the average latency, so
+// the cumulative latency is derived from the average and the operation count.
+func (c V4OpsCollector) Collect(ch chan<- prometheus.Metric) {
+
+	var failed bool
+	defer func() { collectScrapeError(ch, "v4ops", c.name, c.namespace, failed) }()
+
+	stats, err := c.exportMgr.GetFullV4Stats()
+	if err != nil {
+		c.log.Warnf("failed to get nfs v4 operation stats: %v", err)
+		failed = true
+		return
+	}
+	if !stats.Status {
+		return
+	}
+
+	for _, op := range stats.Ops {
+		ch <- prometheus.MustNewConstMetric(
+			v4OpsTotalDesc,
+			prometheus.CounterValue,
+			float64(op.Total),
+			op.Op, c.name, c.namespace)
+		ch <- prometheus.MustNewConstMetric(
+			v4OpsErrorsDesc,
+			prometheus.CounterValue,
+			float64(op.Errors),
+			op.Op, c.name, c.namespace)
+		ch <- prometheus.MustNewConstMetric(
+			v4OpsLatencyDesc,
+			prometheus.CounterValue,
+			op.Latency*float64(op.Total)/1e3,
+			op.Op, c.name, c.namespace)
+		ch <- prometheus.MustNewConstMetric(
+			v4OpsMinLatencyDesc,
+			prometheus.GaugeValue,
+			op.MinLatency/1e3,
+			op.Op, c.name, c.namespace)
+		ch <- prometheus.MustNewConstMetric(
+			v4OpsMaxLatencyDesc,
+			prometheus.GaugeValue,
+			op.MaxLatency/1e3,
+			op.Op, c.name, c.namespace)
+	}
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/storageos/nfs/ganesha"
+)
+
+func TestV4OpsCollector(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		stats *fakeExportStats
+		want  map[string]float64
+	}{
+		{
+			name: "ops",
+			stats: &fakeExportStats{v4: &ganesha.FullV4Stats{
+				StatsBaseAnswer: statsOK,
+				Ops: []ganesha.V4OpStats{
+					{Op: "OPEN", Total: 4, Errors: 1, Latency: 2, MinLatency: 0.5, MaxLatency: 5},
+				},
+			}},
+			want: map[string]float64{
+				`storageos_nfs_v4_ops_total{name="pvc-1",namespace="default",op="OPEN"}`:                 4,
+				`storageos_nfs_v4_ops_errors_total{name="pvc-1",namespace="default",op="OPEN"}`:          1,
+				`storageos_nfs_v4_ops_latency_seconds_total{name="pvc-1",namespace="default",op="OPEN"}`: 0.008,
+				`storageos_nfs_v4_ops_min_latency_seconds{name="pvc-1",namespace="default",op="OPEN"}`:   0.0005,
+				`storageos_nfs_v4_ops_max_latency_seconds{name="pvc-1",namespace="default",op="OPEN"}`:   0.005,
+				scrapeErrorKey("v4ops"): 0,
+			},
+		},
+		{
+			name: "stats disabled",
+			stats: &fakeExportStats{v4: &ganesha.FullV4Stats{
+				StatsBaseAnswer: ganesha.StatsBaseAnswer{Error: "NFSv4 full stats disabled"},
+			}},
+			want: map[string]float64{scrapeErrorKey("v4ops"): 0},
+		},
+		{
+			name:  "error",
+			stats: &fakeExportStats{err: errors.New("dbus: not connected")},
+			want:  map[string]float64{scrapeErrorKey("v4ops"): 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewV4OpsCollector("pvc-1", "default", nil, nil)
+			c.exportMgr = tt.stats
+
+			if got := collect(t, c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collected %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
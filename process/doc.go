@@ -0,0 +1,9 @@
+// Package process provides init-style helpers for running as PID 1 within the
+// container.
+//
+// When running as PID 1, orphaned processes are re-parented to us and must be
+// reaped to prevent zombies accumulating.  Processes started and waited on
+// with os/exec must be excluded, otherwise their exit status would be lost.
+// Short-lived helpers, such as dbus-uuidgen, are run to completion before the
+// Reaper is started.
+package process
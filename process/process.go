@@ -0,0 +1,29 @@
+package process
+
+import (
+	"context"
+	"os"
+)
+
+// Stop sends sig to the process and waits for done to be closed, which should
+// happen once the process has been waited on.  If the context expires first,
+// the process is killed.
+func Stop(ctx context.Context, p *os.Process, done <-chan struct{}, sig os.Signal) error {
+
+	if err := p.Signal(sig); err != nil {
+		// The process has most likely already exited.
+		return err
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	if err := p.Kill(); err != nil {
+		return err
+	}
+	<-done
+	return ctx.Err()
+}
@@ -0,0 +1,95 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Reaper reaps zombie child processes that are not managed elsewhere.
+type Reaper struct {
+	managed func(pid int) bool
+}
+
+// NewReaper returns a new Reaper.  managed should return true for the pids of
+// child processes that will be waited on by their owner.
+//
+// Any child started with os/exec, even briefly, must either be reported as
+// managed or have been waited on before Reap is first called.  Otherwise Reap
+// may collect it first and its owner's Wait fails.
+func NewReaper(managed func(pid int) bool) *Reaper {
+	return &Reaper{
+		managed: managed,
+	}
+}
+
+// Reap waits for all unmanaged zombie children, returning the number reaped.
+// It should be called on receipt of SIGCHLD.
+//
+// Rather than waiting on any child, which could steal the exit status of a
+// managed process, /proc is scanned for zombies and each is waited on
+// individually.
+func (r *Reaper) Reap() int {
+
+	paths, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return 0
+	}
+
+	self := os.Getpid()
+	reaped := 0
+
+	for _, path := range paths {
+		pid, ppid, state, ok := readStat(path)
+		if !ok || ppid != self || state != "Z" || r.managed(pid) {
+			continue
+		}
+
+		var status unix.WaitStatus
+		if wpid, err := unix.Wait4(pid, &status, unix.WNOHANG, nil); err == nil && wpid == pid {
+			reaped++
+		}
+	}
+
+	return reaped
+}
+
+// readStat returns the pid, parent pid and state from a /proc/<pid>/stat file.
+//
+// The command name is wrapped in parentheses and may itself contain spaces or
+// parentheses, so fields are read after the last closing parenthesis.
+func readStat(path string) (int, int, string, bool) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, 0, "", false
+	}
+	stat := string(data)
+
+	open := strings.IndexByte(stat, '(')
+	end := strings.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return 0, 0, "", false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(stat[:open]))
+	if err != nil {
+		return 0, 0, "", false
+	}
+
+	// Fields after the command: state, ppid, ...
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 2 {
+		return 0, 0, "", false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, "", false
+	}
+
+	return pid, ppid, fields[0], true
+}
@@ -0,0 +1,113 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// waitZombie waits for pid to exit and become a zombie.
+func waitZombie(t *testing.T, pid int) {
+	t.Helper()
+	path := filepath.Join("/proc", strconv.Itoa(pid), "stat")
+	for i := 0; i < 500; i++ {
+		if _, _, state, ok := readStat(path); ok && state == "Z" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("process %d did not exit", pid)
+}
+
+func TestReap(t *testing.T) {
+
+	managed := exec.Command("/bin/sh", "-c", "exit 3")
+	if err := managed.Start(); err != nil {
+		t.Skipf("can't start process: %v", err)
+	}
+	orphan := exec.Command("/bin/sh", "-c", "exit 0")
+	if err := orphan.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitZombie(t, managed.Process.Pid)
+	waitZombie(t, orphan.Process.Pid)
+
+	r := NewReaper(func(pid int) bool {
+		return pid == managed.Process.Pid
+	})
+	if got := r.Reap(); got != 1 {
+		t.Errorf("Reap() = %d, want 1", got)
+	}
+	if _, err := os.Stat(filepath.Join("/proc", strconv.Itoa(orphan.Process.Pid))); !os.IsNotExist(err) {
+		t.Errorf("unmanaged process %d not reaped", orphan.Process.Pid)
+	}
+
+	// The managed process's exit status is left for its owner.
+	err := managed.Wait()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Errorf("managed Wait() = %v, want exit status 3", err)
+	}
+	if got := r.Reap(); got != 0 {
+		t.Errorf("second Reap() = %d, want 0", got)
+	}
+}
+
+func TestReadStat(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name      string
+		stat      string
+		wantPid   int
+		wantPpid  int
+		wantState string
+		wantOK    bool
+	}{
+		{
+			name:      "simple",
+			stat:      "42 (sleep) Z 1 42 42 0 -1",
+			wantPid:   42,
+			wantPpid:  1,
+			wantState: "Z",
+			wantOK:    true,
+		},
+		{
+			name:      "parentheses in command",
+			stat:      "43 (a) Z 7 (b)) S 12 43 43 0 -1",
+			wantPid:   43,
+			wantPpid:  12,
+			wantState: "S",
+			wantOK:    true,
+		},
+		{
+			name: "truncated",
+			stat: "44 (sleep) Z",
+		},
+		{
+			name: "no command",
+			stat: "45 Z 1",
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strconv.Itoa(i))
+			if err := ioutil.WriteFile(path, []byte(tt.stat+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			pid, ppid, state, ok := readStat(path)
+			if pid != tt.wantPid || ppid != tt.wantPpid || state != tt.wantState || ok != tt.wantOK {
+				t.Errorf("readStat() = %d, %d, %q, %v, want %d, %d, %q, %v",
+					pid, ppid, state, ok, tt.wantPid, tt.wantPpid, tt.wantState, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+// Package recovery manages the directory nfs-ganesha uses to record NFSv4
+// clients, so that they can reclaim their opens and locks after the server
+// restarts or is rescheduled.
+//
+// nfs-ganesha's `fs` recovery backend keeps a directory per client under
+// RecoveryRoot, in a subdirectory named after the host.  Pods rescheduled by a
+// Deployment get a new host name, so records left by previous hosts are
+// adopted before nfs-ganesha is started.
+package recovery
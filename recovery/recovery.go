@@ -0,0 +1,330 @@
+package recovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/storageos/nfs/logger"
+)
+
+// Backend is the nfs-ganesha recovery backend managed by this package.
+const Backend = "fs"
+
+// Subdirectories of RecoveryRoot used by the fs backend.  Current holds the
+// clients of the running server.  Old holds the clients of the previous
+// server, which may reclaim during the grace period.
+const (
+	Current = "v4recov"
+	Old     = "v4old"
+)
+
+// Record is a client recorded in the recovery directory.
+//
+// Client is nfs-ganesha's identifier for the client, typically its address
+// followed by the client-supplied owner string.
+type Record struct {
+	Host     string    `json:"host"`
+	Dir      string    `json:"dir"`
+	Client   string    `json:"client"`
+	Modified time.Time `json:"modified"`
+}
+
+// Dir is the recovery directory of an nfs-ganesha server.
+type Dir struct {
+	root string
+	host string
+	log  *logger.Logger
+}
+
+// New returns the recovery directory at root for the server running on host.
+// The directory is not created until Prepare is called.
+func New(root string, host string, log *logger.Logger) (*Dir, error) {
+	if !filepath.IsAbs(root) {
+		return nil, fmt.Errorf("recovery root %q must be an absolute path", root)
+	}
+	if host == "" {
+		return nil, errors.New("recovery host name must be set")
+	}
+	return &Dir{
+		root: filepath.Clean(root),
+		host: host,
+		log:  log,
+	}, nil
+}
+
+// Root returns the recovery root, as set in nfs-ganesha's RecoveryRoot.
+func (d *Dir) Root() string {
+	return d.root
+}
+
+// Prepare creates and validates the recovery directory, then adopts the
+// records of previous hosts and removes stale records.  Records not modified
+// within maxAge are stale, or none if maxAge is 0.
+//
+// It must be called before nfs-ganesha is started.
+func (d *Dir) Prepare(maxAge time.Duration) error {
+
+	for _, sub := range []string{Current, Old} {
+		if err := os.MkdirAll(filepath.Join(d.root, sub, d.host), 0755); err != nil {
+			return err
+		}
+	}
+	if err := d.validate(); err != nil {
+		return err
+	}
+
+	for _, sub := range []string{Current, Old} {
+		if err := d.adopt(sub); err != nil {
+			return err
+		}
+		if maxAge > 0 {
+			if err := d.clean(sub, maxAge); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks that the recovery root is a writable directory.
+func (d *Dir) validate() error {
+
+	info, err := os.Stat(d.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("recovery root %s is not a directory", d.root)
+	}
+	if err := unix.Access(d.root, unix.W_OK); err != nil {
+		return fmt.Errorf("recovery root %s is not writable: %v", d.root, err)
+	}
+	return nil
+}
+
+// Persistent returns false if the recovery root is on the same filesystem as
+// the container's root, in which case records are lost when the pod is
+// rescheduled.
+func (d *Dir) Persistent() (bool, error) {
+	var root, dir unix.Stat_t
+	if err := unix.Stat("/", &root); err != nil {
+		return false, err
+	}
+	if err := unix.Stat(d.root, &dir); err != nil {
+		return false, err
+	}
+	return root.Dev != dir.Dev, nil
+}
+
+// adopt moves the records of other hosts in sub into the current host's
+// directory.  Only one server uses a recovery root at a time, so records of
+// other hosts were left by earlier instances of this server.
+func (d *Dir) adopt(sub string) error {
+
+	hosts, err := ioutil.ReadDir(filepath.Join(d.root, sub))
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(d.root, sub, d.host)
+
+	for _, host := range hosts {
+		if host.Name() == d.host {
+			continue
+		}
+		src := filepath.Join(d.root, sub, host.Name())
+		if !host.IsDir() {
+			d.log.Warnf("removing unexpected file %s from recovery directory", src)
+			if err := os.Remove(src); err != nil {
+				return err
+			}
+			continue
+		}
+
+		clients, err := ioutil.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, client := range clients {
+			// A client recorded by both hosts already has a record here.
+			err := os.Rename(filepath.Join(src, client.Name()), filepath.Join(dst, client.Name()))
+			if err != nil && !os.IsExist(err) {
+				return err
+			}
+		}
+		if err := os.RemoveAll(src); err != nil {
+			return err
+		}
+		d.log.Infof("adopted %d nfs client recovery records from host %s", len(clients), host.Name())
+	}
+	return nil
+}
+
+// clean removes the records in sub of the current host that have not been
+// modified within maxAge.
+func (d *Dir) clean(sub string, maxAge time.Duration) error {
+
+	records, err := d.records(sub, d.host)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if time.Since(r.Modified) < maxAge {
+			continue
+		}
+		base := filepath.Join(d.root, sub, d.host)
+		if err := os.RemoveAll(filepath.Join(base, r.path)); err != nil {
+			return err
+		}
+
+		// Remove the parents of split identifiers once they are empty.
+		for dir := filepath.Dir(r.path); dir != "."; dir = filepath.Dir(dir) {
+			if os.Remove(filepath.Join(base, dir)) != nil {
+				break
+			}
+		}
+		d.log.Infof("removed stale nfs client recovery record %s", r.Client)
+	}
+	return nil
+}
+
+// Records returns the clients recorded by all hosts, sorted by host, directory
+// and client.
+func (d *Dir) Records() ([]Record, error) {
+
+	var out []Record
+	for _, sub := range []string{Current, Old} {
+		hosts, err := ioutil.ReadDir(filepath.Join(d.root, sub))
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hosts {
+			if !host.IsDir() {
+				continue
+			}
+			records, err := d.records(sub, host.Name())
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range records {
+				out = append(out, r.Record)
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		if out[i].Dir != out[j].Dir {
+			return out[i].Dir < out[j].Dir
+		}
+		return out[i].Client < out[j].Client
+	})
+	return out, nil
+}
+
+// record is a Record with the path of its directory, relative to the host
+// directory.
+type record struct {
+	Record
+	path string
+}
+
+// records returns the clients recorded in sub by host.
+//
+// Client identifiers longer than a file name are split by nfs-ganesha into
+// nested directories, so each client is the path to a directory with no
+// subdirectories.
+func (d *Dir) records(sub string, host string) ([]record, error) {
+
+	base := filepath.Join(d.root, sub, host)
+
+	var out []record
+	var walk func(path string) error
+	walk = func(path string) error {
+		entries, err := ioutil.ReadDir(filepath.Join(base, path))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			child := filepath.Join(path, entry.Name())
+			leaf, err := isLeaf(filepath.Join(base, child))
+			if err != nil {
+				return err
+			}
+			if !leaf {
+				if err := walk(child); err != nil {
+					return err
+				}
+				continue
+			}
+			out = append(out, record{
+				Record: Record{
+					Host:     host,
+					Dir:      sub,
+					Client:   strings.Replace(child, string(filepath.Separator), "", -1),
+					Modified: entry.ModTime(),
+				},
+				path: child,
+			})
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// isLeaf returns true if the directory at path has no subdirectories.
+func isLeaf(path string) (bool, error) {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Handler returns an http handler that lists the recorded clients as JSON.
+func (d *Dir) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		records, err := d.Records()
+		if err != nil {
+			d.log.Errorf("failed to read recovery records: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if records == nil {
+			records = []Record{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(records); err != nil {
+			d.log.Warnf("failed writing recovery response: %v", err)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package recovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPrepare(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "recovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	mkdir := func(path string, age time.Duration) {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(full, 0755); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(-age)
+		if err := os.Chtimes(full, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Records left by a previous host, including a client identifier split
+	// over two directories and a client also recorded by the current host.
+	mkdir("v4recov/nfs-old/::ffff:10.0.0.1-(25:Linux NFSv4.1 web-0)", 0)
+	mkdir("v4recov/nfs-old/::ffff:10.0.0.2-(25:Linux/ NFSv4.1 web-1)", 0)
+	mkdir("v4recov/nfs-old/::ffff:10.0.0.3-(25:Linux NFSv4.1 web-2)", 0)
+	mkdir("v4recov/nfs-new/::ffff:10.0.0.3-(25:Linux NFSv4.1 web-2)", 0)
+	mkdir("v4old/nfs-old/::ffff:10.0.0.4-(25:Linux NFSv4.1 web-3)", 48*time.Hour)
+
+	d, err := New(root, "nfs-new", nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := d.Prepare(24 * time.Hour); err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+
+	records, err := d.Records()
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	var got []string
+	for _, r := range records {
+		if r.Host != "nfs-new" {
+			t.Errorf("record %s has host %s, want nfs-new", r.Client, r.Host)
+		}
+		got = append(got, r.Dir+" "+r.Client)
+	}
+	want := []string{
+		"v4recov ::ffff:10.0.0.1-(25:Linux NFSv4.1 web-0)",
+		"v4recov ::ffff:10.0.0.2-(25:Linux NFSv4.1 web-1)",
+		"v4recov ::ffff:10.0.0.3-(25:Linux NFSv4.1 web-2)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Records() = %q, want %q", got, want)
+	}
+
+	for _, path := range []string{"v4recov/nfs-old", "v4old/nfs-old"} {
+		if _, err := os.Stat(filepath.Join(root, path)); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after Prepare()", path)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		root    string
+		host    string
+		wantErr bool
+	}{
+		{"/export/.recovery", "nfs-0", false},
+		{"export/.recovery", "nfs-0", true},
+		{"/export/.recovery", "", true},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.root, tt.host, nil); (err != nil) != tt.wantErr {
+			t.Errorf("New(%q, %q) error = %v, wantErr %v", tt.root, tt.host, err, tt.wantErr)
+		}
+	}
+}